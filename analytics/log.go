@@ -0,0 +1,409 @@
+// Package analytics reads telemetry logs of the game and groups them into plays.
+package analytics
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"time"
+
+	"github.com/tsujio/game-four-color-theorem/puzzle"
+)
+
+// Record is a telemetry event of a play
+type Record struct {
+	Time     int64           `json:"time"`
+	PlayerID string          `json:"player_id"`
+	PlayID   string          `json:"play_id"`
+	Action   string          `json:"action"`
+	Event    json.RawMessage `json:"event"`
+}
+
+// Action of the touch logs sent before touch streams, whose event is the list of touches
+const legacyTouchAction = "touch_log"
+
+// Line of the log in any format
+type logLine struct {
+	Record
+	Timestamp time.Time       `json:"timestamp"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+// Payload stored by the logging server, which is a batch of records
+// or a legacy event whose fields are flattened with its sender
+type logPayload struct {
+	Records  []Record        `json:"records"`
+	PlayerID string          `json:"player_id"`
+	PlayID   string          `json:"play_id"`
+	Action   string          `json:"action"`
+	Touches  json.RawMessage `json:"touches"`
+}
+
+// ReadRecords reads JSON lines written by the file sink of the game, or
+// log entries stored by the logging server
+func ReadRecords(r io.Reader) ([]Record, error) {
+	var records []Record
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var line logLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+
+		if line.Payload == nil {
+			records = append(records, line.Record)
+			continue
+		}
+
+		var payload logPayload
+		if err := json.Unmarshal(line.Payload, &payload); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		switch {
+		case payload.Records != nil:
+			records = append(records, payload.Records...)
+		case payload.Touches != nil:
+			records = append(records, Record{
+				Time:     line.Timestamp.UnixMilli(),
+				PlayerID: payload.PlayerID,
+				PlayID:   payload.PlayID,
+				Action:   legacyTouchAction,
+				Event:    payload.Touches,
+			})
+		case payload.Action != "":
+			records = append(records, Record{
+				Time:     line.Timestamp.UnixMilli(),
+				PlayerID: payload.PlayerID,
+				PlayID:   payload.PlayID,
+				Action:   payload.Action,
+				Event:    line.Payload,
+			})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+type ColorChange struct {
+	Ticks uint64 `json:"ticks"`
+	Map   int    `json:"map"`
+	Area  int    `json:"area"`
+	Color int    `json:"color"`
+}
+
+// Touch is a touch on the screen. Touches of the legacy logs have no camera,
+// which were in the world since the screen was not scrolled.
+type Touch struct {
+	Ticks        uint64       `json:"ticks"`
+	JustTouched  bool         `json:"just_touched"`
+	JustReleased bool         `json:"just_released"`
+	X            int          `json:"x"`
+	Y            int          `json:"y"`
+	Camera       *TouchCamera `json:"camera,omitempty"`
+	// Map being played in the marathon
+	Map int `json:"-"`
+}
+
+type TouchCamera struct {
+	X     float64 `json:"x"`
+	Y     float64 `json:"y"`
+	Scale float64 `json:"scale"`
+	ViewX float64 `json:"view_x"`
+	ViewY float64 `json:"view_y"`
+}
+
+// Get the position of the touch in the world
+func (t *Touch) World() *puzzle.Point {
+	p := &puzzle.Point{X: float64(t.X), Y: float64(t.Y)}
+	if c := t.Camera; c != nil && c.Scale > 0 {
+		p = p.Sub(&puzzle.Point{X: c.ViewX, Y: c.ViewY}).Div(c.Scale).Add(&puzzle.Point{X: c.X, Y: c.Y})
+	}
+	return p
+}
+
+// Touch states in touch streams
+const (
+	touchStateReleased = iota
+	touchStateTouched
+)
+
+type touchStream struct {
+	Ticks   uint64   `json:"ticks"`
+	Deltas  [][4]int `json:"deltas"`
+	Cameras []struct {
+		Index int `json:"index"`
+		TouchCamera
+	} `json:"cameras"`
+}
+
+func (s *touchStream) decode() []Touch {
+	var touches []Touch
+	var camera *TouchCamera
+	ticks, x, y := s.Ticks, 0, 0
+	for i, d := range s.Deltas {
+		for j := range s.Cameras {
+			if s.Cameras[j].Index == i {
+				camera = &s.Cameras[j].TouchCamera
+			}
+		}
+		ticks, x, y = ticks+uint64(d[0]), x+d[1], y+d[2]
+		touches = append(touches, Touch{
+			Ticks:        ticks,
+			JustTouched:  d[3] == touchStateTouched,
+			JustReleased: d[3] == touchStateReleased,
+			X:            x,
+			Y:            y,
+			Camera:       camera,
+		})
+	}
+	return touches
+}
+
+// Play is the events from the start of a game
+type Play struct {
+	PlayerID  string
+	PlayID    string
+	StartTime int64
+	Seed      int64
+	// Version of the generator of the maps, which is 0 for the legacy logs whose maps
+	// were generated from the random source shared with the effects
+	GeneratorVersion int
+	Colors           int
+	MinimizeColors   bool
+	Daily            string
+	Marathon         bool
+	Zen              bool
+	Duel             bool
+	// Reached the game over, which is the time up in the marathon
+	Completed bool
+	Score     int
+	UsedColor int
+	// Ticks of the last playing or color change event
+	LastTicks uint64
+	// Maps completed in the marathon
+	CompletedMapNum int
+	ColorChanges    []ColorChange
+	// Touches from the start, in the order of time
+	Touches []Touch
+}
+
+// Get the name of the rule, which is like the ranking name
+func (p *Play) Rule() string {
+	switch {
+	case p.Zen:
+		return "zen"
+	case p.Duel:
+		return "duel"
+	case p.Marathon:
+		return "marathon"
+	case p.Daily != "":
+		return "daily"
+	case p.MinimizeColors:
+		return "min-colors"
+	default:
+		return fmt.Sprintf("%dcolors", p.Colors)
+	}
+}
+
+// Get the ticks to complete the map, which are of the last color change
+func (p *Play) CompleteTicks() uint64 {
+	if len(p.ColorChanges) == 0 {
+		return 0
+	}
+	return p.ColorChanges[len(p.ColorChanges)-1].Ticks
+}
+
+// Whether the maps of the play can be regenerated, which needs the generator of the version
+func (p *Play) CanGenerateMap() bool {
+	return p.GeneratorVersion == puzzle.GeneratorVersion
+}
+
+// Regenerate the map of the play, which is the mapNum-th one in the marathon.
+// It returns nil if the map cannot be regenerated.
+func (p *Play) GenerateMap(mapNum int) []puzzle.Triangle {
+	if !p.CanGenerateMap() {
+		return nil
+	}
+	random := rand.New(rand.NewSource(p.Seed))
+	var triangles []puzzle.Triangle
+	for i := 0; i <= mapNum; i++ {
+		triangles = puzzle.GenerateMap(random, p.Colors, puzzle.GetMaxTriangleNum(p.Marathon, i))
+	}
+	return triangles
+}
+
+// Get the colors of the map after the color changes
+func (p *Play) GetColors(mapNum int, areaNum int) []int {
+	colors := make([]int, areaNum)
+	for i := range colors {
+		colors[i] = -1
+	}
+	for _, c := range p.ColorChanges {
+		if c.Map == mapNum && c.Area >= 0 && c.Area < areaNum {
+			colors[c.Area] = c.Color
+		}
+	}
+	return colors
+}
+
+func (p *Play) addTouches(touches []Touch) {
+	for _, t := range touches {
+		t.Map = p.CompletedMapNum
+		p.Touches = append(p.Touches, t)
+	}
+}
+
+// Colors of the legacy logs, whose games had only the rule of 4 colors
+const legacyColors = 4
+
+// Generator version of the logs before codes, whose maps were generated from the seed
+const uncodedGeneratorVersion = 1
+
+type initializeEvent struct {
+	Seed int64 `json:"seed"`
+}
+
+// Event of the start of a game. The legacy logs have none of the fields,
+// whose seed is in the initialize event of the play.
+type startGameEvent struct {
+	Colors         int    `json:"colors"`
+	MinimizeColors bool   `json:"minimize_colors"`
+	Daily          string `json:"daily"`
+	Marathon       bool   `json:"marathon"`
+	Zen            bool   `json:"zen"`
+	Duel           bool   `json:"duel"`
+	Seed           int64  `json:"seed"`
+	Code           string `json:"code"`
+}
+
+// Get the generator version of the maps of the game, which is 0 for the legacy logs
+func (e *startGameEvent) getGeneratorVersion() int {
+	if e.Code != "" {
+		if v, err := puzzle.GetCodeGeneratorVersion(e.Code); err == nil {
+			return v
+		}
+		return 0
+	}
+	if e.Colors > 0 {
+		return uncodedGeneratorVersion
+	}
+	return 0
+}
+
+type ticksEvent struct {
+	Ticks uint64 `json:"ticks"`
+	Score int    `json:"score"`
+}
+
+type gameOverEvent struct {
+	Score     int `json:"score"`
+	UsedColor int `json:"used_color"`
+}
+
+// GroupPlays groups the records into plays, in the order of their starts.
+// Records before the start of a game, such as on the title screen, are ignored.
+func GroupPlays(records []Record) ([]*Play, error) {
+	var plays []*Play
+	current := make(map[string]*Play)
+	// Seeds of the initialize events, which the legacy logs have instead of those of the starts
+	seeds := make(map[string]int64)
+
+	for i, r := range records {
+		if r.Action == "initialize" {
+			var e initializeEvent
+			if err := json.Unmarshal(r.Event, &e); err != nil {
+				return nil, fmt.Errorf("record %d: %w", i, err)
+			}
+			seeds[r.PlayID] = e.Seed
+			continue
+		}
+
+		if r.Action == "start_game" {
+			var e startGameEvent
+			if err := json.Unmarshal(r.Event, &e); err != nil {
+				return nil, fmt.Errorf("record %d: %w", i, err)
+			}
+			p := &Play{
+				PlayerID:         r.PlayerID,
+				PlayID:           r.PlayID,
+				StartTime:        r.Time,
+				Seed:             e.Seed,
+				GeneratorVersion: e.getGeneratorVersion(),
+				Colors:           e.Colors,
+				MinimizeColors:   e.MinimizeColors,
+				Daily:            e.Daily,
+				Marathon:         e.Marathon,
+				Zen:              e.Zen,
+				Duel:             e.Duel,
+			}
+			if e.Colors == 0 {
+				p.Seed, p.Colors = seeds[r.PlayID], legacyColors
+			}
+			plays = append(plays, p)
+			current[r.PlayID] = p
+			continue
+		}
+
+		p, ok := current[r.PlayID]
+		if !ok || p.Completed {
+			continue
+		}
+
+		var err error
+		switch r.Action {
+		case "playing":
+			var e ticksEvent
+			if err = json.Unmarshal(r.Event, &e); err == nil && e.Ticks > p.LastTicks {
+				p.LastTicks = e.Ticks
+			}
+		case "marathon_map_complete":
+			p.CompletedMapNum++
+		case "color_change":
+			var e ColorChange
+			if err = json.Unmarshal(r.Event, &e); err == nil {
+				p.ColorChanges = append(p.ColorChanges, e)
+				p.LastTicks = e.Ticks
+			}
+		case "game_over":
+			var e gameOverEvent
+			if err = json.Unmarshal(r.Event, &e); err == nil {
+				p.Completed = true
+				p.Score = e.Score
+				p.UsedColor = e.UsedColor
+			}
+		case "touches":
+			var e touchStream
+			if err = json.Unmarshal(r.Event, &e); err == nil {
+				p.addTouches(e.decode())
+			}
+		case "touch", legacyTouchAction:
+			var touches []Touch
+			if r.Action == "touch" {
+				var t Touch
+				err = json.Unmarshal(r.Event, &t)
+				touches = []Touch{t}
+			} else {
+				err = json.Unmarshal(r.Event, &touches)
+			}
+			if err == nil {
+				p.addTouches(touches)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %w", i, err)
+		}
+	}
+
+	return plays, nil
+}
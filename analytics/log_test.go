@@ -0,0 +1,64 @@
+package analytics
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/tsujio/game-four-color-theorem/puzzle"
+)
+
+func TestGroupPlaysOfLegacyLogs(t *testing.T) {
+	// Events of the logging server flattened with their senders, before the typed events
+	logs := `{"timestamp":"2023-01-01T00:00:00Z","payload":{"player_id":"p","play_id":"a","action":"initialize","seed":123}}
+{"timestamp":"2023-01-01T00:00:01Z","payload":{"player_id":"p","play_id":"a","action":"start_game"}}
+`
+	records, err := ReadRecords(strings.NewReader(logs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plays, err := GroupPlays(records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plays) != 1 {
+		t.Fatalf("%d plays", len(plays))
+	}
+
+	p := plays[0]
+	if p.Seed != 123 || p.Colors != 4 || p.GeneratorVersion != 0 {
+		t.Fatalf("seed %d, colors %d, generator version %d", p.Seed, p.Colors, p.GeneratorVersion)
+	}
+	if p.CanGenerateMap() || p.GenerateMap(0) != nil {
+		t.Fatal("map of the legacy play regenerated")
+	}
+}
+
+func TestGroupPlaysGeneratorVersions(t *testing.T) {
+	code := &puzzle.PuzzleCode{GeneratorVersion: puzzle.GeneratorVersion, Seed: 5, Mode: puzzle.ModeNormal, ColorNum: 3}
+	oldCode := &puzzle.PuzzleCode{GeneratorVersion: puzzle.GeneratorVersion - 1, Seed: 5, Mode: puzzle.ModeNormal, ColorNum: 3}
+	starts := []string{
+		`{"colors":3,"seed":5,"code":"` + code.Encode() + `"}`,
+		`{"colors":3,"seed":5,"code":"` + oldCode.Encode() + `"}`,
+		// Typed events before codes
+		`{"colors":3,"seed":5}`,
+	}
+	var records []Record
+	for i, s := range starts {
+		records = append(records, Record{PlayID: string(rune('a' + i)), Action: "start_game", Event: json.RawMessage(s)})
+	}
+	plays, err := GroupPlays(records)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []int{puzzle.GeneratorVersion, puzzle.GeneratorVersion - 1, 1}
+	for i, p := range plays {
+		if p.GeneratorVersion != expected[i] || p.Seed != 5 || p.Colors != 3 {
+			t.Fatalf("play %d has generator version %d, seed %d and colors %d", i, p.GeneratorVersion, p.Seed, p.Colors)
+		}
+	}
+	if len(plays[0].GenerateMap(0)) == 0 {
+		t.Fatal("map of the current generator not regenerated")
+	}
+}
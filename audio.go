@@ -0,0 +1,176 @@
+package main
+
+import (
+	"io"
+	"log"
+
+	"github.com/hajimehoshi/ebiten/v2/audio"
+)
+
+const (
+	audioSampleRate = 48000
+	// Decoded audio is 16bit stereo
+	audioBytesPerSecond = audioSampleRate * 4
+	maxVoiceNum         = 8
+	duckingVolume       = 0.3
+)
+
+// Sound is what the game plays, which is implemented by AudioManager
+// and by silentSound for headless runs
+type Sound interface {
+	Update()
+	SetVolumes(master, bgm, sfx float64)
+	SetMuted(muted bool)
+	PlaySE(data []byte)
+	PlayJingle(data []byte)
+	PlayStream(src io.Reader)
+	PlayBGM()
+	PauseBGM()
+	getBeatDelay() int
+}
+
+// AudioManager plays all sounds of the game through master, BGM and SFX volume buses.
+type AudioManager struct {
+	bgm          *audio.Player
+	voices       []*audio.Player
+	masterVolume float64
+	bgmVolume    float64
+	sfxVolume    float64
+	muted        bool
+	duckingTicks int
+}
+
+func newAudioManager(bgm *audio.Player) *AudioManager {
+	return &AudioManager{
+		bgm:          bgm,
+		masterVolume: 1.0,
+		bgmVolume:    1.0,
+		sfxVolume:    1.0,
+	}
+}
+
+func (m *AudioManager) SetVolumes(master, bgm, sfx float64) {
+	m.masterVolume, m.bgmVolume, m.sfxVolume = master, bgm, sfx
+	m.updateVolumes()
+}
+
+func (m *AudioManager) SetMuted(muted bool) {
+	m.muted = muted
+	m.updateVolumes()
+}
+
+func (m *AudioManager) getBGMVolume() float64 {
+	if m.muted {
+		return 0
+	}
+	v := m.masterVolume * m.bgmVolume
+	if m.duckingTicks > 0 {
+		v *= duckingVolume
+	}
+	return v
+}
+
+func (m *AudioManager) getSFXVolume() float64 {
+	if m.muted {
+		return 0
+	}
+	return m.masterVolume * m.sfxVolume
+}
+
+func (m *AudioManager) updateVolumes() {
+	m.bgm.SetVolume(m.getBGMVolume())
+	for _, p := range m.voices {
+		p.SetVolume(m.getSFXVolume())
+	}
+}
+
+// Update releases finished voices and restores the BGM after ducking. Call it every tick.
+func (m *AudioManager) Update() {
+	var voices []*audio.Player
+	for _, p := range m.voices {
+		if p.IsPlaying() {
+			voices = append(voices, p)
+		} else {
+			p.Close()
+		}
+	}
+	m.voices = voices
+
+	if m.duckingTicks > 0 {
+		m.duckingTicks--
+		if m.duckingTicks == 0 {
+			m.updateVolumes()
+		}
+	}
+}
+
+func (m *AudioManager) addVoice(p *audio.Player) {
+	// Stop the oldest voice so that rapid taps don't stack players
+	if len(m.voices) >= maxVoiceNum {
+		m.voices[0].Close()
+		m.voices = m.voices[1:]
+	}
+
+	p.SetVolume(m.getSFXVolume())
+	p.Play()
+	m.voices = append(m.voices, p)
+}
+
+func (m *AudioManager) PlaySE(data []byte) {
+	if m.muted {
+		return
+	}
+
+	m.addVoice(audio.NewPlayerFromBytes(audioContext, data))
+}
+
+// PlayStream plays a sound effect generated on the fly
+func (m *AudioManager) PlayStream(src io.Reader) {
+	if m.muted {
+		return
+	}
+
+	p, err := audio.NewPlayer(audioContext, src)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	m.addVoice(p)
+}
+
+// Get the number of samples to wait for the next beat of the BGM
+func (m *AudioManager) getBeatDelay() int {
+	if !m.bgm.IsPlaying() {
+		return 0
+	}
+	return getBeatDelay(m.bgm.Current())
+}
+
+// PlayJingle plays the sound effect while lowering the BGM under it
+func (m *AudioManager) PlayJingle(data []byte) {
+	m.duckingTicks = len(data) * 60 / audioBytesPerSecond
+	m.updateVolumes()
+	m.PlaySE(data)
+}
+
+func (m *AudioManager) PlayBGM() {
+	m.bgm.Rewind()
+	m.bgm.Play()
+}
+
+func (m *AudioManager) PauseBGM() {
+	m.bgm.Pause()
+}
+
+// silentSound never touches the audio device
+type silentSound struct{}
+
+func (silentSound) Update()                             {}
+func (silentSound) SetVolumes(master, bgm, sfx float64) {}
+func (silentSound) SetMuted(muted bool)                 {}
+func (silentSound) PlaySE(data []byte)                  {}
+func (silentSound) PlayJingle(data []byte)              {}
+func (silentSound) PlayStream(src io.Reader)            {}
+func (silentSound) PlayBGM()                            {}
+func (silentSound) PauseBGM()                           {}
+func (silentSound) getBeatDelay() int                   { return 0 }
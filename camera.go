@@ -0,0 +1,118 @@
+package main
+
+import (
+	"image/color"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/tsujio/game-util/touchutil"
+)
+
+const (
+	cameraMinScale = 0.1
+	cameraMaxScale = 8.0
+)
+
+// Camera converts world coordinates into screen coordinates.
+// The world point center is shown at the screen point viewCenter.
+type Camera struct {
+	center     Point
+	scale      float64
+	viewCenter Point
+}
+
+func (c *Camera) toScreen(p *Point) *Point {
+	return p.Sub(&c.center).Mul(c.scale).Add(&c.viewCenter)
+}
+
+func (c *Camera) toWorld(p *Point) *Point {
+	return p.Sub(&c.viewCenter).Div(c.scale).Add(&c.center)
+}
+
+// Move the camera toward target smoothly
+func (c *Camera) follow(target *Point) {
+	c.center = *c.center.Add(target.Sub(&c.center).Mul(0.05))
+}
+
+// Move the camera by the screen distance v
+func (c *Camera) pan(v *Point) {
+	c.center = *c.center.Sub(v.Div(c.scale))
+}
+
+// Zoom the camera keeping the world point at the screen position p fixed
+func (c *Camera) zoomAt(p *Point, factor float64) {
+	w := c.toWorld(p)
+	c.scale = math.Min(math.Max(c.scale*factor, cameraMinScale), cameraMaxScale)
+	c.center = *w.Sub(p.Sub(&c.viewCenter).Div(c.scale))
+}
+
+func (c *Camera) drawLine(screen *ebiten.Image, p, q *Point, clr color.Color) {
+	sp, sq := c.toScreen(p), c.toScreen(q)
+	ebitenutil.DrawLine(screen, sp.X, sp.Y, sq.X, sq.Y, clr)
+}
+
+// CameraController moves the camera by pinch and two-finger pan on touch
+// screens, and by wheel and right (or middle) button drag with the mouse.
+// Single taps and left clicks are left for coloring.
+type CameraController struct {
+	touches   []touchutil.TouchPosition
+	pinching  bool
+	pinchMid  Point
+	pinchDist float64
+	dragging  bool
+	dragPos   Point
+}
+
+// Update the camera by user input and report whether it has been moved
+func (cc *CameraController) Update(camera *Camera, input TouchInput) bool {
+	moved := false
+
+	cc.touches = input.AppendTouchPositions(cc.touches[:0])
+	if len(cc.touches) >= 2 {
+		p0 := Point{X: float64(cc.touches[0].X), Y: float64(cc.touches[0].Y)}
+		p1 := Point{X: float64(cc.touches[1].X), Y: float64(cc.touches[1].Y)}
+		mid := p0.Add(&p1).Div(2)
+		dist := p1.Sub(&p0).Norm()
+
+		if cc.pinching {
+			camera.pan(mid.Sub(&cc.pinchMid))
+			if cc.pinchDist > 0 && dist > 0 {
+				camera.zoomAt(mid, dist/cc.pinchDist)
+			}
+			moved = true
+		}
+
+		cc.pinching = true
+		cc.pinchMid = *mid
+		cc.pinchDist = dist
+	} else {
+		cc.pinching = false
+	}
+
+	c := input.GetCursorPosition()
+	cursor := Point{X: float64(c.X), Y: float64(c.Y)}
+
+	if dy := input.GetWheel(); dy != 0 {
+		camera.zoomAt(&cursor, math.Pow(1.1, dy))
+		moved = true
+	}
+
+	if input.IsMouseButtonPressed(ebiten.MouseButtonRight) || input.IsMouseButtonPressed(ebiten.MouseButtonMiddle) {
+		if cc.dragging {
+			camera.pan(cursor.Sub(&cc.dragPos))
+			moved = true
+		}
+		cc.dragging = true
+		cc.dragPos = cursor
+	} else {
+		cc.dragging = false
+	}
+
+	return moved
+}
+
+// Report whether the camera is being moved by a gesture, in which touches are not taps
+func (cc *CameraController) IsGesturing() bool {
+	return cc.pinching || cc.dragging || len(cc.touches) >= 2
+}
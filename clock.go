@@ -0,0 +1,29 @@
+package main
+
+import (
+	"time"
+)
+
+// Clock gives the current time to the game
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// ManualClock only advances when told, for headless runs
+type ManualClock struct {
+	now time.Time
+}
+
+func (c *ManualClock) Now() time.Time {
+	return c.now
+}
+
+func (c *ManualClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
@@ -0,0 +1,385 @@
+// Command analytics reports gameplay statistics from exported telemetry logs,
+// which are JSON lines of the file sink or of the logging server.
+//
+//	analytics [-seeds 20] [-heatmap dir] logs.jsonl...
+//
+// It reports completion rates by rule, map size and seed, time-to-complete
+// distributions and abandonment points, and renders heatmaps of the first taps
+// onto the maps regenerated from the seeds.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image/color"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/tsujio/game-four-color-theorem/analytics"
+	"github.com/tsujio/game-four-color-theorem/puzzle"
+	"github.com/tsujio/game-four-color-theorem/render"
+)
+
+const ticksPerSecond = 60
+
+// Map of a play with its difficulty
+type mapInfo struct {
+	triangles    []puzzle.Triangle
+	chromaticNum int
+	adjacentsNum int
+}
+
+type mapKey struct {
+	seed     int64
+	colors   int
+	marathon bool
+}
+
+var maps = make(map[mapKey]*mapInfo)
+
+func getMap(p *analytics.Play) *mapInfo {
+	key := mapKey{seed: p.Seed, colors: p.Colors, marathon: p.Marathon}
+	if m, ok := maps[key]; ok {
+		return m
+	}
+
+	triangles := p.GenerateMap(0)
+	adjacents := puzzle.GetTriangleAdjacents(triangles)
+	m := &mapInfo{
+		triangles:    triangles,
+		chromaticNum: puzzle.GetChromaticNumber(adjacents),
+	}
+	for _, a := range adjacents {
+		m.adjacentsNum += len(a)
+	}
+	maps[key] = m
+	return m
+}
+
+type stat struct {
+	plays     int
+	completed int
+}
+
+func (s *stat) add(p *analytics.Play) {
+	s.plays++
+	if p.Completed {
+		s.completed++
+	}
+}
+
+func (s *stat) rate() string {
+	if s.plays == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", float64(s.completed)/float64(s.plays)*100)
+}
+
+func formatTicks(ticks uint64) string {
+	secs := ticks / ticksPerSecond
+	return fmt.Sprintf("%d:%02d", secs/60, secs%60)
+}
+
+// Get the percentile of the sorted values
+func percentile(values []uint64, p float64) uint64 {
+	if len(values) == 0 {
+		return 0
+	}
+	i := int(math.Round(p / 100 * float64(len(values)-1)))
+	return values[i]
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func reportCompletion(w io.Writer, plays []*analytics.Play, seedNum int) {
+	byRule := make(map[string]*stat)
+	bySize := make(map[int]*stat)
+	bySeed := make(map[mapKey]*stat)
+	seedRules := make(map[mapKey]string)
+	for _, p := range plays {
+		if p.Zen {
+			continue
+		}
+
+		rule := p.Rule()
+		if byRule[rule] == nil {
+			byRule[rule] = &stat{}
+		}
+		byRule[rule].add(p)
+
+		// The marathon has maps of increasing sizes
+		if p.Marathon {
+			continue
+		}
+
+		key := mapKey{seed: p.Seed, colors: p.Colors}
+		if bySeed[key] == nil {
+			bySeed[key] = &stat{}
+		}
+		bySeed[key].add(p)
+		seedRules[key] = rule
+
+		// Maps of other generators, such as of the legacy logs, are not known
+		if !p.CanGenerateMap() {
+			continue
+		}
+		size := len(getMap(p).triangles) / 5 * 5
+		if bySize[size] == nil {
+			bySize[size] = &stat{}
+		}
+		bySize[size].add(p)
+	}
+
+	fmt.Fprintln(w, "COMPLETION BY RULE (except zen)")
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "rule\tplays\tcompleted\trate\t")
+	for _, rule := range sortedKeys(byRule) {
+		s := byRule[rule]
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t\n", rule, s.plays, s.completed, s.rate())
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "COMPLETION BY DIFFICULTY (areas of the map)")
+	tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "areas\tplays\tcompleted\trate\t")
+	var sizes []int
+	for size := range bySize {
+		sizes = append(sizes, size)
+	}
+	sort.Ints(sizes)
+	for _, size := range sizes {
+		s := bySize[size]
+		fmt.Fprintf(tw, "%d-%d\t%d\t%d\t%s\t\n", size, size+4, s.plays, s.completed, s.rate())
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+
+	var keys []mapKey
+	for key := range bySeed {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if bySeed[keys[i]].plays != bySeed[keys[j]].plays {
+			return bySeed[keys[i]].plays > bySeed[keys[j]].plays
+		}
+		return keys[i].seed < keys[j].seed
+	})
+	if len(keys) > seedNum {
+		keys = keys[:seedNum]
+	}
+
+	fmt.Fprintf(w, "COMPLETION BY SEED (top %d by plays)\n", len(keys))
+	tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "seed\trule\tareas\tchromatic\tadjacency\tplays\tcompleted\trate\t")
+	for _, key := range keys {
+		s := bySeed[key]
+		m := maps[key]
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%d\t%.1f\t%d\t%d\t%s\t\n",
+			key.seed, seedRules[key], len(m.triangles), m.chromaticNum,
+			float64(m.adjacentsNum)/float64(len(m.triangles)),
+			s.plays, s.completed, s.rate())
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+}
+
+func reportTimeToComplete(w io.Writer, plays []*analytics.Play) {
+	ticksByRule := make(map[string][]uint64)
+	for _, p := range plays {
+		if p.Completed && !p.Marathon {
+			ticksByRule[p.Rule()] = append(ticksByRule[p.Rule()], p.CompleteTicks())
+		}
+	}
+
+	fmt.Fprintln(w, "TIME TO COMPLETE")
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "rule\tn\tp10\tp25\tp50\tp75\tp90\t")
+	for _, rule := range sortedKeys(ticksByRule) {
+		ticks := ticksByRule[rule]
+		sort.Slice(ticks, func(i, j int) bool { return ticks[i] < ticks[j] })
+		fmt.Fprintf(tw, "%s\t%d", rule, len(ticks))
+		for _, p := range []float64{10, 25, 50, 75, 90} {
+			fmt.Fprintf(tw, "\t%s", formatTicks(percentile(ticks, p)))
+		}
+		fmt.Fprintln(tw, "\t")
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+
+	// Histogram of all rules in 30 seconds
+	const bucketTicks = 30 * ticksPerSecond
+	var all []uint64
+	for _, ticks := range ticksByRule {
+		all = append(all, ticks...)
+	}
+	printHistogram(w, all, bucketTicks, func(i int) string {
+		return fmt.Sprintf("%s-%s", formatTicks(uint64(i)*bucketTicks), formatTicks(uint64(i+1)*bucketTicks))
+	})
+}
+
+// Print the histogram of the values in buckets of the size
+func printHistogram(w io.Writer, values []uint64, size uint64, label func(i int) string) {
+	var counts []int
+	max := 0
+	for _, v := range values {
+		i := int(v / size)
+		for len(counts) <= i {
+			counts = append(counts, 0)
+		}
+		counts[i]++
+		if counts[i] > max {
+			max = counts[i]
+		}
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for i, n := range counts {
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", label(i), n, strings.Repeat("#", int(math.Ceil(float64(n)/float64(max)*40))))
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+}
+
+// Report where plays which never reached the game over were left, excluding zen which has no end
+func reportAbandonment(w io.Writer, plays []*analytics.Play) {
+	var progress, ticks []uint64
+	for _, p := range plays {
+		if p.Completed || p.Zen {
+			continue
+		}
+		ticks = append(ticks, p.LastTicks)
+		if !p.Marathon && p.CanGenerateMap() {
+			m := getMap(p)
+			colored := 0
+			for _, c := range p.GetColors(0, len(m.triangles)) {
+				if c >= 0 {
+					colored++
+				}
+			}
+			progress = append(progress, uint64(colored*100/len(m.triangles)))
+		}
+	}
+
+	fmt.Fprintf(w, "ABANDONMENT POINTS (%d plays)\n", len(ticks))
+	fmt.Fprintln(w, "by colored areas:")
+	printHistogram(w, progress, 10, func(i int) string {
+		return fmt.Sprintf("%d-%d%%", i*10, i*10+9)
+	})
+
+	const bucketTicks = 30 * ticksPerSecond
+	fmt.Fprintln(w, "by time:")
+	printHistogram(w, ticks, bucketTicks, func(i int) string {
+		return fmt.Sprintf("%s-%s", formatTicks(uint64(i)*bucketTicks), formatTicks(uint64(i+1)*bucketTicks))
+	})
+}
+
+// Render heatmaps of the areas tapped first onto the maps of the seeds
+func renderFirstTapHeatmaps(dir string, plays []*analytics.Play) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	firstTaps := make(map[mapKey][]puzzle.Point)
+	for _, p := range plays {
+		if p.Marathon || len(p.ColorChanges) == 0 || !p.CanGenerateMap() {
+			continue
+		}
+		m := getMap(p)
+		c := p.ColorChanges[0]
+		if c.Map != 0 || c.Area < 0 || c.Area >= len(m.triangles) {
+			continue
+		}
+		key := mapKey{seed: p.Seed, colors: p.Colors}
+		firstTaps[key] = append(firstTaps[key], *m.triangles[c.Area].Center())
+	}
+
+	for key, points := range firstTaps {
+		m := maps[key]
+		min, max := render.GetBounds(m.triangles, 20)
+		canvas := render.NewCanvas(640, 480, min, max)
+		canvas.Fill(color.RGBA{0x10, 0x10, 0x30, 0xff})
+		canvas.DrawMap(m.triangles, func(i int) color.Color {
+			return color.RGBA{0x20, 0x20, 0x50, 0xff}
+		}, color.White)
+		canvas.DrawHeatmap(points, 20)
+
+		path := filepath.Join(dir, fmt.Sprintf("first-tap-%d-%dcolors.png", key.seed, key.colors))
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		if err := canvas.EncodePNG(f); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func main() {
+	seedNum := flag.Int("seeds", 20, "Number of seeds to report")
+	heatmapDir := flag.String("heatmap", "", "Directory to write heatmaps of first taps (not rendered if empty)")
+	flag.Parse()
+
+	var records []analytics.Record
+	if flag.NArg() == 0 {
+		r, err := analytics.ReadRecords(os.Stdin)
+		if err != nil {
+			log.Fatal(err)
+		}
+		records = r
+	}
+	for _, path := range flag.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		r, err := analytics.ReadRecords(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("%s: %v", path, err)
+		}
+		records = append(records, r...)
+	}
+
+	plays, err := analytics.GroupPlays(records)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	players := make(map[string]bool)
+	for _, p := range plays {
+		players[p.PlayerID] = true
+	}
+
+	w := os.Stdout
+	fmt.Fprintf(w, "%d records, %d plays by %d players\n\n", len(records), len(plays), len(players))
+
+	reportCompletion(w, plays, *seedNum)
+	reportTimeToComplete(w, plays)
+	reportAbandonment(w, plays)
+
+	if *heatmapDir != "" {
+		if err := renderFirstTapHeatmaps(*heatmapDir, plays); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+// Command export-map renders a map to SVG or PNG by the extension of the output,
+// colored as in the proof sent in the game_over log, or uncolored from the seed.
+//
+//	export-map (-proof proof.txt | -seed 123 [-colors 4]) [-captions time,seed,date] [-o map.svg]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image/color"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tsujio/game-four-color-theorem/puzzle"
+	"github.com/tsujio/game-four-color-theorem/render"
+)
+
+func main() {
+	proofPath := flag.String("proof", "", "File of the proof to color the map as played")
+	seed := flag.Int64("seed", 0, "Seed of the map, if the proof is not given")
+	colorNum := flag.Int("colors", 4, "Number of colors of the map, if the proof is not given")
+	captions := flag.String("captions", "", "Comma separated captions to show from time, seed and date")
+	date := flag.String("date", time.Now().Format("2006-01-02"), "Date in the caption")
+	output := flag.String("o", "map.svg", "Output file, which is SVG or PNG by the extension")
+	width := flag.Int("width", 960, "Width of the image")
+	height := flag.Int("height", 720, "Height of the image")
+	flag.Parse()
+
+	var triangles []puzzle.Triangle
+	var colors []int
+	var ticks int
+	if *proofPath != "" {
+		data, err := os.ReadFile(*proofPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		proof, err := puzzle.DecodeProof(strings.TrimSpace(string(data)))
+		if err != nil {
+			log.Fatal(err)
+		}
+		triangles, colors = proof.GetLastMap()
+		*seed = proof.Seed
+		if len(proof.Events) > 0 {
+			ticks = proof.Events[len(proof.Events)-1].Ticks
+		}
+	} else {
+		triangles = puzzle.GenerateMap(rand.New(rand.NewSource(*seed)), *colorNum, puzzle.MaxTriangleNum)
+	}
+
+	scene := &render.Scene{
+		Width:     *width,
+		Height:    *height,
+		Triangles: triangles,
+		Stars:     render.GenerateStars(rand.New(rand.NewSource(*seed))),
+	}
+	for _, c := range colors {
+		if c >= 0 && c < len(render.DefaultPalette) {
+			scene.Colors = append(scene.Colors, render.DefaultPalette[c])
+		} else {
+			scene.Colors = append(scene.Colors, color.NRGBA{})
+		}
+	}
+	for _, caption := range strings.Split(*captions, ",") {
+		switch caption {
+		case "time":
+			secs := ticks / 60
+			scene.Captions = append(scene.Captions, fmt.Sprintf("TIME %d:%02d", secs/60, secs%60))
+		case "seed":
+			scene.Captions = append(scene.Captions, fmt.Sprintf("SEED %d", *seed))
+		case "date":
+			scene.Captions = append(scene.Captions, *date)
+		case "":
+		default:
+			log.Fatalf("unknown caption %q", caption)
+		}
+	}
+
+	f, err := os.Create(*output)
+	if err != nil {
+		log.Fatal(err)
+	}
+	switch strings.ToLower(filepath.Ext(*output)) {
+	case ".png":
+		err = scene.WritePNG(f)
+	default:
+		err = scene.WriteSVG(f)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
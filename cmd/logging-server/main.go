@@ -0,0 +1,264 @@
+// Command logging-server is a local stand-in of the game logging server for development.
+// It implements the endpoints which the client talks to, and stores logs as JSON lines
+// and scores as a JSON file in the data directory.
+//
+//	logging-server [-addr :8080] [-data logging-server-data] [-secret secret]
+//
+// Run the game with GAME_TELEMETRY=server:http://localhost:8080 to send to it.
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	logging "github.com/tsujio/game-logging-server/client"
+)
+
+type server struct {
+	dataDir string
+	secret  string
+	mu      sync.Mutex
+}
+
+// LogEntry is a line of the log file
+type LogEntry struct {
+	Timestamp time.Time       `json:"timestamp"`
+	GameName  string          `json:"game_name"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+func (s *server) logPath() string {
+	return filepath.Join(s.dataDir, "logs.jsonl")
+}
+
+func (s *server) scorePath() string {
+	return filepath.Join(s.dataDir, "scores.json")
+}
+
+// Read the body verifying the signature if the secret is set
+func (s *server) readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+
+	if s.secret != "" {
+		h := hmac.New(sha256.New, []byte(s.secret))
+		h.Write(body)
+		expected := "Bearer " + hex.EncodeToString(h.Sum(nil))
+		if !hmac.Equal([]byte(r.Header.Get("Authorization")), []byte(expected)) {
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return nil, false
+		}
+	}
+
+	return body, true
+}
+
+func (s *server) handleLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, ok := s.readBody(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		GameName string          `json:"game_name"`
+		Payload  json.RawMessage `json:"payload"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil || req.GameName == "" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	// Compact the payload to keep an entry in a line
+	var payload bytes.Buffer
+	if err := json.Compact(&payload, req.Payload); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	data, err := json.Marshal(&LogEntry{
+		Timestamp: time.Now(),
+		GameName:  req.GameName,
+		Payload:   payload.Bytes(),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.logPath(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{})
+}
+
+// Load the scores, which must be called with the lock
+func (s *server) loadScores() ([]logging.GameScore, error) {
+	data, err := os.ReadFile(s.scorePath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var scores []logging.GameScore
+	if err := json.Unmarshal(data, &scores); err != nil {
+		return nil, err
+	}
+	return scores, nil
+}
+
+func (s *server) handleScore(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		s.registerScore(w, r)
+	case http.MethodGet:
+		s.getScoreList(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *server) registerScore(w http.ResponseWriter, r *http.Request) {
+	body, ok := s.readBody(w, r)
+	if !ok {
+		return
+	}
+
+	var score logging.GameScore
+	if err := json.Unmarshal(body, &score); err != nil || score.GameName == "" || score.PlayerID == "" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	score.Timestamp = time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	scores, err := s.loadScores()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	scores = append(scores, score)
+
+	data, err := json.MarshalIndent(scores, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := os.WriteFile(s.scorePath(), data, 0644); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{})
+}
+
+// Get the scores of the game in the order of registration, since
+// whether higher is better depends on the ranking
+func (s *server) getScoreList(w http.ResponseWriter, r *http.Request) {
+	gameName := r.URL.Query().Get("game_name")
+
+	s.mu.Lock()
+	scores, err := s.loadScores()
+	s.mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result := []logging.GameScore{}
+	for _, score := range scores {
+		if score.GameName == gameName {
+			result = append(result, score)
+		}
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"scores": result,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println(err)
+	}
+}
+
+// Allow the wasm build served from another origin
+func withCORS(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		if r.Method == http.MethodOptions {
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func withAccessLog(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Println(r.Method, r.URL.Path, strings.TrimPrefix(r.URL.RawQuery, "?"))
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/log", s.handleLog)
+	mux.HandleFunc("/score", s.handleScore)
+	return withAccessLog(withCORS(mux))
+}
+
+func main() {
+	addr := flag.String("addr", ":8080", "Address to listen")
+	dataDir := flag.String("data", "logging-server-data", "Directory to store logs and scores")
+	secret := flag.String("secret", "", "Secret to verify signatures of requests (not verified if empty)")
+	flag.Parse()
+
+	if err := os.MkdirAll(*dataDir, 0755); err != nil {
+		log.Fatal(err)
+	}
+
+	s := &server{
+		dataDir: *dataDir,
+		secret:  *secret,
+	}
+
+	log.Printf("Listening on %s, storing data in %s", *addr, *dataDir)
+	log.Fatal(http.ListenAndServe(*addr, s.handler()))
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/tsujio/game-four-color-theorem/analytics"
+	"github.com/tsujio/game-four-color-theorem/loggingserver"
+	"github.com/tsujio/game-four-color-theorem/puzzle"
+	logging "github.com/tsujio/game-logging-server/client"
+)
+
+// Start the server and point the client at it as the server sink of the game does
+func startServer(t *testing.T, secret string) *server {
+	s := &server{dataDir: t.TempDir(), secret: secret}
+	ts := httptest.NewServer(s.handler())
+	t.Cleanup(ts.Close)
+
+	prev := http.DefaultClient.Transport
+	t.Cleanup(func() { http.DefaultClient.Transport = prev })
+	u, _ := url.Parse(ts.URL)
+	loggingserver.Redirect(u)
+
+	logging.Enable(secret)
+	t.Cleanup(logging.Disable)
+	return s
+}
+
+func TestLogRoundTrip(t *testing.T) {
+	s := startServer(t, "secret")
+
+	sent := []analytics.Record{
+		{Time: 1, PlayerID: "player", PlayID: "play", Action: "start_game", Event: json.RawMessage(`{"colors":4,"seed":1}`)},
+		{Time: 2, PlayerID: "player", PlayID: "play", Action: "game_over", Event: json.RawMessage(`{"score":100}`)},
+	}
+	if err := logging.Log(puzzle.GameName, map[string]interface{}{"records": sent}); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(s.logPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records, err := analytics.ReadRecords(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != len(sent) {
+		t.Fatalf("%d records read, %d sent", len(records), len(sent))
+	}
+	for i, r := range records {
+		if r.Time != sent[i].Time || r.PlayID != sent[i].PlayID || r.Action != sent[i].Action || string(r.Event) != string(sent[i].Event) {
+			t.Fatalf("record %d is %+v, sent %+v", i, r, sent[i])
+		}
+	}
+}
+
+func TestScoreRoundTrip(t *testing.T) {
+	startServer(t, "secret")
+
+	ranking := puzzle.GetRankingName(4, false, false, "")
+	if err := logging.RegisterScore(ranking, "player", "play", 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := logging.RegisterScore(puzzle.GetRankingName(3, false, false, ""), "player", "other", 200); err != nil {
+		t.Fatal(err)
+	}
+
+	scores, err := logging.GetScoreList(ranking)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scores) != 1 || scores[0].PlayID != "play" || scores[0].Score != 100 || scores[0].Timestamp.IsZero() {
+		t.Fatalf("unexpected scores %v", scores)
+	}
+}
+
+func TestServerRejectsInvalidSignatures(t *testing.T) {
+	startServer(t, "secret")
+
+	logging.Enable("other")
+	if err := logging.Log(puzzle.GameName, map[string]interface{}{}); err == nil {
+		t.Fatal("log with an invalid signature accepted")
+	}
+	if err := logging.RegisterScore(puzzle.GameName, "player", "play", 100); err == nil {
+		t.Fatal("score with an invalid signature accepted")
+	}
+}
@@ -0,0 +1,107 @@
+// Command puzzle-code makes a puzzle code to share, whose givens are areas colored
+// from the start given as area:color pairs, or prints the puzzle of a code.
+//
+//	puzzle-code -seed 123 [-colors 4] [-mode normal] [-givens 0:1,5:2]
+//	puzzle-code -decode <code>
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/tsujio/game-four-color-theorem/puzzle"
+)
+
+var modeNames = []string{"normal", "min-colors", "marathon", "zen", "duel"}
+
+func parseMode(s string) (puzzle.Mode, error) {
+	for i, name := range modeNames {
+		if name == s {
+			return puzzle.Mode(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown mode %q", s)
+}
+
+func parseGivens(s string) ([]puzzle.Given, error) {
+	var givens []puzzle.Given
+	for _, pair := range strings.Split(s, ",") {
+		if pair == "" {
+			continue
+		}
+		area, clr, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid given %q", pair)
+		}
+		a, err := strconv.Atoi(area)
+		if err != nil {
+			return nil, err
+		}
+		c, err := strconv.Atoi(clr)
+		if err != nil {
+			return nil, err
+		}
+		givens = append(givens, puzzle.Given{Area: a, Color: c})
+	}
+	return givens, nil
+}
+
+func main() {
+	decode := flag.String("decode", "", "Code to print")
+	seed := flag.Int64("seed", 0, "Seed of the map")
+	colors := flag.Int("colors", 4, "Number of colors")
+	mode := flag.String("mode", "normal", "Mode of the puzzle, which is one of "+strings.Join(modeNames, ", "))
+	givens := flag.String("givens", "", "Areas colored from the start, like 0:1,5:2")
+	flag.Parse()
+
+	if *decode != "" {
+		code, err := puzzle.DecodePuzzleCode(*decode)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("generator version: %d\n", code.GeneratorVersion)
+		fmt.Printf("seed: %d\n", code.Seed)
+		fmt.Printf("mode: %s\n", modeNames[code.Mode])
+		fmt.Printf("colors: %d\n", code.ColorNum)
+		for _, g := range code.Givens {
+			fmt.Printf("given: area %d color %d\n", g.Area, g.Color)
+		}
+		return
+	}
+
+	if *seed == 0 {
+		log.Fatal("-seed is required")
+	}
+
+	code := &puzzle.PuzzleCode{
+		GeneratorVersion: puzzle.GeneratorVersion,
+		Seed:             *seed,
+		ColorNum:         *colors,
+	}
+	var err error
+	if code.Mode, err = parseMode(*mode); err != nil {
+		log.Fatal(err)
+	}
+	if code.Givens, err = parseGivens(*givens); err != nil {
+		log.Fatal(err)
+	}
+	if err := code.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Check the givens on the first map, which the game would drop
+	triangles := puzzle.GenerateMap(rand.New(rand.NewSource(code.Seed)), code.ColorNum, puzzle.GetMaxTriangleNum(code.Mode == puzzle.ModeMarathon, 0))
+	mapColors := make([]int, len(triangles))
+	for i := range mapColors {
+		mapColors[i] = -1
+	}
+	if err := puzzle.ApplyGivens(puzzle.GetTriangleAdjacents(triangles), mapColors, code.Givens); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println(code.Encode())
+}
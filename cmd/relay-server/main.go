@@ -0,0 +1,26 @@
+// Command relay-server is the reference server of the relay, with which players of the
+// versus race exchange their progress over WebSocket.
+//
+//	relay-server [-addr :8081]
+//
+// Run the game with GAME_RELAY=ws://localhost:8081/relay to connect to it.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/tsujio/game-four-color-theorem/relay"
+)
+
+func main() {
+	addr := flag.String("addr", ":8081", "Address to listen")
+	flag.Parse()
+
+	mux := http.NewServeMux()
+	mux.Handle("/relay", relay.NewServer())
+
+	log.Printf("Listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
@@ -0,0 +1,179 @@
+// Command touch-heatmap renders the touches of a play, or of all plays of a seed,
+// over the map regenerated from the seed. Trajectories are colored by time from
+// blue to red and taps are drawn as dots. It runs headless with no GPU.
+//
+//	touch-heatmap (-play id | -seed 123 [-colors 4]) [-map 0] [-density] [-o touches.png] logs.jsonl...
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image/color"
+	"log"
+	"os"
+
+	"github.com/tsujio/game-four-color-theorem/analytics"
+	"github.com/tsujio/game-four-color-theorem/puzzle"
+	"github.com/tsujio/game-four-color-theorem/render"
+)
+
+// Get the ticks of the touches from the start of the play, since the ticks
+// in the logs are reset when the mode changes
+func getElapsedTicks(touches []analytics.Touch) []uint64 {
+	var elapsed []uint64
+	var last, total uint64
+	for i, t := range touches {
+		if i > 0 {
+			if t.Ticks >= last {
+				total += t.Ticks - last
+			} else {
+				total += t.Ticks
+			}
+		}
+		last = t.Ticks
+		elapsed = append(elapsed, total)
+	}
+	return elapsed
+}
+
+// Draw the trajectories of the touches on the map, colored by the time in the play
+func drawTouches(canvas *render.Canvas, touches []analytics.Touch, mapNum int, density bool) {
+	elapsed := getElapsedTicks(touches)
+	end := float64(1)
+	if len(elapsed) > 0 && elapsed[len(elapsed)-1] > 0 {
+		end = float64(elapsed[len(elapsed)-1])
+	}
+
+	var taps []puzzle.Point
+	var prev *puzzle.Point
+	for i := range touches {
+		t := &touches[i]
+		if t.Map != mapNum {
+			prev = nil
+			continue
+		}
+
+		p := t.World()
+		clr := render.HeatColor(float64(elapsed[i]) / end)
+		if t.JustTouched {
+			taps = append(taps, *p)
+			if !density {
+				canvas.FillCircle(p, 5, clr)
+			}
+		} else if prev != nil {
+			canvas.DrawLine(prev, p, 2, clr)
+		}
+
+		prev = p
+		if t.JustReleased {
+			prev = nil
+		}
+	}
+
+	if density {
+		canvas.DrawHeatmap(taps, 15)
+	}
+}
+
+// Draw the legend of the colors by time at the bottom
+func drawLegend(canvas *render.Canvas) {
+	img := canvas.Image()
+	b := img.Bounds()
+	x0, x1 := b.Dx()/4, b.Dx()*3/4
+	for x := x0; x < x1; x++ {
+		clr := render.HeatColor(float64(x-x0) / float64(x1-x0))
+		for y := b.Dy() - 16; y < b.Dy()-10; y++ {
+			img.SetRGBA(x, y, clr)
+		}
+	}
+}
+
+func main() {
+	playID := flag.String("play", "", "ID of the play to render")
+	seed := flag.Int64("seed", 0, "Seed of the plays to render, if the play is not given")
+	colors := flag.Int("colors", 4, "Number of colors of the plays to render by the seed")
+	mapNum := flag.Int("map", 0, "Map to render in the marathon")
+	density := flag.Bool("density", false, "Render the density of taps instead of trajectories")
+	output := flag.String("o", "touches.png", "Output PNG file")
+	width := flag.Int("width", 960, "Width of the image")
+	height := flag.Int("height", 720, "Height of the image")
+	flag.Parse()
+
+	if *playID == "" && *seed == 0 {
+		log.Fatal("either -play or -seed is required")
+	}
+
+	var records []analytics.Record
+	for _, path := range flag.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		r, err := analytics.ReadRecords(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("%s: %v", path, err)
+		}
+		records = append(records, r...)
+	}
+	if flag.NArg() == 0 {
+		r, err := analytics.ReadRecords(os.Stdin)
+		if err != nil {
+			log.Fatal(err)
+		}
+		records = r
+	}
+
+	plays, err := analytics.GroupPlays(records)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Plays of other generator versions, such as in the legacy logs, were on other maps
+	var targets []*analytics.Play
+	skipped := 0
+	for _, p := range plays {
+		if *playID != "" && p.PlayID == *playID ||
+			*playID == "" && p.Seed == *seed && p.Colors == *colors && !p.Marathon {
+			if !p.CanGenerateMap() {
+				skipped++
+				continue
+			}
+			targets = append(targets, p)
+		}
+	}
+	if skipped > 0 {
+		log.Printf("skipped %d plays whose maps cannot be regenerated", skipped)
+	}
+	if len(targets) == 0 {
+		log.Fatal("no plays found")
+	}
+
+	triangles := targets[0].GenerateMap(*mapNum)
+	min, max := render.GetBounds(triangles, 40)
+	canvas := render.NewCanvas(*width, *height, min, max)
+	canvas.Fill(color.RGBA{0x10, 0x10, 0x30, 0xff})
+	canvas.DrawMap(triangles, func(i int) color.Color {
+		return color.RGBA{0x20, 0x20, 0x50, 0xff}
+	}, color.RGBA{0xc0, 0xc0, 0xc0, 0xff})
+
+	touchNum := 0
+	for _, p := range targets {
+		drawTouches(canvas, p.Touches, *mapNum, *density)
+		touchNum += len(p.Touches)
+	}
+	drawLegend(canvas)
+
+	f, err := os.Create(*output)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := canvas.EncodePNG(f); err != nil {
+		log.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("Rendered %d touches of %d plays to %s\n", touchNum, len(targets), *output)
+}
@@ -0,0 +1,74 @@
+// Command verify-score verifies a score submitted with its proof,
+// which is sent in the game_over log, by replaying it headlessly.
+//
+//	verify-score -score 3600 -ranking four-color-theorem-3colors [-daily 2006-01-02] < proof.txt
+//	verify-score -code < proof.txt
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/tsujio/game-four-color-theorem/puzzle"
+)
+
+func main() {
+	score := flag.Int("score", -1, "Submitted score to be verified (skipped if negative)")
+	daily := flag.String("daily", "", "Date of the daily challenge the proof is submitted for")
+	ranking := flag.String("ranking", "", "Name of the ranking the score is submitted to, which the rule of the proof must be of")
+	code := flag.Bool("code", false, "Verify the game of a puzzle code with its givens, which is not ranked")
+	flag.Parse()
+
+	if *code == (*ranking != "") {
+		log.Fatal("either -ranking or -code is required")
+	}
+
+	var s string
+	if flag.NArg() > 0 {
+		s = flag.Arg(0)
+	} else {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			log.Fatal(err)
+		}
+		s = string(data)
+	}
+
+	proof, err := puzzle.DecodeProof(strings.TrimSpace(s))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *daily != "" && proof.Seed != puzzle.GetDailySeed(*daily) {
+		fmt.Println("REJECTED: seed is not of the daily challenge")
+		os.Exit(1)
+	}
+
+	if *ranking != "" {
+		if name := puzzle.GetRankingName(proof.ColorNum, proof.MinimizeColors, proof.Marathon, *daily); name != *ranking {
+			fmt.Printf("REJECTED: proof is of ranking %s\n", name)
+			os.Exit(1)
+		}
+	}
+
+	verify := puzzle.Verify
+	if *code {
+		verify = puzzle.VerifyCode
+	}
+	result, err := verify(proof)
+	if err != nil {
+		fmt.Printf("REJECTED: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *score >= 0 && *score != result.Score {
+		fmt.Printf("REJECTED: submitted score %d does not match verified score %d\n", *score, result.Score)
+		os.Exit(1)
+	}
+
+	fmt.Printf("OK: score=%d ticks=%d maps=%d\n", result.Score, result.Ticks, result.CompletedMapNum)
+}
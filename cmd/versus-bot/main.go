@@ -0,0 +1,284 @@
+// Command versus-bot is a headless player of the versus race, with which races are tested
+// locally without browsers. It joins the room, hosts a race if nobody is there, and colors
+// an area of the map at the rate, reporting its progress like the game.
+//
+//	versus-bot [-relay ws://localhost:8081/relay] [-room test] [-name BOT] [-rate 2] [-wait 0s] [-linger 10s] [-coop]
+//
+// Run two of them on the same room, delaying one of them, to see a race with a late joiner.
+// With -coop, they color the same board and print it at the end, which must be the same.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/tsujio/game-four-color-theorem/puzzle"
+	"github.com/tsujio/game-four-color-theorem/relay"
+)
+
+// write is the latest operation on an area of the co-op board
+type write struct {
+	color  int
+	tick   int64
+	player string
+}
+
+type bot struct {
+	client   *relay.Client
+	race     *puzzle.PuzzleCode
+	raceSeq  int64
+	joined   bool
+	progress map[string]relay.ProgressData
+	coop     bool
+	writes   map[int]write
+	clock    int64
+}
+
+// Apply the operation if it is the last writer by the logical clock, or the larger player ID on a tie
+func (b *bot) apply(player string, o relay.OpData) {
+	if o.Tick > b.clock {
+		b.clock = o.Tick
+	}
+	if w, ok := b.writes[o.Area]; ok && (o.Tick < w.tick || o.Tick == w.tick && player <= w.player) {
+		return
+	}
+	b.writes[o.Area] = write{color: o.Color, tick: o.Tick, player: player}
+}
+
+func (b *bot) handle(m *relay.Message) {
+	switch m.Type {
+	case relay.TypeWelcome:
+		var w relay.Welcome
+		if err := json.Unmarshal(m.Data, &w); err != nil {
+			log.Println(err)
+			return
+		}
+		log.Printf("joined with %d players", len(w.Players))
+		// Nobody is in the room, so nobody has started a race
+		if !b.joined && len(w.Players) == 1 && b.race == nil {
+			code := &puzzle.PuzzleCode{
+				GeneratorVersion: puzzle.GeneratorVersion,
+				Seed:             time.Now().Unix(),
+				Mode:             puzzle.ModeNormal,
+				ColorNum:         4,
+			}
+			msg, _ := relay.NewMessage(relay.TypeRace, relay.TypeRace, relay.RaceData{Code: code.Encode()})
+			b.client.Send(msg)
+			b.race = code
+			log.Printf("hosting race %s", code.Encode())
+		}
+		b.joined = true
+	case relay.TypeJoin:
+		log.Printf("%s joined", m.Name)
+	case relay.TypeLeave:
+		log.Printf("%s left", m.Name)
+	case relay.TypeRace:
+		if m.From == b.client.Player().ID {
+			return
+		}
+		var r relay.RaceData
+		if err := json.Unmarshal(m.Data, &r); err != nil {
+			log.Println(err)
+			return
+		}
+		code, err := puzzle.DecodePuzzleCode(r.Code)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		if b.race == nil || m.Seq < b.raceSeq {
+			b.race, b.raceSeq = code, m.Seq
+			log.Printf("racing on %s", r.Code)
+		}
+	case relay.TypeProgress:
+		if m.From == b.client.Player().ID {
+			return
+		}
+		var p relay.ProgressData
+		if err := json.Unmarshal(m.Data, &p); err != nil {
+			log.Println(err)
+			return
+		}
+		if old, ok := b.progress[m.From]; !ok || old != p {
+			b.progress[m.From] = p
+			if p.Finished {
+				secs := p.Ticks / 60
+				log.Printf("%s finished in %d:%02d", m.Name, secs/60, secs%60)
+			} else {
+				log.Printf("%s %d%%", m.Name, int(math.Floor(p.Progress*100)))
+			}
+		}
+	case relay.TypeOp:
+		var o relay.OpData
+		if err := json.Unmarshal(m.Data, &o); err != nil {
+			log.Println(err)
+			return
+		}
+		b.apply(m.From, o)
+	}
+}
+
+func (b *bot) poll() {
+	for _, m := range b.client.Poll() {
+		b.handle(&m)
+	}
+}
+
+func (b *bot) sendProgress(p relay.ProgressData) {
+	msg, _ := relay.NewMessage(relay.TypeProgress, relay.TypeProgress, p)
+	b.client.Send(msg)
+}
+
+// Color the area on the co-op board, pointing the cursor at it like the game
+func (b *bot) sendOp(triangles []puzzle.Triangle, area, color int) {
+	b.clock++
+	o := relay.OpData{Area: area, Color: color, Tick: b.clock}
+	b.apply(b.client.Player().ID, o)
+	msg, _ := relay.NewMessage(relay.TypeOp, fmt.Sprintf("%s:%d", relay.TypeOp, area), o)
+	b.client.Send(msg)
+
+	c := triangles[area].Center()
+	msg, _ = relay.NewMessage(relay.TypeCursor, relay.TypeCursor, relay.CursorData{X: c.X, Y: c.Y})
+	b.client.Send(msg)
+}
+
+// Color the areas of the co-op board left uncolored by anyone, in a random order so that
+// the players sometimes color the same area. Colors are off the solution at times, which
+// the others may overwrite.
+func (b *bot) playCoop(rate float64) {
+	code := b.race
+	triangles := puzzle.GenerateMap(rand.New(rand.NewSource(code.Seed)), code.ColorNum, puzzle.GetMaxTriangleNum(false, 0))
+	solution := puzzle.FindColoring(puzzle.GetTriangleAdjacents(triangles), code.ColorNum)
+
+	interval := time.Duration(float64(time.Second) / rate)
+	for _, i := range rand.Perm(len(triangles)) {
+		time.Sleep(interval)
+		b.poll()
+		if _, ok := b.writes[i]; ok {
+			continue
+		}
+		color := solution[i]
+		if rand.Intn(4) == 0 {
+			color = rand.Intn(code.ColorNum)
+		}
+		b.sendOp(triangles, i, color)
+	}
+}
+
+func (b *bot) printBoard() {
+	board := make([]byte, len(b.writes))
+	for i := range board {
+		board[i] = '.'
+		if w, ok := b.writes[i]; ok && w.color >= 0 {
+			board[i] = byte('0' + w.color)
+		}
+	}
+	log.Printf("board %s", board)
+}
+
+// Color the areas one by one with a coloring found by the solver. Givens are kept,
+// which the coloring may conflict with.
+func (b *bot) play(rate float64) {
+	code := b.race
+	triangles := puzzle.GenerateMap(rand.New(rand.NewSource(code.Seed)), code.ColorNum, puzzle.GetMaxTriangleNum(false, 0))
+	adjacents := puzzle.GetTriangleAdjacents(triangles)
+	solution := puzzle.FindColoring(adjacents, code.ColorNum)
+
+	colors := make([]int, len(triangles))
+	for i := range colors {
+		colors[i] = -1
+	}
+	if err := puzzle.ApplyGivens(adjacents, colors, code.Givens); err != nil {
+		log.Println(err)
+	}
+
+	start := time.Now()
+	interval := time.Duration(float64(time.Second) / rate)
+	for i := range colors {
+		if colors[i] != -1 {
+			continue
+		}
+		time.Sleep(interval)
+		b.poll()
+
+		colors[i] = solution[i]
+		ticks := int(time.Since(start).Seconds() * 60)
+		b.sendProgress(relay.ProgressData{Progress: getProgress(adjacents, colors), Ticks: ticks})
+	}
+
+	ticks := int(time.Since(start).Seconds() * 60)
+	b.sendProgress(relay.ProgressData{Progress: getProgress(adjacents, colors), Ticks: ticks, Finished: puzzle.IsCompleted(adjacents, colors)})
+	secs := ticks / 60
+	log.Printf("finished in %d:%02d", secs/60, secs%60)
+}
+
+func getProgress(adjacents [][]int, colors []int) float64 {
+	ok := 0
+	for i, c := range colors {
+		if c == -1 {
+			continue
+		}
+		conflict := false
+		for _, j := range adjacents[i] {
+			if colors[j] == c {
+				conflict = true
+				break
+			}
+		}
+		if !conflict {
+			ok++
+		}
+	}
+	return float64(ok) / float64(len(colors))
+}
+
+func main() {
+	url := flag.String("relay", "ws://localhost:8081/relay", "URL of the relay server")
+	room := flag.String("room", "test", "Room to join")
+	name := flag.String("name", "BOT", "Name of the player")
+	rate := flag.Float64("rate", 2, "Areas colored per second")
+	wait := flag.Duration("wait", 0, "Time to wait before joining, to join late")
+	linger := flag.Duration("linger", 10*time.Second, "Time to stay in the room after finishing")
+	coop := flag.Bool("coop", false, "Color the same board with the others")
+	flag.Parse()
+
+	time.Sleep(*wait)
+
+	// Co-op rooms are apart from the race rooms of the same name, like the game
+	relayRoom := *room
+	if *coop {
+		relayRoom = "coop:" + *room
+	}
+	player := relay.Player{ID: fmt.Sprintf("%s-%d", *name, time.Now().UnixNano()), Name: *name}
+	b := &bot{
+		client:   relay.NewClient(*url, relayRoom, player, relay.DialConn),
+		progress: make(map[string]relay.ProgressData),
+		coop:     *coop,
+		writes:   make(map[int]write),
+	}
+	defer b.client.Close()
+
+	for b.race == nil {
+		time.Sleep(100 * time.Millisecond)
+		b.poll()
+	}
+
+	if b.coop {
+		b.playCoop(*rate)
+	} else {
+		b.play(*rate)
+	}
+
+	for end := time.Now().Add(*linger); time.Now().Before(end); {
+		time.Sleep(100 * time.Millisecond)
+		b.poll()
+	}
+	if b.coop {
+		b.printBoard()
+	}
+}
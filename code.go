@@ -0,0 +1,207 @@
+package main
+
+import (
+	"image/color"
+	"log"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/tsujio/game-four-color-theorem/puzzle"
+)
+
+const (
+	codeInputMaxLength = 256
+	// Characters shown in the field, which shows the tail of longer input
+	codeInputVisibleLength = 36
+)
+
+func getCodeRule(code *puzzle.PuzzleCode) GameRule {
+	rule := GameRule{colorNum: code.ColorNum}
+	switch code.Mode {
+	case puzzle.ModeMinimizeColors:
+		rule.minimizeColors = true
+	case puzzle.ModeMarathon:
+		rule.marathon = true
+	case puzzle.ModeZen:
+		rule.zen = true
+	case puzzle.ModeDuel:
+		rule.duel = true
+	}
+	return rule
+}
+
+func getRuleMode(rule *GameRule) puzzle.Mode {
+	switch {
+	case rule.duel:
+		return puzzle.ModeDuel
+	case rule.zen:
+		return puzzle.ModeZen
+	case rule.marathon:
+		return puzzle.ModeMarathon
+	case rule.minimizeColors:
+		return puzzle.ModeMinimizeColors
+	default:
+		return puzzle.ModeNormal
+	}
+}
+
+func isCodeChar(r rune) bool {
+	return 'A' <= r && r <= 'Z' || 'a' <= r && r <= 'z' || '0' <= r && r <= '9' || r == '-' || r == '_'
+}
+
+// Color the givens of the first map, and get the ones applied. Givens which are out of
+// the map or conflict with others are dropped.
+func (g *Game) applyGivens(givens []puzzle.Given) []puzzle.Given {
+	var triangles []Triangle
+	colors := make([]int, len(g.areas))
+	for i, a := range g.areas {
+		triangles = append(triangles, a.Triangle)
+		colors[i] = -1
+	}
+	adjacents := puzzle.GetTriangleAdjacents(triangles)
+
+	var applied []puzzle.Given
+	for _, given := range givens {
+		if err := puzzle.ApplyGivens(adjacents, colors, []puzzle.Given{given}); err != nil {
+			log.Println(err)
+			continue
+		}
+		a := &g.areas[given.Area]
+		a.color = given.Color
+		a.given = true
+		applied = append(applied, given)
+	}
+	return applied
+}
+
+func (g *Game) playCodeInput() {
+	code, err := puzzle.DecodePuzzleCode(strings.TrimSpace(g.codeInput))
+	if err != nil {
+		log.Println(err)
+		g.codeError = msg("invalid_code")
+		return
+	}
+	g.codeError = ""
+	g.startCode(code, settings.InputStyle)
+}
+
+func (g *Game) getCodeFieldRect() (x, y, w, h float64) {
+	return 80, 180, 480, 32
+}
+
+func (g *Game) getCodeButtonRect() (x, y, w, h float64) {
+	return 170, 6, 140, 22
+}
+
+func (g *Game) getCodePlayButtonRect() (x, y, w, h float64) {
+	return screenWidth/2 - 80, 280, 160, 28
+}
+
+// Edit the text with the keyboard, and get whether it is submitted by the enter key
+func updateTextInput(input TouchInput, s *string) bool {
+	for _, r := range input.AppendInputChars(nil) {
+		if isCodeChar(r) && len(*s) < codeInputMaxLength {
+			*s += string(r)
+		}
+	}
+	if input.IsKeyJustPressed(ebiten.KeyBackspace) && len(*s) > 0 {
+		*s = (*s)[:len(*s)-1]
+	}
+	return input.IsKeyJustPressed(ebiten.KeyEnter) || input.IsKeyJustPressed(ebiten.KeyNumpadEnter)
+}
+
+// Get whether the text field is just touched, and ask the platform for the text then
+// since software keyboards are not available in the game
+func (g *Game) isTextFieldTouched(p *Point, label string, s *string) bool {
+	x, y, w, h := g.getCodeFieldRect()
+	if p.X < x || x+w < p.X || p.Y < y || y+h < p.Y {
+		return false
+	}
+	if text, ok := promptText(label, *s); ok {
+		*s = strings.TrimSpace(text)
+	}
+	return true
+}
+
+func (g *Game) drawTextField(screen *ebiten.Image, s string, editing bool) {
+	x, y, w, h := g.getCodeFieldRect()
+	uiCamera := g.getUICamera()
+	p := uiCamera.toScreen(&Point{X: x, Y: y})
+	ebitenutil.DrawRect(screen, p.X, p.Y, w*uiCamera.scale, h*uiCamera.scale, color.RGBA{0xff, 0xff, 0xff, 0x30})
+	if len(s) > codeInputVisibleLength {
+		s = s[len(s)-codeInputVisibleLength:]
+	}
+	if editing && g.ticksFromModeStart%60 < 30 {
+		s += "_"
+	}
+	g.drawUIText(screen, s, fontS, x+10, y+h/2+fontS.FaceOptions.Size/2, TextAlignLeft, color.White)
+}
+
+// Draw the button in the design coordinates of the UI
+func (g *Game) drawUIButton(screen *ebiten.Image, label string, x, y, w, h float64) {
+	uiCamera := g.getUICamera()
+	p := uiCamera.toScreen(&Point{X: x, Y: y})
+	ebitenutil.DrawRect(screen, p.X, p.Y, w*uiCamera.scale, h*uiCamera.scale, color.RGBA{0xff, 0xff, 0xff, 0x30})
+	g.drawUIText(screen, label, fontS, x+w/2, y+h/2+fontS.FaceOptions.Size/2, TextAlignCenter, color.White)
+}
+
+func (g *Game) updateCodeEntry() {
+	if updateTextInput(g.touchContext, &g.codeInput) {
+		g.playCodeInput()
+		return
+	}
+	if g.touchContext.IsKeyJustPressed(ebiten.KeyEscape) {
+		g.setNextMode(GameModeTitle)
+		return
+	}
+
+	if !g.touchContext.IsJustTouched() {
+		return
+	}
+
+	pos := g.touchContext.GetTouchPosition()
+	p := g.getUICamera().toWorld(&Point{X: float64(pos.X), Y: float64(pos.Y)})
+
+	if g.isTextFieldTouched(p, msg("code"), &g.codeInput) {
+		return
+	}
+	if x, y, w, h := g.getCodePlayButtonRect(); x <= p.X && p.X <= x+w && y <= p.Y && p.Y <= y+h {
+		g.playCodeInput()
+		return
+	}
+	if x, y, w, h := g.getSettingsBackButtonRect(); x <= p.X && p.X <= x+w && y <= p.Y && p.Y <= y+h {
+		g.setNextMode(GameModeTitle)
+	}
+}
+
+func (g *Game) drawCodeEntry(screen *ebiten.Image) {
+	ebitenutil.DrawRect(screen, 0, 0, g.width, g.height, color.RGBA{0, 0, 0, 0x80})
+
+	g.drawUIText(screen, msg("code"), fontM, screenWidth/2, 60, TextAlignCenter, color.White)
+	g.drawUIText(screen, msg("code_usage"), fontS, screenWidth/2, 140, TextAlignCenter, color.White)
+
+	g.drawTextField(screen, g.codeInput, true)
+
+	if g.codeError != "" {
+		_, y, _, h := g.getCodeFieldRect()
+		g.drawUIText(screen, g.codeError, fontS, screenWidth/2, y+h+30, TextAlignCenter, color.RGBA{0xff, 0x80, 0x80, 0xff})
+	}
+
+	x, y, w, h := g.getCodePlayButtonRect()
+	g.drawUIButton(screen, msg("play"), x, y, w, h)
+
+	x, y, w, h = g.getSettingsBackButtonRect()
+	g.drawUIButton(screen, msg("back"), x, y, w, h)
+}
+
+// Mark the given areas, which cannot be changed
+func (g *Game) drawGivens(screen *ebiten.Image) {
+	for _, a := range g.areas {
+		if !a.given {
+			continue
+		}
+		c := g.camera.toScreen(a.Triangle.Center())
+		ebitenutil.DrawCircle(screen, c.X, c.Y, 3*g.uiScale, color.RGBA{0xff, 0xff, 0xff, 0xc0})
+	}
+}
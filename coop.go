@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/tsujio/game-four-color-theorem/relay"
+)
+
+const (
+	// Ticks between cursor updates sent to the others
+	coopCursorInterval = 6
+)
+
+var coopCursorColors = []color.Color{
+	color.RGBA{0xff, 0x80, 0x80, 0xff},
+	color.RGBA{0x80, 0xff, 0x80, 0xff},
+	color.RGBA{0x80, 0xc0, 0xff, 0xff},
+	color.RGBA{0xff, 0xe0, 0x60, 0xff},
+	color.RGBA{0xe0, 0x80, 0xff, 0xff},
+}
+
+// coopWrite is an operation on an area of the co-op board, which is ordered by the tick and the player
+type coopWrite struct {
+	color  int
+	tick   int64
+	player string
+}
+
+func (w *coopWrite) after(o *coopWrite) bool {
+	return w.tick > o.tick || w.tick == o.tick && w.player > o.player
+}
+
+// Send the color of the area changed by the player, which wins over every operation seen so far
+func (g *Game) sendCoopOp(a *Area) {
+	v := g.versus
+	v.clock++
+	v.writes[a.id] = coopWrite{color: a.color, tick: v.clock, player: v.client.Player().ID}
+	v.send(relay.TypeOp, fmt.Sprintf("%s:%d", relay.TypeOp, a.id), relay.OpData{Area: a.id, Color: a.color, Tick: v.clock})
+}
+
+// Resolve the operation of a player, which includes the own ones sent before reconnecting
+func (g *Game) handleCoopOp(from string, o *relay.OpData) {
+	v := g.versus
+	if !v.coop {
+		return
+	}
+	if o.Tick > v.clock {
+		v.clock = o.Tick
+	}
+
+	w := coopWrite{color: o.Color, tick: o.Tick, player: from}
+	if current, ok := v.writes[o.Area]; ok && !w.after(&current) {
+		return
+	}
+	v.writes[o.Area] = w
+
+	if g.mode == GameModeOpening || g.mode == GameModePlaying {
+		g.applyCoopOp(o.Area, o.Color)
+	}
+}
+
+// Color the area by another player, which is recorded so that replays show the same board
+func (g *Game) applyCoopOp(id, color int) {
+	a, ok := g.getAreaByID(id)
+	if !ok || a.given || color < -1 || color >= g.rule.colorNum || a.color == color {
+		return
+	}
+	a.color = color
+
+	g.recordEvent(ReplayEvent{Op: &ReplayOp{Area: id, Color: color}})
+
+	cr, cg, cb, _ := a.getColorScales()
+	e := TriangleEffect{
+		Triangle: a.Triangle,
+		colorR:   cr,
+		colorG:   cg,
+		colorB:   cb,
+	}
+	g.triangleEffects = append(g.triangleEffects, e)
+
+	if a.color >= 0 {
+		g.playAreaNote(a)
+	}
+}
+
+// Apply the board colored before the start, such as by the players who have been playing
+func (g *Game) applyCoopWrites() {
+	for id, w := range g.versus.writes {
+		g.applyCoopOp(id, w.color)
+	}
+}
+
+func (g *Game) updateCoopCursor() {
+	if g.ticksFromModeStart%coopCursorInterval != 0 {
+		return
+	}
+
+	pos := g.touchContext.GetCursorPosition()
+	if g.touchContext.IsBeingTouched() {
+		pos = g.touchContext.GetTouchPosition()
+	}
+	p := g.camera.toWorld(&Point{X: float64(pos.X), Y: float64(pos.Y)})
+
+	v := g.versus
+	c := relay.CursorData{X: p.X, Y: p.Y}
+	if v.lastCursor != nil && math.Abs(v.lastCursor.X-c.X) < 1 && math.Abs(v.lastCursor.Y-c.Y) < 1 {
+		return
+	}
+	v.lastCursor = &c
+	v.send(relay.TypeCursor, relay.TypeCursor, c)
+}
+
+// Draw the cursors of the other players in the co-op game
+func (g *Game) drawCoopCursors(screen *ebiten.Image) {
+	v := g.versus
+	if v == nil || !v.coop {
+		return
+	}
+	for i, id := range v.order {
+		o := v.opponents[id]
+		if !o.online || o.cursor == nil {
+			continue
+		}
+		clr := coopCursorColors[i%len(coopCursorColors)]
+		p := g.camera.toScreen(o.cursor)
+		ebitenutil.DrawCircle(screen, p.X, p.Y, 4*g.uiScale, clr)
+		g.drawText(screen, o.name, fontS, p.X+8*g.uiScale, p.Y-6*g.uiScale, TextAlignLeft, clr)
+	}
+}
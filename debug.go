@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+)
+
+// Draw the health of the telemetry for debugging
+func (g *Game) drawDebugOverlay(screen *ebiten.Image) {
+	lines := []string{fmt.Sprintf("TPS: %.1f  FPS: %.1f", ebiten.ActualTPS(), ebiten.ActualFPS())}
+
+	if q, ok := g.telemetry.(*TelemetryQueue); ok {
+		s := q.Stats()
+		lines = append(lines,
+			fmt.Sprintf("Telemetry queued: %d  dropped: %d", s.Queued, s.Dropped),
+			fmt.Sprintf("Sent batches: %d  failures: %d", s.SentBatches, s.Failures),
+		)
+		if s.Backoff > 0 {
+			lines = append(lines, fmt.Sprintf("Retry in %s: %s", s.Backoff, s.LastError))
+		}
+	} else {
+		lines = append(lines, fmt.Sprintf("Telemetry: %T", g.telemetry))
+	}
+
+	text := strings.Join(lines, "\n")
+	y := g.height - float64(len(lines)*16) - 100*g.uiScale
+	ebitenutil.DrawRect(screen, 0, y, 360, float64(len(lines)*16), color.RGBA{0, 0, 0, 0x80})
+	ebitenutil.DebugPrintAt(screen, text, 4, int(y))
+}
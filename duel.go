@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math/rand"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/tsujio/game-four-color-theorem/puzzle"
+)
+
+const (
+	// Ticks the computer player waits before its move, so that the move can be seen
+	duelCPUThinkTicks = 40
+	// Nodes the search of the computer player runs per tick, which fit in a frame
+	duelSearchNodesPerTick = 1000
+)
+
+// Levels of the opponent in the settings, whose 0 is a human
+var duelOpponentLevels = []int{
+	0,
+	puzzle.DuelLevelRandom,
+	puzzle.DuelLevelGreedy,
+	puzzle.DuelLevelSearch,
+	puzzle.DuelLevelSearch + 1,
+	puzzle.DuelLevelSearch + 2,
+}
+
+var duelPlayerColors = []color.Color{
+	color.RGBA{0x80, 0xd0, 0xff, 0xff},
+	color.RGBA{0xff, 0xb0, 0x60, 0xff},
+}
+
+// Duel is the state of the duel on a device, in which P1 plays against P2 or the computer
+type Duel struct {
+	adjacents [][]int
+	turn      int
+	// Level of the computer player as P2, which is 0 when P2 is a human
+	cpuLevel  int
+	turnTicks int
+	// Search of the move of the computer player in its turn, which runs a little every tick
+	search *puzzle.DuelSearch
+	// Player who won, which is -1 while playing
+	winner int
+	random *rand.Rand
+}
+
+func (g *Game) startDuel() {
+	indices := make(map[*Area]int)
+	for i := range g.areas {
+		indices[&g.areas[i]] = i
+	}
+	adjacents := make([][]int, len(g.areas))
+	for i, a := range g.areas {
+		for _, ad := range a.adjacents {
+			adjacents[i] = append(adjacents[i], indices[ad])
+		}
+	}
+
+	opponent := settings.DuelOpponent
+	if g.replayPlayer != nil {
+		opponent = g.replayPlayer.replay.DuelOpponent
+	}
+	if g.recording != nil {
+		g.recording.DuelOpponent = opponent
+	}
+
+	g.duel = &Duel{
+		adjacents: adjacents,
+		cpuLevel:  duelOpponentLevels[clampInt(opponent, 0, len(duelOpponentLevels)-1)],
+		winner:    -1,
+		// The computer plays the same moves in replays
+		random: rand.New(rand.NewSource(g.seed)),
+	}
+}
+
+func (g *Game) getDuelState() *puzzle.DuelState {
+	colors := make([]int, len(g.areas))
+	for i, a := range g.areas {
+		colors[i] = a.color
+	}
+	return puzzle.NewDuelState(g.duel.adjacents, colors, g.rule.colorNum)
+}
+
+func (d *Duel) isCPUTurn() bool {
+	return d.turn == 1 && d.cpuLevel > 0
+}
+
+func (d *Duel) getPlayerName(player int) string {
+	if player == 0 {
+		return "P1"
+	}
+	if d.cpuLevel > 0 {
+		return "CPU"
+	}
+	return "P2"
+}
+
+// Play the tapped area with the picked color, if it is a legal move of the human player
+func (g *Game) playDuelMove(index int) {
+	d := g.duel
+	if d.isCPUTurn() || d.winner >= 0 {
+		return
+	}
+	m := puzzle.DuelMove{Area: index, Color: g.selectedColor}
+	if !g.getDuelState().IsLegal(m) {
+		return
+	}
+	g.colorArea(m.Area, m.Color)
+	g.endDuelTurn()
+}
+
+// Pass the turn, and the player who just moved wins if the next one cannot move
+func (g *Game) endDuelTurn() {
+	d := g.duel
+	if !g.getDuelState().HasLegalMove() {
+		d.winner = d.turn
+		return
+	}
+	d.turn = 1 - d.turn
+	d.turnTicks = 0
+
+	d.search = nil
+	if d.isCPUTurn() && d.cpuLevel >= puzzle.DuelLevelSearch {
+		d.search = puzzle.NewDuelSearch(g.getDuelState(), d.cpuLevel, d.random)
+	}
+}
+
+func (g *Game) updateDuel() {
+	d := g.duel
+	if d.winner >= 0 {
+		return
+	}
+
+	d.turnTicks++
+	if !d.isCPUTurn() {
+		return
+	}
+
+	// The search is stepped by ticks, not by time, so that replays make the same moves
+	if d.search != nil {
+		if !d.search.Step(duelSearchNodesPerTick) || d.turnTicks < duelCPUThinkTicks {
+			return
+		}
+		if m, ok := d.search.Best(); ok {
+			g.colorArea(m.Area, m.Color)
+		}
+		g.endDuelTurn()
+		return
+	}
+
+	if d.turnTicks < duelCPUThinkTicks {
+		return
+	}
+	if m, ok := puzzle.FindDuelMove(g.getDuelState(), d.cpuLevel, d.random); ok {
+		g.colorArea(m.Area, m.Color)
+	}
+	g.endDuelTurn()
+}
+
+func (g *Game) drawDuelTurn(screen *ebiten.Image) {
+	d := g.duel
+	if d == nil {
+		return
+	}
+	s := fmt.Sprintf(msg("turn"), d.getPlayerName(d.turn))
+	g.drawText(screen, s, fontS, g.width/2, 20*g.uiScale, TextAlignCenter, duelPlayerColors[d.turn])
+}
+
+func (g *Game) drawDuelResult(screen *ebiten.Image) {
+	d := g.duel
+	if d == nil || d.winner < 0 {
+		return
+	}
+	s := fmt.Sprintf(msg("wins"), d.getPlayerName(d.winner))
+	g.drawText(screen, s, fontS, g.width/2, g.height-80*g.uiScale, TextAlignCenter, duelPlayerColors[d.winner])
+
+	s = fmt.Sprintf(msg("no_move"), d.getPlayerName(1-d.winner))
+	g.drawText(screen, s, fontS, g.width/2, g.height-60*g.uiScale, TextAlignCenter, color.White)
+}
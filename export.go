@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+	"log"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/tsujio/game-four-color-theorem/render"
+)
+
+const (
+	exportWidth  = 960
+	exportHeight = 720
+)
+
+// Formats which the map can be exported to on the game over screen
+var exportFormats = []string{"PNG", "SVG"}
+
+func (g *Game) createExportScene() *render.Scene {
+	scene := &render.Scene{
+		Width:  exportWidth,
+		Height: exportHeight,
+	}
+
+	p := getPalette()
+	for _, a := range g.areas {
+		scene.Triangles = append(scene.Triangles, a.Triangle)
+		clr := color.NRGBA{}
+		if a.color >= 0 && a.color < paletteSize {
+			c := p.colors[a.color]
+			clr = color.NRGBA{uint8(c[0] * 0xff), uint8(c[1] * 0xff), uint8(c[2] * 0xff), uint8(p.alpha * 0xff)}
+		}
+		scene.Colors = append(scene.Colors, clr)
+	}
+
+	for _, s := range g.stars {
+		scene.Stars = append(scene.Stars, render.Star{X: s.X / screenWidth, Y: s.Y / screenHeight, R: s.r})
+	}
+
+	if settings.ExportCaptions {
+		if !g.rule.zen {
+			secs := g.getPlayingTicks() / 60
+			scene.Captions = append(scene.Captions, fmt.Sprintf("TIME %d:%02d", secs/60, secs%60))
+		}
+		scene.Captions = append(scene.Captions,
+			fmt.Sprintf("CODE %s", g.code.Encode()),
+			g.now().Format(dailyDateFormat),
+		)
+	}
+
+	return scene
+}
+
+// Export the map, which is saved as a file or downloaded on browsers
+func (g *Game) exportMap(format string) {
+	scene := g.createExportScene()
+
+	var buf bytes.Buffer
+	var err error
+	var name, mime string
+	switch format {
+	case "SVG":
+		err = scene.WriteSVG(&buf)
+		name, mime = fmt.Sprintf("%s-%d.svg", gameName, g.seed), "image/svg+xml"
+	default:
+		err = scene.WritePNG(&buf)
+		name, mime = fmt.Sprintf("%s-%d.png", gameName, g.seed), "image/png"
+	}
+	if err == nil {
+		err = saveExportFile(name, mime, buf.Bytes())
+	}
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	g.exportNotice = fmt.Sprintf("%s %s", format, msg("saved"))
+}
+
+func (g *Game) getExportButtonRect(index int) (x, y, w, h float64) {
+	w, h = 60*g.uiScale, 24*g.uiScale
+	x = g.width - float64(len(exportFormats)-index)*(w+10*g.uiScale)
+	y = g.height - 34*g.uiScale
+	return
+}
+
+// Get the export button being just touched
+func (g *Game) getTouchedExportButton() (int, bool) {
+	if !g.touchContext.IsJustTouched() {
+		return 0, false
+	}
+	pos := g.touchContext.GetTouchPosition()
+	px, py := float64(pos.X), float64(pos.Y)
+	for i := range exportFormats {
+		x, y, w, h := g.getExportButtonRect(i)
+		if x <= px && px <= x+w && y <= py && py <= y+h {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func (g *Game) drawExportButtons(screen *ebiten.Image) {
+	for i, format := range exportFormats {
+		x, y, w, h := g.getExportButtonRect(i)
+		ebitenutil.DrawRect(screen, x, y, w, h, color.RGBA{0xff, 0xff, 0xff, 0x30})
+		g.drawText(screen, format, fontS, x+w/2, y+h/2+fontS.FaceOptions.Size*g.uiScale/2, TextAlignCenter, color.White)
+	}
+
+	if g.exportNotice != "" {
+		_, y, _, _ := g.getExportButtonRect(0)
+		g.drawText(screen, g.exportNotice, fontS, g.width-10*g.uiScale, y-10*g.uiScale, TextAlignRight, color.White)
+	}
+}
@@ -0,0 +1,32 @@
+//go:build !js
+
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// Save the exported file in the pictures directory, or the home directory without it
+func saveExportFile(name, mime string, data []byte) error {
+	dir, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	if pictures := filepath.Join(dir, "Pictures"); isDir(pictures) {
+		dir = pictures
+	}
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	log.Printf("Exported to %s", path)
+	return nil
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
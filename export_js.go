@@ -0,0 +1,35 @@
+//go:build js
+
+package main
+
+import (
+	"syscall/js"
+)
+
+// Let the browser download the exported file
+func saveExportFile(name, mime string, data []byte) error {
+	array := js.Global().Get("Uint8Array").New(len(data))
+	js.CopyBytesToJS(array, data)
+	blob := js.Global().Get("Blob").New([]interface{}{array}, map[string]interface{}{"type": mime})
+
+	url := js.Global().Get("URL").Call("createObjectURL", blob)
+
+	document := js.Global().Get("document")
+	a := document.Call("createElement", "a")
+	a.Set("href", url)
+	a.Set("download", name)
+	document.Get("body").Call("appendChild", a)
+	a.Call("click")
+	document.Get("body").Call("removeChild", a)
+
+	// Release the blob after the download starts
+	var revoke js.Func
+	revoke = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		js.Global().Get("URL").Call("revokeObjectURL", url)
+		revoke.Release()
+		return nil
+	})
+	js.Global().Call("setTimeout", revoke, 1000)
+
+	return nil
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/tsujio/game-util/touchutil"
+)
+
+const (
+	// Distance in design pixels a touch can move and still be a tap
+	tapMoveThreshold = 10
+)
+
+// TouchInput is what the game reads from touches, the keyboard and the mouse,
+// which is implemented by ebitenInput, the replay player and ScriptedInput
+type TouchInput interface {
+	Update()
+	IsJustTouched() bool
+	IsJustReleased() bool
+	IsBeingTouched() bool
+	GetTouchPosition() touchutil.TouchPosition
+	// Positions of all the fingers, for pinches of the camera
+	AppendTouchPositions(positions []touchutil.TouchPosition) []touchutil.TouchPosition
+	GetCursorPosition() touchutil.TouchPosition
+	IsMouseButtonPressed(button ebiten.MouseButton) bool
+	// Vertical scroll of the wheel in this tick
+	GetWheel() float64
+	AppendInputChars(runes []rune) []rune
+	IsKeyJustPressed(key ebiten.Key) bool
+}
+
+// ebitenInput is the input of the player
+type ebitenInput struct {
+	*touchutil.TouchContext
+	touchIDs []ebiten.TouchID
+}
+
+func newEbitenInput() *ebitenInput {
+	return &ebitenInput{TouchContext: touchutil.CreateTouchContext()}
+}
+
+func (i *ebitenInput) AppendTouchPositions(positions []touchutil.TouchPosition) []touchutil.TouchPosition {
+	i.touchIDs = ebiten.AppendTouchIDs(i.touchIDs[:0])
+	for _, id := range i.touchIDs {
+		x, y := ebiten.TouchPosition(id)
+		positions = append(positions, touchutil.TouchPosition{X: x, Y: y})
+	}
+	return positions
+}
+
+func (i *ebitenInput) GetCursorPosition() touchutil.TouchPosition {
+	x, y := ebiten.CursorPosition()
+	return touchutil.TouchPosition{X: x, Y: y}
+}
+
+func (i *ebitenInput) IsMouseButtonPressed(button ebiten.MouseButton) bool {
+	return ebiten.IsMouseButtonPressed(button)
+}
+
+func (i *ebitenInput) GetWheel() float64 {
+	_, dy := ebiten.Wheel()
+	return dy
+}
+
+func (i *ebitenInput) AppendInputChars(runes []rune) []rune {
+	return ebiten.AppendInputChars(runes)
+}
+
+func (i *ebitenInput) IsKeyJustPressed(key ebiten.Key) bool {
+	return inpututil.IsKeyJustPressed(key)
+}
+
+// Track the touch on the map, which is a tap when released without moving or starting
+// a gesture of the camera, so that the first finger of a pinch does not color an area
+func (g *Game) updateTap() {
+	g.tap = nil
+
+	// Touches from the other modes, such as the one starting the game, are not taps
+	if g.touchContext.IsJustTouched() && g.mode == GameModePlaying {
+		pos := g.touchContext.GetTouchPosition()
+		g.tapStart = &pos
+	}
+	if g.tapStart == nil {
+		return
+	}
+
+	pos := g.touchContext.GetTouchPosition()
+	if g.touchContext.IsBeingTouched() || g.touchContext.IsJustReleased() {
+		dx, dy := float64(pos.X-g.tapStart.X), float64(pos.Y-g.tapStart.Y)
+		if math.Hypot(dx, dy) > tapMoveThreshold*g.uiScale || g.cameraController.IsGesturing() {
+			g.tapStart = nil
+			return
+		}
+	}
+
+	if g.touchContext.IsJustReleased() {
+		g.tap = g.tapStart
+		g.tapStart = nil
+		g.recordEvent(ReplayEvent{Tap: g.tap})
+	}
+}
+
+// ScriptedInput touches, types and moves the mouse where it is told, for headless runs.
+// A tap is seen by the game on the next tick, and released on the tick after.
+// Typed text, keys and scrolls are seen on the next tick, while the cursor,
+// mouse buttons and fingers stay until they are changed.
+type ScriptedInput struct {
+	pending      *touchutil.TouchPosition
+	justTouched  bool
+	justReleased bool
+	position     touchutil.TouchPosition
+
+	pendingChars []rune
+	pendingKeys  []ebiten.Key
+	pendingWheel float64
+	chars        []rune
+	keys         []ebiten.Key
+	wheel        float64
+
+	cursor       touchutil.TouchPosition
+	mouseButtons []ebiten.MouseButton
+	touches      []touchutil.TouchPosition
+}
+
+func (i *ScriptedInput) tap(x, y int) {
+	i.pending = &touchutil.TouchPosition{X: x, Y: y}
+}
+
+func (i *ScriptedInput) typeText(s string) {
+	i.pendingChars = append(i.pendingChars, []rune(s)...)
+}
+
+func (i *ScriptedInput) pressKey(key ebiten.Key) {
+	i.pendingKeys = append(i.pendingKeys, key)
+}
+
+func (i *ScriptedInput) scroll(dy float64) {
+	i.pendingWheel += dy
+}
+
+func (i *ScriptedInput) moveCursor(x, y int) {
+	i.cursor = touchutil.TouchPosition{X: x, Y: y}
+}
+
+func (i *ScriptedInput) setMouseButtons(buttons ...ebiten.MouseButton) {
+	i.mouseButtons = buttons
+}
+
+func (i *ScriptedInput) setTouches(positions ...touchutil.TouchPosition) {
+	i.touches = positions
+}
+
+func (i *ScriptedInput) Update() {
+	i.justReleased = i.justTouched
+	i.justTouched = i.pending != nil
+	if i.pending != nil {
+		i.position = *i.pending
+		i.pending = nil
+	}
+
+	i.chars, i.pendingChars = i.pendingChars, nil
+	i.keys, i.pendingKeys = i.pendingKeys, nil
+	i.wheel, i.pendingWheel = i.pendingWheel, 0
+}
+
+func (i *ScriptedInput) IsJustTouched() bool {
+	return i.justTouched
+}
+
+func (i *ScriptedInput) IsJustReleased() bool {
+	return i.justReleased
+}
+
+func (i *ScriptedInput) IsBeingTouched() bool {
+	return i.justTouched
+}
+
+func (i *ScriptedInput) GetTouchPosition() touchutil.TouchPosition {
+	return i.position
+}
+
+func (i *ScriptedInput) AppendTouchPositions(positions []touchutil.TouchPosition) []touchutil.TouchPosition {
+	return append(positions, i.touches...)
+}
+
+func (i *ScriptedInput) GetCursorPosition() touchutil.TouchPosition {
+	return i.cursor
+}
+
+func (i *ScriptedInput) IsMouseButtonPressed(button ebiten.MouseButton) bool {
+	for _, b := range i.mouseButtons {
+		if b == button {
+			return true
+		}
+	}
+	return false
+}
+
+func (i *ScriptedInput) GetWheel() float64 {
+	return i.wheel
+}
+
+func (i *ScriptedInput) AppendInputChars(runes []rune) []rune {
+	return append(runes, i.chars...)
+}
+
+func (i *ScriptedInput) IsKeyJustPressed(key ebiten.Key) bool {
+	for _, k := range i.keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,18 @@
+//go:build !js
+
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// Get the launch parameter given by the environment, like GAME_CODE for code
+func getLaunchParam(name string) string {
+	return os.Getenv("GAME_" + strings.ToUpper(name))
+}
+
+// Texts are typed with the keyboard on desktops
+func promptText(label, current string) (string, bool) {
+	return "", false
+}
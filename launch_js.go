@@ -0,0 +1,26 @@
+//go:build js
+
+package main
+
+import (
+	"syscall/js"
+)
+
+// Get the launch parameter given by the query of the page, like game.html?code=...
+func getLaunchParam(name string) string {
+	search := js.Global().Get("location").Get("search")
+	v := js.Global().Get("URLSearchParams").New(search).Call("get", name)
+	if v.IsNull() || v.IsUndefined() {
+		return ""
+	}
+	return v.String()
+}
+
+// Ask the text with the dialog of the browser, which brings up the software keyboard on mobiles
+func promptText(label, current string) (string, bool) {
+	v := js.Global().Call("prompt", label, current)
+	if v.IsNull() || v.IsUndefined() {
+		return "", false
+	}
+	return v.String(), true
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"image/color"
+	"math"
+	"unicode/utf8"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text"
+	"github.com/tsujio/game-util/resourceutil"
+)
+
+type TextAlign int
+
+const (
+	TextAlignLeft TextAlign = iota
+	TextAlignCenter
+	TextAlignRight
+)
+
+// Layout uses the real outside size multiplied by the device scale factor
+// so that the game is rendered sharply on any display
+func (g *Game) Layout(outsideWidth, outsideHeight int) (int, int) {
+	// Replays are rendered at the recorded size since the input depends on it
+	if g.replayPlayer != nil {
+		return int(g.width), int(g.height)
+	}
+
+	s := ebiten.DeviceScaleFactor()
+	w := int(math.Ceil(float64(outsideWidth) * s))
+	h := int(math.Ceil(float64(outsideHeight) * s))
+	if float64(w) != g.width || float64(h) != g.height {
+		g.resize(float64(w), float64(h))
+	}
+	return w, h
+}
+
+func (g *Game) resize(width, height float64) {
+	g.width, g.height = width, height
+
+	// UI is designed for screenWidth x screenHeight and scaled to fit the screen
+	g.uiScale = math.Min(width/screenWidth, height/screenHeight)
+
+	g.fitCamera()
+
+	g.recordEvent(ReplayEvent{Size: &ReplaySize{Width: width, Height: height}})
+}
+
+// Region of the screen where the map is shown, which leaves space for the surface
+func (g *Game) getMapViewport() (x, y, w, h float64) {
+	return 0, 0, g.width, g.height - mapBottomMargin*g.uiScale
+}
+
+// Bounding box of the map in world coordinates
+func (g *Game) getMapBounds() (minP, maxP Point) {
+	if len(g.areas) == 0 {
+		return Point{X: 0, Y: 0}, Point{X: mapWidth, Y: mapHeight - mapBottomMargin}
+	}
+
+	minP = Point{X: math.Inf(1), Y: math.Inf(1)}
+	maxP = Point{X: math.Inf(-1), Y: math.Inf(-1)}
+	for _, a := range g.areas {
+		for _, p := range a.Triangle {
+			minP.X, minP.Y = math.Min(minP.X, p.X), math.Min(minP.Y, p.Y)
+			maxP.X, maxP.Y = math.Max(maxP.X, p.X), math.Max(maxP.Y, p.Y)
+		}
+	}
+	return
+}
+
+// Fit the camera so that the whole map is shown in the map viewport
+func (g *Game) fitCamera() {
+	minP, maxP := g.getMapBounds()
+	x, y, w, h := g.getMapViewport()
+
+	g.camera.viewCenter = Point{X: x + w/2, Y: y + h/2}
+	g.camera.center = *minP.Add(&maxP).Div(2)
+	g.camera.scale = math.Min(w/math.Max(maxP.X-minP.X, 1), h/math.Max(maxP.Y-minP.Y, 1))
+	g.camera.scale = math.Min(math.Max(g.camera.scale, cameraMinScale), cameraMaxScale)
+	g.cameraTarget = g.camera.center
+}
+
+// Camera which maps the screenWidth x screenHeight design space of the UI
+// onto the center of the screen
+func (g *Game) getUICamera() *Camera {
+	return &Camera{
+		center:     Point{X: screenWidth / 2, Y: screenHeight / 2},
+		scale:      g.uiScale,
+		viewCenter: Point{X: g.width / 2, Y: g.height / 2},
+	}
+}
+
+func (g *Game) getTextWidth(s string, font *resourceutil.Font) float64 {
+	return float64(utf8.RuneCountInString(s)) * font.FaceOptions.Size * g.uiScale
+}
+
+// Draw text with its baseline at y in screen coordinates, scaled by g.uiScale
+func (g *Game) drawText(screen *ebiten.Image, s string, font *resourceutil.Font, x, y float64, align TextAlign, clr color.Color) {
+	switch align {
+	case TextAlignCenter:
+		x -= g.getTextWidth(s, font) / 2
+	case TextAlignRight:
+		x -= g.getTextWidth(s, font)
+	}
+
+	opts := &ebiten.DrawImageOptions{}
+	opts.GeoM.Scale(g.uiScale, g.uiScale)
+	opts.GeoM.Translate(x, y)
+	opts.ColorM.ScaleWithColor(clr)
+	text.DrawWithOptions(screen, s, font.Face, opts)
+}
+
+// Draw text at the position in the UI design space
+func (g *Game) drawUIText(screen *ebiten.Image, s string, font *resourceutil.Font, x, y float64, align TextAlign, clr color.Color) {
+	p := g.getUICamera().toScreen(&Point{X: x, Y: y})
+	g.drawText(screen, s, font, p.X, p.Y, align, clr)
+}
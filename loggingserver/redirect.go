@@ -0,0 +1,44 @@
+// Package loggingserver redirects the client of the game logging server to
+// another server, such as the local stand-in of cmd/logging-server.
+package loggingserver
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// Host of the logging server built in the client
+const Host = "game-logging-server.tsujio.org"
+
+// Redirect the requests for the logging server to the url, which must be
+// called before any request is sent.
+//
+// The client sends requests only with http.DefaultClient, which has no option
+// to replace it, so the transport of the default client of the process is
+// wrapped. Requests for the other hosts are passed to the previous transport
+// unchanged.
+func Redirect(u *url.URL) {
+	next := http.DefaultClient.Transport
+	if t, ok := next.(*transport); ok {
+		next = t.next
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	http.DefaultClient.Transport = &transport{url: u, next: next}
+}
+
+type transport struct {
+	url  *url.URL
+	next http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host == Host {
+		req = req.Clone(req.Context())
+		req.URL.Scheme = t.url.Scheme
+		req.URL.Host = t.url.Host
+		req.Host = t.url.Host
+	}
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,47 @@
+package loggingserver
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestRedirect(t *testing.T) {
+	prev := http.DefaultClient.Transport
+	t.Cleanup(func() { http.DefaultClient.Transport = prev })
+
+	newServer := func(name string) *httptest.Server {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, name)
+		}))
+		t.Cleanup(s.Close)
+		return s
+	}
+	logging := newServer("logging")
+	other := newServer("other")
+
+	u, _ := url.Parse(logging.URL)
+	Redirect(u)
+	// Redirecting again replaces the url instead of wrapping the redirect
+	Redirect(u)
+	if next := http.DefaultClient.Transport.(*transport).next; next != http.DefaultTransport {
+		t.Fatalf("redirect wrapped %T", next)
+	}
+
+	for url, expected := range map[string]string{
+		"https://" + Host + "/log": "logging",
+		other.URL + "/log":         "other",
+	} {
+		resp, err := http.DefaultClient.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != expected {
+			t.Fatalf("%s answered by %q, expected %q", url, body, expected)
+		}
+	}
+}
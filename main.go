@@ -11,204 +11,156 @@ import (
 	"math/rand"
 	"os"
 	"sort"
-	"strconv"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/audio"
 	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
-	"github.com/hajimehoshi/ebiten/v2/text"
+	"github.com/tsujio/game-four-color-theorem/puzzle"
 	logging "github.com/tsujio/game-logging-server/client"
 	"github.com/tsujio/game-util/drawutil"
-	"github.com/tsujio/game-util/loggingutil"
 	"github.com/tsujio/game-util/resourceutil"
 	"github.com/tsujio/game-util/touchutil"
 )
 
 const (
-	gameName       = "four-color-theorem"
-	screenWidth    = 640
-	screenHeight   = 480
-	maxTriangleNum = 30
+	gameName      = puzzle.GameName
+	screenWidth   = 640
+	screenHeight  = 480
+	starsParallax = 0.2
+	minimapX      = 10
+	minimapY      = 30
+	minimapWidth  = 120
+	minimapHeight = 90
 )
 
+const (
+	mapWidth        = puzzle.MapWidth
+	mapHeight       = puzzle.MapHeight
+	mapBottomMargin = puzzle.MapBottomMargin
+)
+
+var mapCenter = puzzle.MapCenter
+
 //go:embed resources/*.ttf resources/*.dat resources/bgm-*.wav resources/*.png resources/secret
 var resources embed.FS
 
+var fontL, fontM, fontS = resourceutil.ForceLoadFont(resources, "resources/PressStart2P-Regular.ttf", nil)
+
+// Audio and images are loaded by loadResources, since headless runs have no devices for them
 var (
-	fontL, fontM, fontS = resourceutil.ForceLoadFont(resources, "resources/PressStart2P-Regular.ttf", nil)
-	audioContext        = audio.NewContext(48000)
-	color0AudioData     = resourceutil.ForceLoadDecodedAudio(resources, "resources/color-0.wav.dat", audioContext)
-	color1AudioData     = resourceutil.ForceLoadDecodedAudio(resources, "resources/color-1.wav.dat", audioContext)
-	color2AudioData     = resourceutil.ForceLoadDecodedAudio(resources, "resources/color-2.wav.dat", audioContext)
-	color3AudioData     = resourceutil.ForceLoadDecodedAudio(resources, "resources/color-3.wav.dat", audioContext)
-	gameStartAudioData  = resourceutil.ForceLoadDecodedAudio(resources, "resources/魔王魂 効果音 システム49.mp3.dat", audioContext)
-	playStartAudioData  = resourceutil.ForceLoadDecodedAudio(resources, "resources/魔王魂 効果音 笛01.mp3.dat", audioContext)
-	completeAudioData   = resourceutil.ForceLoadDecodedAudio(resources, "resources/魔王魂 効果音 物音15.mp3.dat", audioContext)
-	bgmPlayer           = resourceutil.ForceCreateBGMPlayer(resources, "resources/bgm-four-color-theorem.wav", audioContext)
-	skyImg              = loadImage("resources/sky.png")
-	surfaceImg          = loadImage("resources/surface.png")
+	audioContext       *audio.Context
+	gameStartAudioData []byte
+	playStartAudioData []byte
+	completeAudioData  []byte
+	bgmPlayer          *audio.Player
+	skyImg             *ebiten.Image
+	surfaceImg         *ebiten.Image
 )
 
-func loadImage(path string) *ebiten.Image {
-	f, err := resources.Open(path)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer f.Close()
-	img, _, err := image.Decode(f)
-	if err != nil {
-		log.Fatal(err)
-	}
-	return ebiten.NewImageFromImage(img)
-}
-
-type Point struct {
-	x, y float64
+func loadResources() {
+	audioContext = audio.NewContext(audioSampleRate)
+	gameStartAudioData = resourceutil.ForceLoadDecodedAudio(resources, "resources/魔王魂 効果音 システム49.mp3.dat", audioContext)
+	playStartAudioData = resourceutil.ForceLoadDecodedAudio(resources, "resources/魔王魂 効果音 笛01.mp3.dat", audioContext)
+	completeAudioData = resourceutil.ForceLoadDecodedAudio(resources, "resources/魔王魂 効果音 物音15.mp3.dat", audioContext)
+	bgmPlayer = resourceutil.ForceCreateBGMPlayer(resources, "resources/bgm-four-color-theorem.wav", audioContext)
+	skyImg = loadImage("resources/sky.png")
+	surfaceImg = loadImage("resources/surface.png")
 }
 
-func (p *Point) norm() float64 {
-	return math.Sqrt(math.Pow(p.x, 2) + math.Pow(p.y, 2))
+type GameRule struct {
+	colorNum       int
+	minimizeColors bool
+	daily          bool
+	marathon       bool
+	zen            bool
+	duel           bool
 }
 
-func (p *Point) add(q *Point) *Point {
-	return &Point{x: p.x + q.x, y: p.y + q.y}
+func (r *GameRule) getLabel() string {
+	if r.duel {
+		return msg("rule_duel")
+	}
+	if r.zen {
+		return msg("rule_zen")
+	}
+	if r.marathon {
+		return msg("rule_marathon")
+	}
+	if r.daily {
+		return msg("rule_daily")
+	}
+	if r.minimizeColors {
+		return msg("rule_min_colors")
+	}
+	return fmt.Sprintf(msg("rule_colors"), r.colorNum)
 }
 
-func (p *Point) sub(q *Point) *Point {
-	return &Point{x: p.x - q.x, y: p.y - q.y}
+// Selectable rules on the title screen
+var gameRules = []GameRule{
+	{colorNum: 4},
+	{colorNum: 3},
+	{colorNum: 2},
+	{colorNum: paletteSize, minimizeColors: true},
+	{colorNum: 4, daily: true},
+	{colorNum: 4, marathon: true},
+	{colorNum: 4, zen: true},
+	{colorNum: 3, duel: true},
 }
 
-func (p *Point) mul(a float64) *Point {
-	return &Point{x: p.x * a, y: p.y * a}
-}
+const (
+	marathonTransitionTicks = 90
+)
 
-func (p *Point) div(a float64) *Point {
-	return &Point{x: p.x / a, y: p.y / a}
-}
+const (
+	zenExtendNum    = 8
+	zenNearNum      = 20
+	zenFrontierStep = 150.0
+	// Tries in a tick to extend the map, each of which moves the frontier
+	zenExtendTries = 4
+)
 
-func (p *Point) innerProd(q *Point) float64 {
-	return p.x*q.x + p.y*q.y
-}
+const (
+	dailyDateFormat          = "2006-01-02"
+	dailyCompletedStorageKey = "daily-completed"
+)
 
-func (p *Point) outerProdZ(q *Point) float64 {
-	return p.x*q.y - p.y*q.x
+func getTimeUntilNextDaily(now time.Time) time.Duration {
+	t := now.UTC()
+	next := time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+	return next.Sub(t)
 }
 
-func (p *Point) rotate(theta float64) *Point {
-	return &Point{x: math.Cos(theta)*p.x - math.Sin(theta)*p.y, y: math.Sin(theta)*p.x + math.Cos(theta)*p.y}
+func (g *Game) isDailyCompleted(date string) bool {
+	v, ok := g.storage.Load(dailyCompletedStorageKey)
+	return ok && v == date
 }
 
-type Line [2]Point
-
-func (l *Line) equals(m *Line) bool {
-	return l[0] == m[0] && l[1] == m[1] || l[0] == m[1] && l[1] == m[0]
+func formatCountdown(d time.Duration) string {
+	secs := int(d.Seconds())
+	return fmt.Sprintf("%02d:%02d:%02d", secs/3600, secs/60%60, secs%60)
 }
 
-func (l *Line) cross(m *Line) bool {
-	z := l[1].sub(&l[0]).outerProdZ(m[1].sub(&m[0]))
-	if math.Abs(z) < 1e-3 {
-		return false
+func loadImage(path string) *ebiten.Image {
+	f, err := resources.Open(path)
+	if err != nil {
+		log.Fatal(err)
 	}
-
-	v := m[0].sub(&l[0])
-	z1 := v.outerProdZ(l[1].sub(&l[0]))
-	z2 := v.outerProdZ(m[1].sub(&m[0]))
-	t1 := z2 / z
-	t2 := z1 / z
-
-	return 0 <= t1 && t1 <= 1 && 0 <= t2 && t2 <= 1
-}
-
-func (l *Line) normSq() float64 {
-	return math.Pow(l[0].x-l[1].x, 2) + math.Pow(l[0].y-l[1].y, 2)
-}
-
-func (l *Line) distanceSq(p *Point) float64 {
-	return math.Pow((l[1].x-l[0].x)*(l[0].y-p.y)-(l[1].y-l[0].y)*(l[0].x-p.x), 2) / l.normSq()
-}
-
-type Triangle [3]Point
-
-func (t *Triangle) equals(s *Triangle) bool {
-	return t[0] == s[0] && t[1] == s[1] && t[2] == s[2] ||
-		t[0] == s[0] && t[1] == s[2] && t[2] == s[1] ||
-		t[0] == s[1] && t[1] == s[0] && t[2] == s[2] ||
-		t[0] == s[1] && t[1] == s[2] && t[2] == s[0] ||
-		t[0] == s[2] && t[1] == s[1] && t[2] == s[0] ||
-		t[0] == s[2] && t[1] == s[0] && t[2] == s[1]
-}
-
-func (t *Triangle) covers(p *Point) bool {
-	v0 := t[0].sub(&t[1])
-	v1 := t[1].sub(&t[2])
-	v2 := t[2].sub(&t[0])
-
-	vp0 := p.sub(&t[0])
-	vp1 := p.sub(&t[1])
-	vp2 := p.sub(&t[2])
-
-	z0 := v0.outerProdZ(vp0)
-	z1 := v1.outerProdZ(vp1)
-	z2 := v2.outerProdZ(vp2)
-
-	return z0 > 0 && z1 > 0 && z2 > 0 || z0 < 0 && z1 < 0 && z2 < 0
-}
-
-func (t *Triangle) contains(l *Line) bool {
-	return (l[0] == t[0] || l[0] == t[1] || l[0] == t[2]) &&
-		(l[1] == t[0] || l[1] == t[1] || l[1] == t[2])
-}
-
-func (t *Triangle) shareLineWith(s *Triangle) bool {
-	for i := 0; i < 3; i++ {
-		l := Line([2]Point{s[i%3], s[(i+1)%3]})
-		if t.contains(&l) {
-			return true
-		}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		log.Fatal(err)
 	}
-	return false
+	return ebiten.NewImageFromImage(img)
 }
 
-func (t *Triangle) collidesWith(s *Triangle) bool {
-	ts := []*Triangle{t, s, t}
-
-	for tsi := 0; tsi < 2; tsi++ {
-		t1 := ts[tsi]
-		t2 := ts[tsi+1]
-
-		for i := 0; i < 3; i++ {
-			v := t1[(i+1)%3].sub(&t1[i%3])
-			sep := &Point{x: v.y, y: -v.x}
-			sep = sep.div(sep.norm())
-
-			t1p1 := sep.innerProd(&t1[i%3])
-			t1p2 := sep.innerProd(&t1[(i+2)%3])
-			t1pMin := math.Min(t1p1, t1p2)
-			t1pMax := math.Max(t1p1, t1p2)
-
-			t2p1 := sep.innerProd(&t2[0])
-			t2p2 := sep.innerProd(&t2[1])
-			t2p3 := sep.innerProd(&t2[2])
-			t2pMin := math.Min(t2p1, t2p2)
-			t2pMin = math.Min(t2pMin, t2p3)
-			t2pMax := math.Max(t2p1, t2p2)
-			t2pMax = math.Max(t2pMax, t2p3)
-
-			if t2pMin <= t1pMin && t1pMin < t2pMax ||
-				t2pMin < t1pMax && t1pMax <= t2pMax ||
-				t1pMin <= t2pMin && t2pMin < t1pMax ||
-				t1pMin < t2pMax && t2pMax <= t1pMax {
-				continue
-			}
-
-			return false
-		}
-	}
-
-	return true
-}
+// Geometry is shared with the puzzle package, which generates maps without Ebiten
+type (
+	Point    = puzzle.Point
+	Line     = puzzle.Line
+	Triangle = puzzle.Triangle
+)
 
 type AreaStatus int
 
@@ -220,9 +172,13 @@ const (
 
 type Area struct {
 	Triangle
+	// Stable identity of the area in the map, which is kept while areas are added
+	id        int
 	color     int
 	adjacents []*Area
 	status    AreaStatus
+	// Colored by the puzzle code, which cannot be changed
+	given bool
 }
 
 var vertexImg = drawutil.CreatePatternImage([][]rune{
@@ -238,11 +194,12 @@ var vertexImg = drawutil.CreatePatternImage([][]rune{
 	DotSize: 1.5,
 })
 
-func (a *Area) DrawVertices(screen *ebiten.Image, brightness float64) {
+func (a *Area) DrawVertices(screen *ebiten.Image, camera *Camera, brightness float64) {
 	for _, p := range a.Triangle {
+		sp := camera.toScreen(&p)
 		opts := &ebiten.DrawImageOptions{}
 		opts.ColorM.Scale(1.0, 1.0, 1.0, brightness)
-		drawutil.DrawImageAt(screen, vertexImg, p.x, p.y, opts)
+		drawutil.DrawImageAt(screen, vertexImg, sp.X, sp.Y, opts)
 	}
 }
 
@@ -253,32 +210,21 @@ var emptyImage = func() *ebiten.Image {
 }()
 
 func (a *Area) getColorScales() (r, g, b, alpha float32) {
-	switch a.color {
-	case -1:
-		alpha = 0.0
-	case 0:
-		r = 1.0
-		alpha = 0.3
-	case 1:
-		g = 1.0
-		alpha = 0.3
-	case 2:
-		b = 1.0
-		alpha = 0.3
-	case 3:
-		r = 1.0
-		g = 1.0
-		alpha = 0.3
+	if a.color < 0 || a.color >= paletteSize {
+		return
 	}
-	return
+	p := getPalette()
+	c := p.colors[a.color]
+	return c[0], c[1], c[2], p.alpha
 }
 
-func (a *Area) Draw(screen *ebiten.Image) {
+func (a *Area) Draw(screen *ebiten.Image, camera *Camera) {
 	var vertices []ebiten.Vertex
 	for i := 0; i < 3; i++ {
+		p := camera.toScreen(&a.Triangle[i])
 		v := ebiten.Vertex{
-			DstX: float32(a.Triangle[i].x),
-			DstY: float32(a.Triangle[i].y),
+			DstX: float32(p.X),
+			DstY: float32(p.Y),
 			SrcX: 0,
 			SrcY: 0,
 		}
@@ -288,6 +234,14 @@ func (a *Area) Draw(screen *ebiten.Image) {
 	indices := []uint16{0, 1, 2}
 	op := &ebiten.DrawTrianglesOptions{}
 	screen.DrawTriangles(vertices, indices, emptyImage.SubImage(image.Rect(1, 1, 2, 2)).(*ebiten.Image), op)
+
+	if settings.Patterns && a.color >= 0 && a.color < len(colorPatternImgs) {
+		c := camera.toScreen(a.Triangle.Center())
+		opts := &ebiten.DrawImageOptions{}
+		opts.GeoM.Scale(camera.scale, camera.scale)
+		opts.ColorM.Scale(1.0, 1.0, 1.0, 0.7)
+		drawutil.DrawImageAt(screen, colorPatternImgs[a.color], c.X, c.Y, opts)
+	}
 }
 
 type TriangleEffect struct {
@@ -300,18 +254,18 @@ func (e *TriangleEffect) Update() {
 	e.ticks++
 }
 
-func (e *TriangleEffect) Draw(screen *ebiten.Image) {
+func (e *TriangleEffect) Draw(screen *ebiten.Image, camera *Camera) {
 	scale := 1.1 + float64(e.ticks)/60
 	alpha := 0.2 * (1.0 - float32(e.ticks)/60)
 
-	center := e.Triangle[0].add(&e.Triangle[1]).add(&e.Triangle[2]).div(3)
+	center := e.Triangle[0].Add(&e.Triangle[1]).Add(&e.Triangle[2]).Div(3)
 
 	var vertices []ebiten.Vertex
 	for i := 0; i < 3; i++ {
-		p := e.Triangle[i].sub(center).mul(scale).add(center)
+		p := camera.toScreen(e.Triangle[i].Sub(center).Mul(scale).Add(center))
 		v := ebiten.Vertex{
-			DstX: float32(p.x),
-			DstY: float32(p.y),
+			DstX: float32(p.X),
+			DstY: float32(p.Y),
 			SrcX: 0,
 			SrcY: 0,
 		}
@@ -323,6 +277,11 @@ func (e *TriangleEffect) Draw(screen *ebiten.Image) {
 	screen.DrawTriangles(vertices, indices, emptyImage.SubImage(image.Rect(1, 1, 2, 2)).(*ebiten.Image), op)
 }
 
+type Star struct {
+	Point
+	r float64
+}
+
 type ShootingStar struct {
 	Point
 	r      float64
@@ -332,17 +291,17 @@ type ShootingStar struct {
 
 func (s *ShootingStar) Update() {
 	s.ticks++
-	s.x += s.vx
-	s.y += s.vy
+	s.X += s.vx
+	s.Y += s.vy
 }
 
 func (s *ShootingStar) Draw(screen *ebiten.Image) {
 	ts := math.Min(float64(s.ticks), 30)
 	te := math.Max(float64(s.ticks)-30, 0)
-	ebitenutil.DrawLine(screen, s.x-s.vx*ts, s.y-s.vy*ts, s.x-s.vx*te, s.y-s.vy*te, color.RGBA{0xff, 0xff, 0xff, 0x30})
+	ebitenutil.DrawLine(screen, s.X-s.vx*ts, s.Y-s.vy*ts, s.X-s.vx*te, s.Y-s.vy*te, color.RGBA{0xff, 0xff, 0xff, 0x30})
 
 	if s.ticks < 30 {
-		ebitenutil.DrawCircle(screen, s.x, s.y, s.r, color.RGBA{0xff, 0xff, 0xff, 0x7a})
+		ebitenutil.DrawCircle(screen, s.X, s.Y, s.r, color.RGBA{0xff, 0xff, 0xff, 0x7a})
 	}
 }
 
@@ -354,54 +313,172 @@ const (
 	GameModePlaying
 	GameModeGameOver
 	GameModeRanking
+	GameModeNextMap
+	GameModeSettings
+	GameModeCode
+	GameModeVersus
 )
 
 type Game struct {
-	playerID             string
-	playID               string
-	fixedRandomSeed      int64
-	touchContext         *touchutil.TouchContext
+	playerID          string
+	playID            string
+	fixedRandomSeed   int64
+	seed              int64
+	dailyDate         string
+	rule              GameRule
+	code              *puzzle.PuzzleCode
+	fromCode          bool
+	codeInput         string
+	codeError         string
+	versus            *Versus
+	duel              *Duel
+	roomInput         string
+	roomCoop          bool
+	proof             *puzzle.Proof
+	optimumColorNum   int
+	usedColorNum      int
+	inputStyle        InputStyle
+	selectedColor     int
+	marathonMapNum    int
+	marathonTicksLeft int
+	// Next map of the marathon, which is generated in the background while the map is played
+	nextMap          <-chan []puzzle.Triangle
+	zenFrontier      Point
+	camera           *Camera
+	cameraTarget     Point
+	cameraController *CameraController
+	// Touch which may become a tap on release, and the tap made in this tick
+	tapStart             *touchutil.TouchPosition
+	tap                  *touchutil.TouchPosition
+	touchContext         TouchInput
+	sound                Sound
+	clock                Clock
+	telemetry            TelemetrySink
+	storage              Storage
+	width, height        float64
+	uiScale              float64
 	random               *rand.Rand
+	mapRandom            *rand.Rand
 	mode                 GameMode
+	ticks                uint64
 	ticksFromModeStart   uint64
+	recording            *Replay
+	hasReplay            bool
+	replayPlayer         *ReplayPlayer
 	score                int
 	rankingCh            <-chan []logging.GameScore
 	ranking              []logging.GameScore
+	exportNotice         string
+	stars                []Star
 	starsImg             *ebiten.Image
 	shootingStars        []ShootingStar
 	areas                []Area
+	areaIndices          map[int]int
 	triangleEffects      []TriangleEffect
 	openingLineDrawOrder [][]Line
 }
 
 func (g *Game) Update() error {
+	if g.replayPlayer != nil {
+		g.updateReplay()
+		return nil
+	}
+
 	g.touchContext.Update()
+	g.step()
+
+	return nil
+}
 
+// Advance the game by one tick, which must be deterministic for replays
+func (g *Game) step() {
+	g.sound.Update()
+
+	g.ticks++
 	g.ticksFromModeStart++
 
-	loggingutil.SendTouchLog(gameName, g.playerID, g.playID, g.ticksFromModeStart, g.touchContext)
+	if g.replayPlayer != nil {
+		g.replayPlayer.applyEvents(g)
+	} else if g.mode == GameModePlaying || g.mode == GameModeGameOver {
+		if g.cameraController.Update(g.camera, g.touchContext) {
+			// Stop following the target once the player moves the camera
+			g.cameraTarget = g.camera.center
+			g.recordEvent(ReplayEvent{Camera: &ReplayCamera{X: g.camera.center.X, Y: g.camera.center.Y, Scale: g.camera.scale}})
+		}
+	}
+	g.camera.follow(&g.cameraTarget)
+
+	if g.touchContext.IsJustTouched() {
+		pos := g.touchContext.GetTouchPosition()
+		g.recordEvent(ReplayEvent{Touch: &pos})
+	}
+
+	if g.replayPlayer == nil {
+		g.updateTap()
+		g.telemetry.SendTouches(g.playerID, g.playID, g.ticksFromModeStart, g.touchContext, g.camera)
+		g.updateVersus()
+	}
 
 	switch g.mode {
 	case GameModeTitle:
 		if g.touchContext.IsJustTouched() {
-			g.setNextMode(GameModeOpening)
+			pos := g.touchContext.GetTouchPosition()
+			p := g.getUICamera().toWorld(&Point{X: float64(pos.X), Y: float64(pos.Y)})
 
-			loggingutil.SendLog(gameName, g.playerID, g.playID, map[string]interface{}{
-				"action": "start_game",
-			})
+			if x, y, w, h := g.getSettingsButtonRect(); x <= p.X && p.X <= x+w && y <= p.Y && p.Y <= y+h {
+				g.setNextMode(GameModeSettings)
+				break
+			}
+			if x, y, w, h := g.getCodeButtonRect(); x <= p.X && p.X <= x+w && y <= p.Y && p.Y <= y+h {
+				g.codeError = ""
+				g.setNextMode(GameModeCode)
+				break
+			}
+			if x, y, w, h := g.getVersusRoomButtonRect(); g.replayPlayer == nil && x <= p.X && p.X <= x+w && y <= p.Y && p.Y <= y+h {
+				if g.roomInput == "" {
+					g.roomInput = g.generateRoomName()
+				}
+				g.setNextMode(GameModeVersus)
+				break
+			}
+			if x, y, w, h := g.getReplayStartButtonRect(); g.replayPlayer == nil && x <= p.X && p.X <= x+w && y <= p.Y && p.Y <= y+h {
+				if r, ok := g.loadReplay(); ok {
+					g.startReplay(r, g.touchContext)
+				}
+				break
+			}
+
+			for i, rule := range gameRules {
+				x, y, w, h := g.getRuleButtonRect(i)
+				if p.X < x || x+w < p.X || p.Y < y || y+h < p.Y {
+					continue
+				}
+
+				if rule.daily && g.isDailyCompleted(g.clock.Now().UTC().Format(dailyDateFormat)) {
+					break
+				}
+
+				g.startGame(i, settings.InputStyle)
 
-			audio.NewPlayerFromBytes(audioContext, gameStartAudioData).Play()
+				break
+			}
 		}
+	case GameModeSettings:
+		g.updateSettings()
+	case GameModeCode:
+		g.updateCodeEntry()
+	case GameModeVersus:
+		g.updateVersusLobby()
 	case GameModeOpening:
 		if g.random.Int()%120 == 0 {
 			g.shootingStars = append(g.shootingStars, ShootingStar{
 				Point: Point{
-					x: screenWidth * g.random.Float64(),
-					y: screenHeight * g.random.Float64(),
+					X: g.width * g.random.Float64(),
+					Y: g.height * g.random.Float64(),
 				},
-				r:  2.0,
-				vx: -3.0,
-				vy: 3.0,
+				r:  2.0 * g.uiScale,
+				vx: -3.0 * g.uiScale,
+				vy: 3.0 * g.uiScale,
 			})
 		}
 
@@ -419,49 +496,67 @@ func (g *Game) Update() error {
 		if g.ticksFromModeStart > 10*60 {
 			g.setNextMode(GameModePlaying)
 
-			audio.NewPlayerFromBytes(audioContext, playStartAudioData).Play()
+			g.sound.PlaySE(playStartAudioData)
 		}
 	case GameModePlaying:
 		if g.ticksFromModeStart%600 == 0 {
-			loggingutil.SendLog(gameName, g.playerID, g.playID, map[string]interface{}{
-				"action": "playing",
-				"ticks":  g.ticksFromModeStart,
-				"score":  g.score,
+			g.sendEvent(PlayingEvent{
+				Ticks: g.ticksFromModeStart,
+				Score: g.score,
 			})
 		}
 
-		if g.ticksFromModeStart == 60 {
-			bgmPlayer.Rewind()
-			bgmPlayer.Play()
+		if g.ticksFromModeStart == 60 && g.marathonMapNum == 0 {
+			g.sound.PlayBGM()
 		}
 
-		g.score = int(g.ticksFromModeStart)
+		if g.rule.marathon {
+			g.marathonTicksLeft--
+			g.score = g.marathonMapNum
+		} else {
+			g.score = int(g.ticksFromModeStart)
+		}
 
-		if g.touchContext.IsJustTouched() {
-			pos := g.touchContext.GetTouchPosition()
+		quit := false
+		if g.tap != nil {
+			pos := *g.tap
+			if g.rule.zen && float64(pos.X) < 70*g.uiScale && float64(pos.Y) < 30*g.uiScale {
+				quit = true
+			}
+			picked := false
+			if g.inputStyle == InputStylePalette {
+				for i := 0; i < g.rule.colorNum; i++ {
+					x, y, w, h := g.getColorSwatchRect(i)
+					if x <= float64(pos.X) && float64(pos.X) <= x+w && y <= float64(pos.Y) && float64(pos.Y) <= y+h {
+						g.selectedColor = i
+						picked = true
+						break
+					}
+				}
+			}
 			for i := range g.areas {
 				a := &g.areas[i]
-				if a.Triangle.covers(&Point{x: float64(pos.X), y: float64(pos.Y)}) {
-					a.color = (a.color + 1) % 4
-
-					cr, cg, cb, _ := a.getColorScales()
-					e := TriangleEffect{
-						Triangle: a.Triangle,
-						colorR:   cr,
-						colorG:   cg,
-						colorB:   cb,
+				if quit || picked {
+					break
+				}
+				if a.Triangle.Covers(g.camera.toWorld(&Point{X: float64(pos.X), Y: float64(pos.Y)})) {
+					if a.given {
+						break
 					}
-					g.triangleEffects = append(g.triangleEffects, e)
-
-					switch a.color {
-					case 0:
-						audio.NewPlayerFromBytes(audioContext, color0AudioData).Play()
-					case 1:
-						audio.NewPlayerFromBytes(audioContext, color1AudioData).Play()
-					case 2:
-						audio.NewPlayerFromBytes(audioContext, color2AudioData).Play()
-					case 3:
-						audio.NewPlayerFromBytes(audioContext, color3AudioData).Play()
+
+					if g.rule.duel {
+						g.playDuelMove(i)
+						break
+					}
+
+					if g.inputStyle == InputStylePalette {
+						if a.color == g.selectedColor {
+							g.colorArea(i, -1)
+						} else {
+							g.colorArea(i, g.selectedColor)
+						}
+					} else {
+						g.colorArea(i, (a.color+1)%g.rule.colorNum)
 					}
 
 					break
@@ -469,15 +564,19 @@ func (g *Game) Update() error {
 			}
 		}
 
+		if g.rule.duel {
+			g.updateDuel()
+		}
+
 		if g.random.Int()%120 == 0 {
 			g.shootingStars = append(g.shootingStars, ShootingStar{
 				Point: Point{
-					x: screenWidth * g.random.Float64(),
-					y: screenHeight * g.random.Float64(),
+					X: g.width * g.random.Float64(),
+					Y: g.height * g.random.Float64(),
 				},
-				r:  2.0,
-				vx: -3.0,
-				vy: 3.0,
+				r:  2.0 * g.uiScale,
+				vx: -3.0 * g.uiScale,
+				vy: 3.0 * g.uiScale,
 			})
 		}
 
@@ -521,12 +620,78 @@ func (g *Game) Update() error {
 			}
 		}
 
-		if allOK {
-			loggingutil.SendLog(gameName, g.playerID, g.playID, map[string]interface{}{
-				"action": "game_over",
-				"score":  g.score,
+		if allOK && g.rule.zen {
+			// The board stays completed until the map is extended, which is tried again in the next tick
+			for i := 0; i < zenExtendTries; i++ {
+				if g.extendZenMap() {
+					g.sound.PlayJingle(completeAudioData)
+					break
+				}
+			}
+		} else if allOK && g.rule.marathon {
+			g.marathonMapNum++
+			g.score = g.marathonMapNum
+
+			g.sendEvent(MarathonMapCompleteEvent{
+				Ticks: g.ticksFromModeStart,
+				Score: g.score,
 			})
 
+			completedAreas := g.areas
+
+			g.generateMap()
+
+			for _, a := range completedAreas {
+				cr, cg, cb, _ := a.getColorScales()
+				e := TriangleEffect{
+					Triangle: a.Triangle,
+					colorR:   cr,
+					colorG:   cg,
+					colorB:   cb,
+				}
+				g.triangleEffects = append(g.triangleEffects, e)
+			}
+
+			g.setNextMode(GameModeNextMap)
+
+			g.sound.PlayJingle(completeAudioData)
+		} else if allOK && !g.rule.duel || g.rule.marathon && g.marathonTicksLeft <= 0 || g.rule.duel && g.duel.winner >= 0 || quit {
+			if g.rule.zen {
+				g.score = 0
+				for _, a := range g.areas {
+					if a.status == AreaStatusOK {
+						g.score++
+					}
+				}
+			}
+
+			used := make(map[int]bool)
+			for _, a := range g.areas {
+				used[a.color] = true
+			}
+			g.usedColorNum = len(used)
+
+			if g.rule.minimizeColors {
+				g.score = puzzle.GetMinimizeColorsScore(g.score, g.usedColorNum, g.optimumColorNum)
+			}
+			if g.rule.duel {
+				g.score = g.duel.winner
+			}
+
+			e := GameOverEvent{
+				Score:     g.score,
+				UsedColor: g.usedColorNum,
+			}
+			if g.proof != nil {
+				if proof, err := g.proof.Encode(); err == nil {
+					e.Proof = proof
+				} else {
+					log.Println(err)
+				}
+			}
+			g.sendEvent(e)
+			g.telemetry.Flush()
+
 			g.triangleEffects = nil
 			for _, a := range g.areas {
 				cr, cg, cb, _ := a.getColorScales()
@@ -539,22 +704,67 @@ func (g *Game) Update() error {
 				g.triangleEffects = append(g.triangleEffects, e)
 			}
 
+			if g.rule.daily && g.replayPlayer == nil {
+				if err := g.storage.Save(dailyCompletedStorageKey, g.dailyDate); err != nil {
+					log.Println(err)
+				}
+			}
+
 			g.setNextMode(GameModeGameOver)
 
-			g.rankingCh = loggingutil.RegisterScoreToRankingAsync(gameName, g.playerID, g.playID, g.score)
+			if g.versus != nil {
+				g.sendVersusProgress(true)
+			}
+
+			if g.recording != nil {
+				g.recording.EndTicks = g.ticks
+				g.saveReplay(g.recording)
+			}
+
+			if !g.rule.zen && !g.rule.duel && !g.fromCode && g.replayPlayer == nil {
+				g.rankingCh = g.telemetry.RegisterScore(g.getRankingName(), g.playerID, g.playID, g.score)
+			}
+
+			g.sound.PlayJingle(completeAudioData)
+		}
+	case GameModeNextMap:
+		var newTriangleEffects []TriangleEffect
+		for i := range g.triangleEffects {
+			e := &g.triangleEffects[i]
+			e.Update()
+
+			if e.ticks < 60 {
+				newTriangleEffects = append(newTriangleEffects, *e)
+			}
+		}
+		g.triangleEffects = newTriangleEffects
+
+		var newShootingStars []ShootingStar
+		for i := range g.shootingStars {
+			s := &g.shootingStars[i]
+			s.Update()
+
+			if s.ticks < 60 {
+				newShootingStars = append(newShootingStars, *s)
+			}
+		}
+		g.shootingStars = newShootingStars
+
+		if g.ticksFromModeStart > marathonTransitionTicks {
+			g.setNextMode(GameModePlaying)
 
-			audio.NewPlayerFromBytes(audioContext, completeAudioData).Play()
+			g.sound.PlaySE(playStartAudioData)
 		}
 	case GameModeGameOver:
 		if g.random.Int()%30 == 0 {
 			g.shootingStars = append(g.shootingStars, ShootingStar{
 				Point: Point{
-					x: screenWidth * g.random.Float64(),
-					y: screenHeight * g.random.Float64(),
+					X: g.width * g.random.Float64(),
+					Y: g.height * g.random.Float64(),
 				},
-				r:  2.0,
-				vx: -3.0,
-				vy: 3.0,
+				r:  2.0 * g.uiScale,
+				vx: -3.0 * g.uiScale,
+				vy: 3.0 * g.uiScale,
 			})
 		}
 
@@ -580,67 +790,318 @@ func (g *Game) Update() error {
 		}
 		g.shootingStars = newShootingStars
 
-		if g.ticksFromModeStart > 60 && g.touchContext.IsJustTouched() {
+		if i, ok := g.getTouchedExportButton(); ok && g.replayPlayer == nil {
+			g.exportMap(exportFormats[i])
+		} else if g.ticksFromModeStart > 60 && g.touchContext.IsJustTouched() {
+			g.leaveVersus()
 			g.initialize()
-			bgmPlayer.Pause()
+			g.sound.PauseBGM()
 		}
 	}
-
-	return nil
 }
 
 func (g *Game) drawSky(screen *ebiten.Image) {
+	w, h := skyImg.Size()
 	opts := &ebiten.DrawImageOptions{}
+	opts.GeoM.Scale(g.width/float64(w), g.height/float64(h))
 	screen.DrawImage(skyImg, opts)
 }
 
 func (g *Game) drawStars(screen *ebiten.Image, brightness float64) {
-	opts := &ebiten.DrawImageOptions{}
-	opts.ColorM.Translate(0, 0, 0, -1.0+brightness)
-	screen.DrawImage(g.starsImg, opts)
+	if g.starsImg == nil {
+		g.starsImg = ebiten.NewImage(screenWidth, screenHeight)
+		for _, s := range g.stars {
+			ebitenutil.DrawCircle(g.starsImg, s.X, s.Y, s.r, color.White)
+		}
+	}
+
+	w, h := g.starsImg.Size()
+	tileWidth, tileHeight := float64(w)*g.uiScale, float64(h)*g.uiScale
+
+	// Stars are far away so they move slower than the map (parallax)
+	offset := mapCenter.Sub(&g.camera.center).Mul(g.camera.scale * starsParallax)
+	ox := math.Mod(offset.X, tileWidth)
+	if ox > 0 {
+		ox -= tileWidth
+	}
+	oy := math.Mod(offset.Y, tileHeight)
+	if oy > 0 {
+		oy -= tileHeight
+	}
+
+	for y := oy; y < g.height; y += tileHeight {
+		for x := ox; x < g.width; x += tileWidth {
+			opts := &ebiten.DrawImageOptions{}
+			opts.GeoM.Scale(g.uiScale, g.uiScale)
+			opts.GeoM.Translate(x, y)
+			opts.ColorM.Translate(0, 0, 0, -1.0+brightness)
+			screen.DrawImage(g.starsImg, opts)
+		}
+	}
+}
+
+// Draw the whole map in small when some of it is out of the screen
+func (g *Game) drawMinimap(screen *ebiten.Image) {
+	if len(g.areas) == 0 {
+		return
+	}
+
+	minP, maxP := g.getMapBounds()
+
+	viewMin := g.camera.toWorld(&Point{X: 0, Y: 0})
+	viewMax := g.camera.toWorld(&Point{X: g.width, Y: g.height})
+	if viewMin.X <= minP.X && viewMin.Y <= minP.Y && maxP.X <= viewMax.X && maxP.Y <= viewMax.Y {
+		return
+	}
+
+	minP.X, minP.Y = math.Min(minP.X, viewMin.X), math.Min(minP.Y, viewMin.Y)
+	maxP.X, maxP.Y = math.Max(maxP.X, viewMax.X), math.Max(maxP.Y, viewMax.Y)
+
+	mx, my := minimapX*g.uiScale, minimapY*g.uiScale
+	mw, mh := minimapWidth*g.uiScale, minimapHeight*g.uiScale
+
+	scale := math.Min(mw/(maxP.X-minP.X), mh/(maxP.Y-minP.Y))
+	origin := Point{
+		X: mx + (mw-(maxP.X-minP.X)*scale)/2,
+		Y: my + (mh-(maxP.Y-minP.Y)*scale)/2,
+	}
+	toMinimap := func(p *Point) *Point {
+		return p.Sub(&minP).Mul(scale).Add(&origin)
+	}
+
+	ebitenutil.DrawRect(screen, mx, my, mw, mh, color.RGBA{0, 0, 0, 0x80})
+	var vertices []ebiten.Vertex
+	var indices []uint16
+	for _, a := range g.areas {
+		cr, cg, cb, alpha := a.getColorScales()
+		if a.color == -1 {
+			cr, cg, cb, alpha = 1.0, 1.0, 1.0, 0.1
+		}
+		for _, p := range a.Triangle {
+			mp := toMinimap(&p)
+			indices = append(indices, uint16(len(vertices)))
+			vertices = append(vertices, ebiten.Vertex{
+				DstX:   float32(mp.X),
+				DstY:   float32(mp.Y),
+				ColorR: cr,
+				ColorG: cg,
+				ColorB: cb,
+				ColorA: alpha * 2,
+			})
+		}
+		if len(vertices) > math.MaxUint16-3 {
+			screen.DrawTriangles(vertices, indices, emptyImage.SubImage(image.Rect(1, 1, 2, 2)).(*ebiten.Image), &ebiten.DrawTrianglesOptions{})
+			vertices, indices = nil, nil
+		}
+	}
+	screen.DrawTriangles(vertices, indices, emptyImage.SubImage(image.Rect(1, 1, 2, 2)).(*ebiten.Image), &ebiten.DrawTrianglesOptions{})
+
+	v0, v1 := toMinimap(viewMin), toMinimap(viewMax)
+	ebitenutil.DrawLine(screen, v0.X, v0.Y, v1.X, v0.Y, color.White)
+	ebitenutil.DrawLine(screen, v1.X, v0.Y, v1.X, v1.Y, color.White)
+	ebitenutil.DrawLine(screen, v1.X, v1.Y, v0.X, v1.Y, color.White)
+	ebitenutil.DrawLine(screen, v0.X, v1.Y, v0.X, v0.Y, color.White)
 }
 
 func (g *Game) drawSurface(screen *ebiten.Image) {
+	// The surface is stretched horizontally and placed at the bottom
+	w, h := surfaceImg.Size()
 	opts := &ebiten.DrawImageOptions{}
+	opts.GeoM.Scale(g.width/float64(w), g.uiScale)
+	opts.GeoM.Translate(0, g.height-float64(h)*g.uiScale)
 	screen.DrawImage(surfaceImg, opts)
 }
 
 func (g *Game) drawTitle(screen *ebiten.Image) {
-	text.Draw(screen, "FOUR", fontL.Face, 25, 75, color.White)
-	text.Draw(screen, "COLOR", fontL.Face, 185, 75, color.White)
-	text.Draw(screen, "THEOREM", fontL.Face, 370, 75, color.White)
+	g.drawUIText(screen, "FOUR", fontL, 25, 75, TextAlignLeft, color.White)
+	g.drawUIText(screen, "COLOR", fontL, 185, 75, TextAlignLeft, color.White)
+	g.drawUIText(screen, "THEOREM", fontL, 370, 75, TextAlignLeft, color.White)
 
-	usageTexts := []string{"[TAP] Change color"}
+	usageTexts := []string{msg("usage_cycle")}
+	if settings.InputStyle == InputStylePalette {
+		usageTexts = []string{msg("usage_palette")}
+	}
 	for i, s := range usageTexts {
-		text.Draw(screen, s, fontS.Face, screenWidth/2-len(s)*int(fontS.FaceOptions.Size)/2, 350+i*int(fontS.FaceOptions.Size*1.8), color.White)
+		g.drawUIText(screen, s, fontS, screenWidth/2, 322+float64(i)*fontS.FaceOptions.Size*1.8, TextAlignCenter, color.White)
+	}
+
+	uiCamera := g.getUICamera()
+	for i, rule := range gameRules {
+		x, y, w, h := g.getRuleButtonRect(i)
+		p := uiCamera.toScreen(&Point{X: x, Y: y})
+		ebitenutil.DrawRect(screen, p.X, p.Y, w*uiCamera.scale, h*uiCamera.scale, color.RGBA{0xff, 0xff, 0xff, 0x30})
+		s := rule.getLabel()
+		if rule.daily && g.isDailyCompleted(g.clock.Now().UTC().Format(dailyDateFormat)) {
+			s = fmt.Sprintf(msg("next"), formatCountdown(getTimeUntilNextDaily(g.now())))
+		}
+		g.drawUIText(screen, s, fontS, x+w/2, y+h/2+fontS.FaceOptions.Size/2, TextAlignCenter, color.White)
+	}
+
+	x, y, w, h := g.getSettingsButtonRect()
+	p := uiCamera.toScreen(&Point{X: x, Y: y})
+	ebitenutil.DrawRect(screen, p.X, p.Y, w*uiCamera.scale, h*uiCamera.scale, color.RGBA{0xff, 0xff, 0xff, 0x30})
+	g.drawUIText(screen, msg("settings"), fontS, x+w/2, y+h/2+fontS.FaceOptions.Size/2, TextAlignCenter, color.White)
+
+	x, y, w, h = g.getCodeButtonRect()
+	p = uiCamera.toScreen(&Point{X: x, Y: y})
+	ebitenutil.DrawRect(screen, p.X, p.Y, w*uiCamera.scale, h*uiCamera.scale, color.RGBA{0xff, 0xff, 0xff, 0x30})
+	g.drawUIText(screen, msg("code"), fontS, x+w/2, y+h/2+fontS.FaceOptions.Size/2, TextAlignCenter, color.White)
+
+	if g.replayPlayer == nil {
+		x, y, w, h := g.getVersusRoomButtonRect()
+		p := uiCamera.toScreen(&Point{X: x, Y: y})
+		ebitenutil.DrawRect(screen, p.X, p.Y, w*uiCamera.scale, h*uiCamera.scale, color.RGBA{0xff, 0xff, 0xff, 0x30})
+		g.drawUIText(screen, msg("versus"), fontS, x+w/2, y+h/2+fontS.FaceOptions.Size/2, TextAlignCenter, color.White)
+	}
+
+	if g.hasReplay && g.replayPlayer == nil {
+		x, y, w, h := g.getReplayStartButtonRect()
+		p := uiCamera.toScreen(&Point{X: x, Y: y})
+		ebitenutil.DrawRect(screen, p.X, p.Y, w*uiCamera.scale, h*uiCamera.scale, color.RGBA{0xff, 0xff, 0xff, 0x30})
+		g.drawUIText(screen, msg("replay"), fontS, x+w/2, y+h/2+fontS.FaceOptions.Size/2, TextAlignCenter, color.White)
 	}
 
 	creditTexts := []string{"CREATOR: NAOKI TSUJIO", "FONT: Press Start 2P by CodeMan38", "SOUND EFFECT: MaouDamashii"}
 	for i, s := range creditTexts {
-		text.Draw(screen, s, fontS.Face, screenWidth/2-len(s)*int(fontS.FaceOptions.Size)/2, 420+i*int(fontS.FaceOptions.Size*1.8), color.White)
+		g.drawUIText(screen, s, fontS, screenWidth/2, 420+float64(i)*fontS.FaceOptions.Size*1.8, TextAlignCenter, color.White)
 	}
 }
 
-func (g *Game) drawProgress(screen *ebiten.Image) {
-	progress := 0.0
-	for _, a := range g.areas {
-		if a.color != -1 {
-			ng := false
-			for _, ad := range a.adjacents {
-				if a.color == ad.color {
-					ng = true
-					break
-				}
-			}
-			if !ng {
-				progress += 1.0
-			}
+func (g *Game) getReplayStartButtonRect() (x, y, w, h float64) {
+	return 10, 6, 140, 22
+}
+
+func (g *Game) getRuleButtonRect(index int) (x, y, w, h float64) {
+	const buttonsPerRow = 4
+
+	row, col := index/buttonsPerRow, index%buttonsPerRow
+	n := len(gameRules) - row*buttonsPerRow
+	if n > buttonsPerRow {
+		n = buttonsPerRow
+	}
+
+	w, h = 136, 28
+	x = screenWidth/2 + (float64(col)-float64(n-1)/2)*(w+16) - w/2
+	y = 336 + float64(row)*(h+6)
+	return
+}
+
+func (g *Game) getColorSwatchRect(index int) (x, y, w, h float64) {
+	w, h = 32*g.uiScale, 32*g.uiScale
+	x = g.width/2 + (float64(index)-float64(g.rule.colorNum-1)/2)*(w+8*g.uiScale) - w/2
+	y = g.height - 44*g.uiScale
+	return
+}
+
+func (g *Game) drawColorSwatches(screen *ebiten.Image) {
+	if g.inputStyle != InputStylePalette {
+		return
+	}
+
+	for i := 0; i < g.rule.colorNum; i++ {
+		x, y, w, h := g.getColorSwatchRect(i)
+		c := getPalette().colors[i%paletteSize]
+		ebitenutil.DrawRect(screen, x, y, w, h, color.RGBA{uint8(c[0] * 0xff), uint8(c[1] * 0xff), uint8(c[2] * 0xff), 0xc0})
+		if i == g.selectedColor {
+			ebitenutil.DrawRect(screen, x, y+h+2*g.uiScale, w, 3*g.uiScale, color.White)
+		}
+	}
+}
+
+func (g *Game) drawConflicts(screen *ebiten.Image) {
+	if !settings.HighlightConflicts {
+		return
+	}
+
+	alpha := 0.15 + 0.1*math.Sin(float64(g.ticksFromModeStart)*2*math.Pi/60)
+	for _, a := range g.areas {
+		if a.status != AreaStatusNG {
+			continue
+		}
+		var vertices []ebiten.Vertex
+		for i := 0; i < 3; i++ {
+			p := g.camera.toScreen(&a.Triangle[i])
+			v := ebiten.Vertex{
+				DstX: float32(p.X),
+				DstY: float32(p.Y),
+				SrcX: 0,
+				SrcY: 0,
+			}
+			v.ColorR, v.ColorG, v.ColorB, v.ColorA = 1.0, 0, 0, float32(alpha)
+			vertices = append(vertices, v)
+		}
+		indices := []uint16{0, 1, 2}
+		op := &ebiten.DrawTrianglesOptions{}
+		screen.DrawTriangles(vertices, indices, emptyImage.SubImage(image.Rect(1, 1, 2, 2)).(*ebiten.Image), op)
+	}
+}
+
+// Change the color of the area by the player, which is recorded and shown with an effect
+func (g *Game) colorArea(index, color int) {
+	a := &g.areas[index]
+	a.color = color
+
+	if g.proof != nil {
+		g.proof.AddEvent(g.getPlayingTicks(), g.marathonMapNum, index, a.color)
+	}
+
+	g.sendEvent(ColorChangeEvent{
+		Ticks: g.ticksFromModeStart,
+		Map:   g.marathonMapNum,
+		Area:  index,
+		Color: a.color,
+	})
+
+	cr, cg, cb, _ := a.getColorScales()
+	e := TriangleEffect{
+		Triangle: a.Triangle,
+		colorR:   cr,
+		colorG:   cg,
+		colorB:   cb,
+	}
+	g.triangleEffects = append(g.triangleEffects, e)
+
+	if a.color >= 0 {
+		g.playAreaNote(a)
+	}
+
+	if g.versus != nil && g.versus.coop {
+		g.sendCoopOp(a)
+	}
+}
+
+func (g *Game) getAreaByID(id int) (*Area, bool) {
+	i, ok := g.areaIndices[id]
+	if !ok {
+		return nil, false
+	}
+	return &g.areas[i], true
+}
+
+func (g *Game) getProgress() float64 {
+	progress := 0.0
+	for _, a := range g.areas {
+		if a.color != -1 {
+			ng := false
+			for _, ad := range a.adjacents {
+				if a.color == ad.color {
+					ng = true
+					break
+				}
+			}
+			if !ng {
+				progress += 1.0
+			}
 		}
 	}
-	progress /= float64(len(g.areas))
+	return progress / float64(len(g.areas))
+}
+
+func (g *Game) drawProgress(screen *ebiten.Image) {
+	progress := g.getProgress()
 
 	t := fmt.Sprintf("%d%%", int(math.Floor(progress*100)))
-	text.Draw(screen, t, fontS.Face, screenWidth-len(t)*int(fontS.FaceOptions.Size)-10, 20, color.White)
+	g.drawText(screen, t, fontS, g.width-10*g.uiScale, 20*g.uiScale, TextAlignRight, color.White)
 }
 
 func (g *Game) drawOpening(screen *ebiten.Image) {
@@ -658,7 +1119,7 @@ func (g *Game) drawOpening(screen *ebiten.Image) {
 
 		vertexBrightness := math.Max((float64(ticks)-150)/150, 0.0)
 		for _, a := range g.areas {
-			a.DrawVertices(screen, vertexBrightness)
+			a.DrawVertices(screen, g.camera, vertexBrightness)
 		}
 
 		g.drawSurface(screen)
@@ -672,48 +1133,147 @@ func (g *Game) drawOpening(screen *ebiten.Image) {
 		}
 
 		for _, a := range g.areas {
-			a.DrawVertices(screen, 1.0)
+			a.DrawVertices(screen, g.camera, 1.0)
 		}
 
-		ticksPerIndex := (600 - 360) / len(g.openingLineDrawOrder)
+		g.drawLinesInOrder(screen, ticks, 600-360)
 
-		index := int(ticks / ticksPerIndex)
-		if index > len(g.openingLineDrawOrder) {
-			index = len(g.openingLineDrawOrder)
-		}
-		for i := 0; i < index; i++ {
-			for _, l := range g.openingLineDrawOrder[i] {
-				ebitenutil.DrawLine(screen, l[0].x, l[0].y, l[1].x, l[1].y, color.White)
-			}
+		g.drawSurface(screen)
+	}
+}
+
+// Draw lines of the map progressively so that all lines are drawn in duration ticks
+func (g *Game) drawLinesInOrder(screen *ebiten.Image, ticks int, duration int) {
+	ticksPerIndex := duration / len(g.openingLineDrawOrder)
+	if ticksPerIndex < 1 {
+		ticksPerIndex = 1
+	}
+
+	index := int(ticks / ticksPerIndex)
+	if index > len(g.openingLineDrawOrder) {
+		index = len(g.openingLineDrawOrder)
+	}
+	for i := 0; i < index; i++ {
+		for _, l := range g.openingLineDrawOrder[i] {
+			g.camera.drawLine(screen, &l[0], &l[1], color.White)
 		}
-		if index < len(g.openingLineDrawOrder) {
-			for _, l := range g.openingLineDrawOrder[index] {
-				v := l[1].sub(&l[0])
-				v = v.mul(float64(ticks%ticksPerIndex) / float64(ticksPerIndex))
-				p := l[0].add(v)
-				ebitenutil.DrawLine(screen, l[0].x, l[0].y, p.x, p.y, color.White)
-			}
+	}
+	if index < len(g.openingLineDrawOrder) {
+		for _, l := range g.openingLineDrawOrder[index] {
+			v := l[1].Sub(&l[0])
+			v = v.Mul(float64(ticks%ticksPerIndex) / float64(ticksPerIndex))
+			p := l[0].Add(v)
+			g.camera.drawLine(screen, &l[0], p, color.White)
 		}
+	}
+}
 
-		g.drawSurface(screen)
+func (g *Game) drawNextMap(screen *ebiten.Image) {
+	g.drawStars(screen, 1.0)
+
+	for _, s := range g.shootingStars {
+		s.Draw(screen)
+	}
+
+	for _, e := range g.triangleEffects {
+		e.Draw(screen, g.camera)
+	}
+
+	brightness := math.Min(float64(g.ticksFromModeStart)/30, 1.0)
+	for _, a := range g.areas {
+		a.DrawVertices(screen, g.camera, brightness)
 	}
+
+	g.drawLinesInOrder(screen, int(g.ticksFromModeStart), marathonTransitionTicks)
+
+	g.drawSurface(screen)
+
+	s := fmt.Sprintf(msg("map"), g.marathonMapNum+1)
+	g.drawText(screen, s, fontM, g.width/2, g.height-60*g.uiScale, TextAlignCenter, color.White)
+
+	g.drawScore(screen)
 }
 
 func (g *Game) drawScore(screen *ebiten.Image) {
+	if g.rule.duel {
+		g.drawDuelTurn(screen)
+		return
+	}
+
+	if g.rule.zen {
+		g.drawText(screen, msg("end"), fontS, 10*g.uiScale, 20*g.uiScale, TextAlignLeft, color.White)
+		return
+	}
+
+	if g.rule.marathon {
+		secs := (g.marathonTicksLeft + 59) / 60
+		if secs < 0 {
+			secs = 0
+		}
+		s := fmt.Sprintf("%d:%02d", secs/60, secs%60)
+		g.drawText(screen, s, fontS, g.width/2, 20*g.uiScale, TextAlignCenter, color.White)
+
+		s = fmt.Sprintf(msg("map"), g.marathonMapNum+1)
+		g.drawText(screen, s, fontS, 10*g.uiScale, 20*g.uiScale, TextAlignLeft, color.White)
+		return
+	}
+
 	secs := g.score / 60
 	s := fmt.Sprintf("%d:%02d", secs/60, secs%60)
-	text.Draw(screen, s, fontS.Face, screenWidth/2-len(s)*int(fontS.FaceOptions.Size)/2, 20, color.White)
+	g.drawText(screen, s, fontS, g.width/2, 20*g.uiScale, TextAlignCenter, color.White)
 }
 
 func (g *Game) drawGameOver(screen *ebiten.Image) {
 	var s string
 
-	s = "Complete!"
-	text.Draw(screen, s, fontS.Face, screenWidth/2-len(s)*int(fontS.FaceOptions.Size)/2, 400, color.White)
+	// Shown with the result so that friends can race on the same map
+	if g.code != nil {
+		s = fmt.Sprintf("%s %s", msg("code"), g.code.Encode())
+		g.drawText(screen, s, fontS, g.width/2, g.height-100*g.uiScale, TextAlignCenter, color.White)
+	}
+
+	if g.rule.duel {
+		g.drawDuelResult(screen)
+		return
+	}
+
+	if g.rule.zen {
+		s = msg("well_done")
+		g.drawText(screen, s, fontS, g.width/2, g.height-80*g.uiScale, TextAlignCenter, color.White)
+
+		s = fmt.Sprintf(msg("colored_regions"), g.score)
+		g.drawText(screen, s, fontS, g.width/2, g.height-60*g.uiScale, TextAlignCenter, color.White)
+		return
+	}
+
+	if g.rule.marathon {
+		s = msg("time_up")
+		g.drawText(screen, s, fontS, g.width/2, g.height-80*g.uiScale, TextAlignCenter, color.White)
+
+		s = fmt.Sprintf(msg("completed_maps"), g.marathonMapNum)
+		g.drawText(screen, s, fontS, g.width/2, g.height-60*g.uiScale, TextAlignCenter, color.White)
+		return
+	}
+
+	s = msg("complete")
+	g.drawText(screen, s, fontS, g.width/2, g.height-80*g.uiScale, TextAlignCenter, color.White)
 
 	secs := g.score / 60
-	s = fmt.Sprintf("Your time is %d:%02d", secs/60, secs%60)
-	text.Draw(screen, s, fontS.Face, screenWidth/2-len(s)*int(fontS.FaceOptions.Size)/2, 420, color.White)
+	if g.rule.minimizeColors {
+		s = fmt.Sprintf(msg("your_score"), secs/60, secs%60)
+		g.drawText(screen, s, fontS, g.width/2, g.height-60*g.uiScale, TextAlignCenter, color.White)
+
+		s = fmt.Sprintf(msg("used_optimum"), g.usedColorNum, g.optimumColorNum)
+		g.drawText(screen, s, fontS, g.width/2, g.height-40*g.uiScale, TextAlignCenter, color.White)
+	} else {
+		s = fmt.Sprintf(msg("your_time"), secs/60, secs%60, g.rule.colorNum)
+		g.drawText(screen, s, fontS, g.width/2, g.height-60*g.uiScale, TextAlignCenter, color.White)
+	}
+
+	if g.rule.daily {
+		s = fmt.Sprintf(msg("next_puzzle"), formatCountdown(getTimeUntilNextDaily(g.now())))
+		g.drawText(screen, s, fontS, g.width/2, g.height-40*g.uiScale, TextAlignCenter, color.White)
+	}
 }
 
 func (g *Game) Draw(screen *ebiten.Image) {
@@ -724,18 +1284,19 @@ func (g *Game) Draw(screen *ebiten.Image) {
 		g.drawStars(screen, 1.0)
 
 		var areas []Area
-		c := Point{x: screenWidth / 2, y: 200}
+		uiCamera := g.getUICamera()
+		c := Point{X: screenWidth / 2, Y: 200}
 		r := 100.0
 		for i := 0; i < 6; i++ {
 			theta1 := float64(i)*2*math.Pi/6 + math.Pi/2
 			theta2 := float64((i+1)%6)*2*math.Pi/6 + math.Pi/2
-			p1 := c.add(&Point{
-				x: r * math.Cos(theta1),
-				y: r * math.Sin(theta1),
+			p1 := c.Add(&Point{
+				X: r * math.Cos(theta1),
+				Y: r * math.Sin(theta1),
 			})
-			p2 := c.add(&Point{
-				x: r * math.Cos(theta2),
-				y: r * math.Sin(theta2),
+			p2 := c.Add(&Point{
+				X: r * math.Cos(theta2),
+				Y: r * math.Sin(theta2),
 			})
 			areas = append(areas, Area{
 				Triangle: Triangle([3]Point{c, *p1, *p2}),
@@ -747,8 +1308,8 @@ func (g *Game) Draw(screen *ebiten.Image) {
 				areas[1].Triangle[1],
 				areas[1].Triangle[2],
 				{
-					x: c.x - r*2*math.Sin(math.Pi/3),
-					y: c.y,
+					X: c.X - r*2*math.Sin(math.Pi/3),
+					Y: c.Y,
 				},
 			}),
 			color: 3,
@@ -758,28 +1319,48 @@ func (g *Game) Draw(screen *ebiten.Image) {
 				areas[4].Triangle[1],
 				areas[4].Triangle[2],
 				{
-					x: c.x + r*2*math.Sin(math.Pi/3),
-					y: c.y,
+					X: c.X + r*2*math.Sin(math.Pi/3),
+					Y: c.Y,
 				},
 			}),
 			color: 2,
 		})
 		for _, a := range areas {
-			a.Draw(screen)
-			a.DrawVertices(screen, 1.0)
+			a.Draw(screen, uiCamera)
+			a.DrawVertices(screen, uiCamera, 1.0)
 		}
 
 		for _, lines := range g.getLinesWithDrawOrder(areas) {
 			for _, line := range lines {
-				ebitenutil.DrawLine(screen, line[0].x, line[0].y, line[1].x, line[1].y, color.White)
+				uiCamera.drawLine(screen, &line[0], &line[1], color.White)
 			}
 		}
 
 		g.drawSurface(screen)
 
 		g.drawTitle(screen)
+	case GameModeSettings:
+		g.drawStars(screen, 1.0)
+
+		g.drawSurface(screen)
+
+		g.drawSettings(screen)
+	case GameModeCode:
+		g.drawStars(screen, 1.0)
+
+		g.drawSurface(screen)
+
+		g.drawCodeEntry(screen)
+	case GameModeVersus:
+		g.drawStars(screen, 1.0)
+
+		g.drawSurface(screen)
+
+		g.drawVersusLobby(screen)
 	case GameModeOpening:
 		g.drawOpening(screen)
+	case GameModeNextMap:
+		g.drawNextMap(screen)
 	case GameModePlaying:
 		g.drawStars(screen, 1.0)
 
@@ -788,25 +1369,37 @@ func (g *Game) Draw(screen *ebiten.Image) {
 		}
 
 		for _, a := range g.areas {
-			a.Draw(screen)
-			a.DrawVertices(screen, 1.0)
+			a.Draw(screen, g.camera)
+			a.DrawVertices(screen, g.camera, 1.0)
 		}
 
 		for _, lines := range g.openingLineDrawOrder {
 			for _, line := range lines {
-				ebitenutil.DrawLine(screen, line[0].x, line[0].y, line[1].x, line[1].y, color.White)
+				g.camera.drawLine(screen, &line[0], &line[1], color.White)
 			}
 		}
 
 		for _, e := range g.triangleEffects {
-			e.Draw(screen)
+			e.Draw(screen, g.camera)
 		}
 
+		g.drawConflicts(screen)
+
+		g.drawGivens(screen)
+
+		g.drawCoopCursors(screen)
+
 		g.drawSurface(screen)
 
+		g.drawMinimap(screen)
+
 		g.drawProgress(screen)
 
+		g.drawVersusProgress(screen)
+
 		g.drawScore(screen)
+
+		g.drawColorSwatches(screen)
 	default:
 		g.drawStars(screen, 1.0)
 
@@ -815,263 +1408,49 @@ func (g *Game) Draw(screen *ebiten.Image) {
 		}
 
 		for _, a := range g.areas {
-			a.Draw(screen)
-			a.DrawVertices(screen, 1.0)
+			a.Draw(screen, g.camera)
+			a.DrawVertices(screen, g.camera, 1.0)
 		}
 
 		for _, lines := range g.openingLineDrawOrder {
 			for _, line := range lines {
-				ebitenutil.DrawLine(screen, line[0].x, line[0].y, line[1].x, line[1].y, color.White)
+				g.camera.drawLine(screen, &line[0], &line[1], color.White)
 			}
 		}
 
 		for _, e := range g.triangleEffects {
-			e.Draw(screen)
+			e.Draw(screen, g.camera)
 		}
 
 		g.drawSurface(screen)
 
+		g.drawMinimap(screen)
+
 		g.drawProgress(screen)
 
+		g.drawVersusProgress(screen)
+
 		g.drawScore(screen)
 
 		g.drawGameOver(screen)
-	}
-}
-
-func (g *Game) Layout(outsideWidth, outsideHeight int) (int, int) {
-	return screenWidth, screenHeight
-}
-
-func (g *Game) setNextMode(mode GameMode) {
-	g.mode = mode
-	g.ticksFromModeStart = 0
-}
-
-func (g *Game) generateTriangles(seed *Triangle) []Triangle {
-	findLinesToExtend := func(triangles []Triangle) (lines []struct {
-		line *Line
-		pair *Triangle
-	}) {
-		for _, t := range triangles {
-			for i := 0; i < 3; i++ {
-				l := Line([2]Point{t[i%3], t[(i+1)%3]})
-
-				// Find pairs (a pair is a triangle that contains the same line)
-				trs := make([]Triangle, 0)
-				for _, tr := range triangles {
-					if tr.contains(&l) {
-						trs = append(trs, tr)
-					}
-				}
-
-				// A line can be contained by at most two triangles
-				if len(trs) > 1 {
-					continue
-				}
-
-				found := false
-				for _, item := range lines {
-					if item.line.equals(&l) {
-						found = true
-						break
-					}
-				}
-				if found {
-					continue
-				}
 
-				lines = append(lines, struct {
-					line *Line
-					pair *Triangle
-				}{line: &l, pair: &trs[0]})
-			}
+		if g.replayPlayer == nil {
+			g.drawExportButtons(screen)
 		}
-
-		center := Point{x: screenWidth / 2, y: screenHeight / 2}
-		sort.Slice(lines, func(i, j int) bool {
-			return lines[i].line.distanceSq(&center) < lines[j].line.distanceSq(&center)
-		})
-
-		return
 	}
 
-	extendLine := func(triangles []Triangle, line *Line, pair *Triangle) *Triangle {
-		v := line[1].sub(&line[0])
-
-		// Find the third point of the pair
-		var p Point
-		if (line[0] == pair[0] || line[0] == pair[1]) && (line[1] == pair[0] || line[1] == pair[1]) {
-			p = pair[2]
-		} else if (line[0] == pair[1] || line[0] == pair[2]) && (line[1] == pair[1] || line[1] == pair[2]) {
-			p = pair[0]
-		} else {
-			p = pair[1]
-		}
-
-		// Determine new point at the opposite side of the pair
-		theta := math.Pi/3 + math.Pi/4*g.random.NormFloat64()
-		if v.outerProdZ(p.sub(&line[0])) > 0 {
-			theta *= -1
-		}
-		newPoint := line[0].add(v.rotate(theta).div(v.norm()).mul(100.0))
-
-		// Ensure the new point is within the screen
-		newPoint.x = math.Max(newPoint.x, 5)
-		newPoint.x = math.Min(newPoint.x, screenWidth-5)
-		newPoint.y = math.Max(newPoint.y, 5)
-		newPoint.y = math.Min(newPoint.y, screenHeight-120)
-
-		triangle := Triangle{
-			line[0],
-			line[1],
-			*newPoint,
-		}
-
-		// Ensure the new triangle does not collide with existing ones
-		collide := false
-		for _, t := range triangles {
-			if t.equals(&triangle) || t.collidesWith(&triangle) {
-				collide = true
-				break
-			}
-		}
-		if collide {
-			return nil
-		}
-
-		// Ensure the new triangle has sufficient angles
-		for i := 0; i < 3; i++ {
-			v1 := triangle[(i+1)%3].sub(&triangle[i%3])
-			v2 := triangle[(i+2)%3].sub(&triangle[i%3])
-			cos := v1.innerProd(v2) / v1.norm() / v2.norm()
-			if cos > math.Cos(math.Pi/6) {
-				return nil
-			}
-		}
-
-		return &triangle
+	if g.replayPlayer != nil {
+		g.drawReplayControls(screen)
 	}
 
-	getNewTrianglesFromExistingPoints := func(triangles []Triangle) []Triangle {
-		newTriangles := make([]Triangle, 0)
-		for _, t1 := range triangles {
-			for i := 0; i < 3; i++ {
-				l1 := Line([2]Point{t1[i%3], t1[(i+1)%3]})
-				for _, t2 := range triangles {
-					for j := 0; j < 3; j++ {
-						l2 := Line([2]Point{t2[j%3], t2[(j+1)%3]})
-
-						if l1.equals(&l2) {
-							continue
-						}
-
-						// Make triangle from l1 and l2
-						var newTriangle Triangle
-						if l1[0] == l2[0] {
-							v1 := l1[1].sub(&l1[0])
-							v2 := l2[1].sub(&l2[0])
-							cos := v1.innerProd(v2) / v1.norm() / v2.norm()
-							if cos < 0 {
-								continue
-							}
-							newTriangle = [3]Point{l1[0], l1[1], l2[1]}
-						} else if l1[0] == l2[1] {
-							v1 := l1[1].sub(&l1[0])
-							v2 := l2[0].sub(&l2[1])
-							cos := v1.innerProd(v2) / v1.norm() / v2.norm()
-							if cos < 0 {
-								continue
-							}
-							newTriangle = [3]Point{l1[0], l1[1], l2[0]}
-						} else if l1[1] == l2[0] {
-							v1 := l1[0].sub(&l1[1])
-							v2 := l2[1].sub(&l2[0])
-							cos := v1.innerProd(v2) / v1.norm() / v2.norm()
-							if cos < 0 {
-								continue
-							}
-							newTriangle = [3]Point{l1[1], l1[0], l2[1]}
-						} else {
-							continue
-						}
-
-						// Ensure the new triangle does not collide with existing ones
-						collide := false
-						var trs []Triangle
-						trs = append(trs, triangles...)
-						trs = append(trs, newTriangles...)
-						for _, t := range trs {
-							if t.equals(&newTriangle) || t.collidesWith(&newTriangle) {
-								collide = true
-								break
-							}
-						}
-						if collide {
-							continue
-						}
-
-						// Ensure the new triangle has sufficient angles
-						for k := 0; k < 3; k++ {
-							v1 := newTriangle[(k+1)%3].sub(&newTriangle[k%3])
-							v2 := newTriangle[(k+2)%3].sub(&newTriangle[k%3])
-							cos := v1.innerProd(v2) / v1.norm() / v2.norm()
-							if cos > math.Cos(math.Pi/6) {
-								return nil
-							}
-						}
-
-						newTriangles = append(newTriangles, newTriangle)
-					}
-				}
-			}
-		}
-
-		return newTriangles
-	}
-
-	triangles := []Triangle{*seed}
-	for {
-		if len(triangles) > maxTriangleNum {
-			break
-		}
-
-		lines := findLinesToExtend(triangles)
-		if len(lines) == 0 {
-			break
-		}
-
-		found := false
-		for _, line := range lines {
-			for retry := 0; retry < 3; retry++ {
-				if t := extendLine(triangles, line.line, line.pair); t != nil {
-					found = true
-					triangles = append(triangles, *t)
-					break
-				}
-			}
-			if found {
-				break
-			}
-		}
-
-		if !found {
-			if len(triangles) < 10 {
-				continue
-			}
-
-			break
-		}
-
-		if newTriangles := getNewTrianglesFromExistingPoints(triangles); newTriangles == nil {
-			triangles = triangles[:1]
-			continue
-		} else {
-			triangles = append(triangles, newTriangles...)
-		}
+	if settings.DebugOverlay {
+		g.drawDebugOverlay(screen)
 	}
+}
 
-	return triangles
+func (g *Game) setNextMode(mode GameMode) {
+	g.mode = mode
+	g.ticksFromModeStart = 0
 }
 
 func (g *Game) getLinesWithDrawOrder(areas []Area) [][]Line {
@@ -1087,13 +1466,13 @@ func (g *Game) getLinesWithDrawOrder(areas []Area) [][]Line {
 	lineExists := func(line *Line, linesList [][]Line, newLines []Line) bool {
 		for _, ls := range linesList {
 			for _, l := range ls {
-				if l.equals(line) {
+				if l.Equals(line) {
 					return true
 				}
 			}
 		}
 		for _, l := range newLines {
-			if l.equals(line) {
+			if l.Equals(line) {
 				return true
 			}
 		}
@@ -1136,83 +1515,393 @@ func (g *Game) initialize() {
 	g.playID = playID
 
 	var seed int64
-	if g.fixedRandomSeed != 0 {
+	if g.replayPlayer != nil {
+		seed = g.replayPlayer.replay.Seed
+	} else if g.fixedRandomSeed != 0 {
 		seed = g.fixedRandomSeed
 	} else {
-		seed = time.Now().Unix()
+		seed = g.clock.Now().Unix()
 	}
 
-	loggingutil.SendLog(gameName, g.playerID, g.playID, map[string]interface{}{
-		"action": "initialize",
-		"seed":   seed,
+	g.sendEvent(InitializeEvent{
+		Seed: seed,
 	})
 
+	g.seed = seed
+	g.dailyDate = ""
+	g.code = nil
+	g.fromCode = false
 	g.random = rand.New(rand.NewSource(seed))
 	g.score = 0
+	g.optimumColorNum = 0
+	g.usedColorNum = 0
+	g.selectedColor = 0
+	g.marathonMapNum = 0
+	g.marathonTicksLeft = puzzle.MarathonTimeLimitTicks
+	g.zenFrontier = mapCenter
+	g.camera = &Camera{center: mapCenter, scale: 1.0}
+	g.cameraController = &CameraController{}
+	g.cameraTarget = mapCenter
+	g.fitCamera()
 	g.rankingCh = nil
+	g.exportNotice = ""
 	g.ranking = nil
-	g.starsImg = ebiten.NewImage(screenWidth, screenHeight)
 	g.shootingStars = nil
+
+	// Stars are rendered on the first draw so that the game can run headless
+	g.stars = nil
+	g.starsImg = nil
+	for i := 0; i < 500; i++ {
+		g.stars = append(g.stars, Star{
+			Point: Point{
+				X: screenWidth * g.random.Float64(),
+				Y: (screenHeight - 50) * g.random.Float64(),
+			},
+			r: math.Max(1.0+0.5*g.random.NormFloat64(), 0.5),
+		})
+	}
+
+	g.ticks = 0
+	g.recording = nil
+	_, g.hasReplay = g.storage.Load(replayStorageKey)
+
+	g.setNextMode(GameModeTitle)
+}
+
+// Ticks recorded in proofs, which are on the shared clock in the marathon
+func (g *Game) getPlayingTicks() int {
+	if g.rule.marathon {
+		return puzzle.MarathonTimeLimitTicks - g.marathonTicksLeft
+	}
+	return int(g.ticksFromModeStart)
+}
+
+// Get the current time, which is the recorded one while replaying
+func (g *Game) now() time.Time {
+	if g.replayPlayer != nil {
+		return g.replayPlayer.now(g.ticks)
+	}
+	return g.clock.Now()
+}
+
+func (g *Game) sendEvent(e TelemetryEvent) {
+	if g.replayPlayer != nil {
+		return
+	}
+	g.telemetry.Send(g.playerID, g.playID, e)
+}
+
+// Start the game with the rule, from which replays are recorded
+func (g *Game) startGame(ruleIndex int, inputStyle InputStyle) {
+	g.start(gameRules[ruleIndex], ruleIndex, nil, inputStyle)
+}
+
+// Start the game of the puzzle code, which is not ranked since anyone can pick its seed
+func (g *Game) startCode(code *puzzle.PuzzleCode, inputStyle InputStyle) {
+	g.seed = code.Seed
+	g.random = rand.New(rand.NewSource(g.seed))
+	g.start(getCodeRule(code), -1, code, inputStyle)
+}
+
+func (g *Game) start(rule GameRule, ruleIndex int, code *puzzle.PuzzleCode, inputStyle InputStyle) {
+	g.ticks = 0
+	g.recording = nil
+	if g.replayPlayer == nil {
+		g.recording = &Replay{
+			Version:    replayVersion,
+			Seed:       g.seed,
+			StartTime:  g.clock.Now().UnixMilli(),
+			Rule:       ruleIndex,
+			InputStyle: inputStyle,
+			Width:      g.width,
+			Height:     g.height,
+		}
+		if code != nil {
+			g.recording.Code = code.Encode()
+		}
+	}
+
+	if rule.daily {
+		date := g.now().UTC().Format(dailyDateFormat)
+		g.dailyDate = date
+		g.seed = puzzle.GetDailySeed(date)
+		g.random = rand.New(rand.NewSource(g.seed))
+	}
+
+	// Maps use their own random source so that they can be regenerated from the seed
+	g.mapRandom = rand.New(rand.NewSource(g.seed))
+
+	// Moves of the duel are made with the picked color
+	if rule.duel {
+		inputStyle = InputStylePalette
+	}
+
+	g.rule = rule
+	g.inputStyle = inputStyle
+	g.nextMap = nil
+	g.generateMap()
+
+	g.fromCode = code != nil
+	g.code = &puzzle.PuzzleCode{
+		GeneratorVersion: puzzle.GeneratorVersion,
+		Seed:             g.seed,
+		Mode:             getRuleMode(&rule),
+		ColorNum:         rule.colorNum,
+	}
+	if code != nil {
+		g.code.Givens = g.applyGivens(code.Givens)
+	}
+
+	g.duel = nil
+	if rule.duel {
+		g.startDuel()
+	}
+
+	// Zen and the duel are not ranked, so they need no proof
+	g.proof = nil
+	if !rule.zen && !rule.duel {
+		g.proof = puzzle.NewProof(g.seed, rule.colorNum, rule.minimizeColors, rule.marathon)
+		g.proof.Givens = g.code.Givens
+	}
+
+	g.setNextMode(GameModeOpening)
+
+	g.sendEvent(StartGameEvent{
+		Colors:         g.rule.colorNum,
+		MinimizeColors: g.rule.minimizeColors,
+		Daily:          g.dailyDate,
+		Marathon:       g.rule.marathon,
+		Zen:            g.rule.zen,
+		Duel:           g.rule.duel,
+		Seed:           g.seed,
+		Code:           g.code.Encode(),
+	})
+
+	g.sound.PlaySE(gameStartAudioData)
+}
+
+func (g *Game) generateMap() {
 	g.areas = nil
 	g.triangleEffects = nil
 	g.openingLineDrawOrder = nil
 
-	g.starsImg.Fill(color.Transparent)
-	for i := 0; i < 500; i++ {
-		ebitenutil.DrawCircle(
-			g.starsImg,
-			screenWidth*g.random.Float64(),
-			(screenHeight-50)*g.random.Float64(),
-			math.Max(1.0+0.5*g.random.NormFloat64(), 0.5),
-			color.White,
-		)
-	}
-
-	t0 := Triangle([3]Point{
-		{x: 1 * screenWidth / 2, y: 2 * screenHeight / 5},
-		{x: 2 * screenWidth / 5, y: 3 * screenHeight / 5},
-		{x: 3 * screenWidth / 5, y: 3 * screenHeight / 5},
-	})
-	triangles := g.generateTriangles(&t0)
-	for _, t := range triangles {
+	var triangles []puzzle.Triangle
+	if g.nextMap != nil {
+		// Waits only if the map has been completed faster than it is generated, which keeps
+		// the ticks of the maps the same as in the replays
+		triangles = <-g.nextMap
+		g.nextMap = nil
+	} else {
+		maxNum := puzzle.GetMaxTriangleNum(g.rule.marathon, g.marathonMapNum)
+		triangles = puzzle.GenerateMap(g.mapRandom, g.rule.colorNum, maxNum)
+	}
+	for i, t := range triangles {
 		g.areas = append(g.areas, Area{
 			Triangle: t,
+			id:       i,
 			color:    -1,
 			status:   AreaStatusInitial,
 		})
 	}
+	g.connectAreas()
+
+	g.openingLineDrawOrder = g.getLinesWithDrawOrder(g.areas)
+
+	g.fitCamera()
+
+	g.optimumColorNum = puzzle.GetChromaticNumber(puzzle.GetTriangleAdjacents(triangles))
+
+	if g.rule.marathon {
+		g.prefetchMap()
+	}
+}
+
+// Generate the next map of the marathon in the background, since larger maps take
+// seconds which would stop the frames. It is the only user of g.mapRandom meanwhile.
+func (g *Game) prefetchMap() {
+	random, colorNum := g.mapRandom, g.rule.colorNum
+	maxNum := puzzle.GetMaxTriangleNum(true, g.marathonMapNum+1)
+	next := make(chan []puzzle.Triangle, 1)
+	g.nextMap = next
+	go func() {
+		last := time.Now()
+		next <- puzzle.GenerateMapWithYield(random, colorNum, maxNum, func() {
+			// Lets the frames run, which matters on wasm having a single thread
+			if time.Since(last) > 4*time.Millisecond {
+				time.Sleep(time.Millisecond)
+				last = time.Now()
+			}
+		})
+	}()
+}
+
+// Rebuild adjacents and indices of all areas, which must be done whenever g.areas is reallocated
+func (g *Game) connectAreas() {
+	g.areaIndices = make(map[int]int)
+	lineAreas := make(map[Line][]*Area)
 	for i := range g.areas {
 		a := &g.areas[i]
-		for j := range g.areas {
-			b := &g.areas[j]
-			if a.Triangle.equals(&b.Triangle) {
-				continue
+		g.areaIndices[a.id] = i
+		a.adjacents = nil
+		for j := 0; j < 3; j++ {
+			l := Line([2]Point{a.Triangle[j], a.Triangle[(j+1)%3]})
+			key := l.Normalized()
+			lineAreas[key] = append(lineAreas[key], a)
+		}
+	}
+	for i := range g.areas {
+		a := &g.areas[i]
+		for j := 0; j < 3; j++ {
+			l := Line([2]Point{a.Triangle[j], a.Triangle[(j+1)%3]})
+			for _, b := range lineAreas[l.Normalized()] {
+				if b != a {
+					a.adjacents = append(a.adjacents, b)
+				}
 			}
-			if a.Triangle.shareLineWith(&b.Triangle) {
-				a.adjacents = append(a.adjacents, b)
+		}
+	}
+}
+
+// Extend the map toward the frontier, which moves away from the origin little by little.
+// Only triangles near the frontier are given to the generator so that it stays fast
+// however large the map grows. It returns false if no triangles are added.
+func (g *Game) extendZenMap() bool {
+	v := g.zenFrontier.Sub(&mapCenter)
+	theta := 2 * math.Pi * g.mapRandom.Float64()
+	if v.Norm() > 1 {
+		theta = math.Atan2(v.Y, v.X) + math.Pi/4*g.mapRandom.NormFloat64()
+	}
+	g.zenFrontier = *g.zenFrontier.Add(&Point{X: zenFrontierStep * math.Cos(theta), Y: zenFrontierStep * math.Sin(theta)})
+
+	var triangles []Triangle
+	for _, a := range g.areas {
+		triangles = append(triangles, a.Triangle)
+	}
+
+	near := append([]Triangle{}, triangles...)
+	sort.SliceStable(near, func(i, j int) bool {
+		return near[i].Center().Sub(&g.zenFrontier).Norm() < near[j].Center().Sub(&g.zenFrontier).Norm()
+	})
+	if len(near) > zenNearNum {
+		near = near[:zenNearNum]
+	}
+
+	generated := puzzle.GenerateTriangles(g.mapRandom, near, &puzzle.GenerateTrianglesOption{
+		MinNum:    len(near) + 1,
+		MaxNum:    len(near) + zenExtendNum,
+		Center:    g.zenFrontier,
+		Unbounded: true,
+	})
+
+	// Drop new triangles overlapping the ones which were not given to the generator
+	var candidates []Triangle
+	for _, t := range generated[len(near):] {
+		collide := false
+		for _, s := range triangles {
+			if s.Equals(&t) || s.CollidesWith(&t) {
+				collide = true
+				break
 			}
 		}
+		if !collide {
+			candidates = append(candidates, t)
+		}
 	}
 
-	g.openingLineDrawOrder = g.getLinesWithDrawOrder(g.areas)
+	// Keep only new triangles connected to the existing map
+	var added []Triangle
+	for found := true; found; {
+		found = false
+		for i := 0; i < len(candidates); i++ {
+			t := candidates[i]
+			connected := false
+			for _, s := range triangles {
+				if s.ShareLineWith(&t) {
+					connected = true
+					break
+				}
+			}
+			if !connected {
+				continue
+			}
 
-	g.setNextMode(GameModeTitle)
-}
+			triangles = append(triangles, t)
+			added = append(added, t)
+			candidates = append(candidates[:i], candidates[i+1:]...)
+			i--
+			found = true
+		}
+	}
 
-func main() {
-	if os.Getenv("GAME_LOGGING") == "1" {
-		secret, err := resources.ReadFile("resources/secret")
-		if err == nil {
-			logging.Enable(string(secret))
+	// The frontier may have gone where the map cannot grow, so it restarts from the newest area
+	if len(added) == 0 {
+		g.zenFrontier = *g.areas[len(g.areas)-1].Center()
+		return false
+	}
+
+	var newLines []Line
+	for _, t := range added {
+		g.areas = append(g.areas, Area{
+			Triangle: t,
+			id:       len(g.areas),
+			color:    -1,
+			status:   AreaStatusInitial,
+		})
+
+		for i := 0; i < 3; i++ {
+			l := Line([2]Point{t[i], t[(i+1)%3]})
+			exists := false
+			for _, lines := range append(g.openingLineDrawOrder, newLines) {
+				for _, m := range lines {
+					if m.Equals(&l) {
+						exists = true
+						break
+					}
+				}
+				if exists {
+					break
+				}
+			}
+			if !exists {
+				newLines = append(newLines, l)
+			}
 		}
-	} else {
-		logging.Disable()
+
+		g.triangleEffects = append(g.triangleEffects, TriangleEffect{
+			Triangle: t,
+			colorR:   1.0,
+			colorG:   1.0,
+			colorB:   1.0,
+		})
+	}
+	g.openingLineDrawOrder = append(g.openingLineDrawOrder, newLines)
+
+	g.connectAreas()
+
+	center := &Point{}
+	for _, t := range added {
+		center = center.Add(t.Center())
 	}
+	g.cameraTarget = *center.Div(float64(len(added)))
 
-	var randomSeed int64
-	if seed, err := strconv.Atoi(os.Getenv("GAME_RAND_SEED")); err == nil {
-		randomSeed = int64(seed)
+	g.sendEvent(ZenExtendEvent{
+		Areas: len(g.areas),
+	})
+	return true
+}
+
+func (g *Game) getRankingName() string {
+	daily := ""
+	if g.rule.daily {
+		daily = g.dailyDate
 	}
+	return puzzle.GetRankingName(g.rule.colorNum, g.rule.minimizeColors, g.rule.marathon, daily)
+}
+
+func main() {
+	loadResources()
+
+	telemetry := newTelemetrySink(os.Getenv("GAME_TELEMETRY"), platformStorage{})
 
 	playerID := os.Getenv("GAME_PLAYER_ID")
 	if playerID == "" {
@@ -1223,14 +1912,34 @@ func main() {
 
 	ebiten.SetWindowSize(screenWidth, screenHeight)
 	ebiten.SetWindowTitle("Four Color Theorem")
+	ebiten.SetWindowResizingMode(ebiten.WindowResizingModeEnabled)
 
 	game := &Game{
-		playerID:        playerID,
-		fixedRandomSeed: randomSeed,
-		touchContext:    touchutil.CreateTouchContext(),
+		playerID:     playerID,
+		touchContext: newEbitenInput(),
+		sound:        newAudioManager(bgmPlayer),
+		clock:        systemClock{},
+		telemetry:    telemetry,
+		storage:      platformStorage{},
+		width:        screenWidth,
+		height:       screenHeight,
+		uiScale:      1.0,
 	}
+	game.loadSettings()
 	game.initialize()
 
+	// Open the code entry or the versus lobby of a shared link, which starts by a tap to let browsers play sounds
+	if code := getLaunchParam("code"); code != "" {
+		game.codeInput = code
+		game.setNextMode(GameModeCode)
+	} else if room := getLaunchParam("room"); room != "" {
+		game.roomInput = room
+		game.roomCoop = getLaunchParam("coop") != ""
+		game.setNextMode(GameModeVersus)
+	}
+
+	game.applySettings()
+
 	if err := ebiten.RunGame(game); err != nil {
 		log.Fatal(err)
 	}
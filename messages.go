@@ -0,0 +1,255 @@
+package main
+
+// Languages are limited to the Latin script which the bundled font supports
+var languages = []string{"EN", "FR", "ES", "DE"}
+
+var messages = map[string]map[string]string{
+	"EN": {
+		"usage_cycle":     "[TAP] Change color  [PINCH/WHEEL] Zoom",
+		"usage_palette":   "[TAP] Paint with picked color",
+		"rule_colors":     "%d COLORS",
+		"rule_min_colors": "MIN COLORS",
+		"rule_daily":      "DAILY",
+		"rule_marathon":   "MARATHON",
+		"rule_zen":        "ZEN",
+		"rule_duel":       "DUEL",
+		"next":            "NEXT %s",
+		"map":             "MAP %d",
+		"end":             "END",
+		"complete":        "Complete!",
+		"your_time":       "Your time is %d:%02d (%d colors)",
+		"your_score":      "Your score is %d:%02d",
+		"used_optimum":    "You used %d, optimum is %d",
+		"next_puzzle":     "Next puzzle in %s",
+		"time_up":         "Time up!",
+		"completed_maps":  "You completed %d maps",
+		"well_done":       "Well done!",
+		"colored_regions": "You colored %d regions",
+		"settings":        "SETTINGS",
+		"back":            "BACK",
+		"master_volume":   "MASTER VOLUME",
+		"mute":            "MUTE",
+		"bgm_volume":      "BGM VOLUME",
+		"sfx_volume":      "SFX VOLUME",
+		"palette":         "PALETTE",
+		"patterns":        "PATTERNS",
+		"input":           "INPUT",
+		"input_cycle":     "CYCLE",
+		"input_palette":   "PICK",
+		"conflicts":       "CONFLICTS",
+		"language":        "LANGUAGE",
+		"captions":        "CAPTIONS",
+		"saved":           "SAVED",
+		"debug":           "DEBUG",
+		"code":            "CODE",
+		"code_usage":      "TYPE THE CODE SHARED BY A FRIEND",
+		"invalid_code":    "INVALID CODE",
+		"versus":          "VERSUS",
+		"race":            "RACE",
+		"coop":            "CO-OP",
+		"room":            "ROOM",
+		"join":            "JOIN",
+		"start":           "START",
+		"connecting":      "CONNECTING...",
+		"waiting":         "WAITING...",
+		"room_usage":      "SHARE THE ROOM WITH A FRIEND",
+		"turn":            "%s TURN",
+		"wins":            "%s WINS!",
+		"no_move":         "%s HAS NO MOVE",
+		"opponent":        "OPPONENT",
+		"human":           "HUMAN",
+		"replay":          "REPLAY",
+		"pause":           "PAUSE",
+		"play":            "PLAY",
+		"on":              "ON",
+		"off":             "OFF",
+	},
+	"FR": {
+		"usage_cycle":     "[TOUCHER] Couleur  [PINCER] Zoom",
+		"usage_palette":   "[TOUCHER] Peindre la couleur choisie",
+		"rule_colors":     "%d COULEURS",
+		"rule_min_colors": "COUL. MIN",
+		"rule_daily":      "DU JOUR",
+		"rule_marathon":   "MARATHON",
+		"rule_zen":        "ZEN",
+		"rule_duel":       "DUEL",
+		"next":            "SUIV. %s",
+		"map":             "CARTE %d",
+		"end":             "FIN",
+		"complete":        "Terminé !",
+		"your_time":       "Votre temps : %d:%02d (%d coul.)",
+		"your_score":      "Votre score : %d:%02d",
+		"used_optimum":    "Utilisées : %d, optimum : %d",
+		"next_puzzle":     "Prochain puzzle dans %s",
+		"time_up":         "Temps écoulé !",
+		"completed_maps":  "Cartes terminées : %d",
+		"well_done":       "Bravo !",
+		"colored_regions": "Régions coloriées : %d",
+		"settings":        "RÉGLAGES",
+		"back":            "RETOUR",
+		"master_volume":   "VOLUME GÉNÉRAL",
+		"mute":            "SILENCE",
+		"bgm_volume":      "VOLUME MUSIQUE",
+		"sfx_volume":      "VOLUME EFFETS",
+		"palette":         "PALETTE",
+		"patterns":        "MOTIFS",
+		"input":           "SAISIE",
+		"input_cycle":     "CYCLE",
+		"input_palette":   "CHOIX",
+		"conflicts":       "CONFLITS",
+		"language":        "LANGUE",
+		"captions":        "LÉGENDES",
+		"saved":           "ENREGISTRÉ",
+		"debug":           "DÉBOGAGE",
+		"code":            "CODE",
+		"code_usage":      "TAPEZ LE CODE D'UN AMI",
+		"invalid_code":    "CODE INVALIDE",
+		"versus":          "COURSE",
+		"race":            "COURSE",
+		"coop":            "COOP",
+		"room":            "SALLE",
+		"join":            "REJOINDRE",
+		"start":           "COMMENCER",
+		"connecting":      "CONNEXION...",
+		"waiting":         "ATTENTE...",
+		"room_usage":      "PARTAGEZ LA SALLE AVEC UN AMI",
+		"turn":            "TOUR DE %s",
+		"wins":            "%s GAGNE !",
+		"no_move":         "%s NE PEUT PLUS JOUER",
+		"opponent":        "ADVERSAIRE",
+		"human":           "HUMAIN",
+		"replay":          "REVOIR",
+		"pause":           "PAUSE",
+		"play":            "LECTURE",
+		"on":              "OUI",
+		"off":             "NON",
+	},
+	"ES": {
+		"usage_cycle":     "[TOCAR] Color  [PELLIZCAR] Zoom",
+		"usage_palette":   "[TOCAR] Pintar con el color elegido",
+		"rule_colors":     "%d COLORES",
+		"rule_min_colors": "MIN COLORES",
+		"rule_daily":      "DIARIO",
+		"rule_marathon":   "MARATÓN",
+		"rule_zen":        "ZEN",
+		"rule_duel":       "DUELO",
+		"next":            "SIG. %s",
+		"map":             "MAPA %d",
+		"end":             "FIN",
+		"complete":        "¡Completado!",
+		"your_time":       "Tu tiempo: %d:%02d (%d colores)",
+		"your_score":      "Tu puntuación: %d:%02d",
+		"used_optimum":    "Usaste %d, el óptimo es %d",
+		"next_puzzle":     "Siguiente puzzle en %s",
+		"time_up":         "¡Tiempo!",
+		"completed_maps":  "Completaste %d mapas",
+		"well_done":       "¡Bien hecho!",
+		"colored_regions": "Coloreaste %d regiones",
+		"settings":        "AJUSTES",
+		"back":            "VOLVER",
+		"master_volume":   "VOLUMEN GENERAL",
+		"mute":            "SILENCIO",
+		"bgm_volume":      "VOLUMEN MÚSICA",
+		"sfx_volume":      "VOLUMEN EFECTOS",
+		"palette":         "PALETA",
+		"patterns":        "PATRONES",
+		"input":           "ENTRADA",
+		"input_cycle":     "CICLO",
+		"input_palette":   "ELEGIR",
+		"conflicts":       "CONFLICTOS",
+		"language":        "IDIOMA",
+		"captions":        "LEYENDAS",
+		"saved":           "GUARDADO",
+		"debug":           "DEPURACIÓN",
+		"code":            "CÓDIGO",
+		"code_usage":      "ESCRIBE EL CÓDIGO DE UN AMIGO",
+		"invalid_code":    "CÓDIGO NO VÁLIDO",
+		"versus":          "CARRERA",
+		"race":            "CARRERA",
+		"coop":            "COOP",
+		"room":            "SALA",
+		"join":            "UNIRSE",
+		"start":           "EMPEZAR",
+		"connecting":      "CONECTANDO...",
+		"waiting":         "ESPERANDO...",
+		"room_usage":      "COMPARTE LA SALA CON UN AMIGO",
+		"turn":            "TURNO DE %s",
+		"wins":            "¡GANA %s!",
+		"no_move":         "%s NO PUEDE MOVER",
+		"opponent":        "RIVAL",
+		"human":           "HUMANO",
+		"replay":          "REPETICIÓN",
+		"pause":           "PAUSA",
+		"play":            "REANUDAR",
+		"on":              "SÍ",
+		"off":             "NO",
+	},
+	"DE": {
+		"usage_cycle":     "[TIPPEN] Farbe  [ZIEHEN] Zoom",
+		"usage_palette":   "[TIPPEN] Mit gewählter Farbe malen",
+		"rule_colors":     "%d FARBEN",
+		"rule_min_colors": "MIN FARBEN",
+		"rule_daily":      "TÄGLICH",
+		"rule_marathon":   "MARATHON",
+		"rule_zen":        "ZEN",
+		"rule_duel":       "DUELL",
+		"next":            "NÄCHST %s",
+		"map":             "KARTE %d",
+		"end":             "ENDE",
+		"complete":        "Geschafft!",
+		"your_time":       "Deine Zeit: %d:%02d (%d Farben)",
+		"your_score":      "Deine Punkte: %d:%02d",
+		"used_optimum":    "Benutzt: %d, Optimum: %d",
+		"next_puzzle":     "Nächstes Rätsel in %s",
+		"time_up":         "Zeit um!",
+		"completed_maps":  "%d Karten geschafft",
+		"well_done":       "Gut gemacht!",
+		"colored_regions": "%d Gebiete gefärbt",
+		"settings":        "OPTIONEN",
+		"back":            "ZURÜCK",
+		"master_volume":   "LAUTSTÄRKE",
+		"mute":            "STUMM",
+		"bgm_volume":      "MUSIK",
+		"sfx_volume":      "EFFEKTE",
+		"palette":         "PALETTE",
+		"patterns":        "MUSTER",
+		"input":           "EINGABE",
+		"input_cycle":     "ZYKLUS",
+		"input_palette":   "WAHL",
+		"conflicts":       "KONFLIKTE",
+		"language":        "SPRACHE",
+		"captions":        "BESCHRIFTUNG",
+		"saved":           "GESPEICHERT",
+		"debug":           "DEBUG",
+		"code":            "CODE",
+		"code_usage":      "GIB DEN CODE EINES FREUNDES EIN",
+		"invalid_code":    "UNGÜLTIGER CODE",
+		"versus":          "RENNEN",
+		"race":            "RENNEN",
+		"coop":            "KOOP",
+		"room":            "RAUM",
+		"join":            "BEITRETEN",
+		"start":           "STARTEN",
+		"connecting":      "VERBINDEN...",
+		"waiting":         "WARTEN...",
+		"room_usage":      "TEILE DEN RAUM MIT EINEM FREUND",
+		"turn":            "%s IST DRAN",
+		"wins":            "%s GEWINNT!",
+		"no_move":         "%s KANN NICHT ZIEHEN",
+		"opponent":        "GEGNER",
+		"human":           "MENSCH",
+		"replay":          "WIEDERHOLUNG",
+		"pause":           "PAUSE",
+		"play":            "WEITER",
+		"on":              "AN",
+		"off":             "AUS",
+	},
+}
+
+// Get the message for key in the language of the settings
+func msg(key string) string {
+	if m, ok := messages[settings.Language][key]; ok {
+		return m
+	}
+	return messages["EN"][key]
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"io"
+	"math"
+	"time"
+)
+
+// Key and tempo of the BGM, which coloring notes follow
+const (
+	musicRootNote   = 55 // G3
+	musicTempo      = 120
+	musicNoteLength = audioSampleRate / 4
+	musicAmplitude  = 0.2
+)
+
+// Minor pentatonic scale never clashes with the BGM
+var musicScale = []int{0, 3, 5, 7, 10}
+
+func midiToFrequency(note int) float64 {
+	return 440 * math.Pow(2, float64(note-69)/12)
+}
+
+// Get the frequency of the degree-th note in the scale, counting up over octaves
+func getScaleNoteFrequency(degree int) float64 {
+	octave, i := degree/len(musicScale), degree%len(musicScale)
+	return midiToFrequency(musicRootNote + 12*octave + musicScale[i])
+}
+
+// Get the number of samples until the next 16th note of the BGM
+func getBeatDelay(bgmPosition time.Duration) int {
+	unit := time.Minute / musicTempo / 4
+	d := unit - bgmPosition%unit
+	return int(d.Seconds() * audioSampleRate)
+}
+
+// toneStream synthesizes notes as 16bit stereo PCM for the audio stream API
+type toneStream struct {
+	frequencies []float64
+	delay       int
+	position    int
+}
+
+func newToneStream(frequency float64, delay int) *toneStream {
+	return newChordStream([]float64{frequency}, delay)
+}
+
+func newChordStream(frequencies []float64, delay int) *toneStream {
+	return &toneStream{
+		frequencies: frequencies,
+		delay:       delay,
+	}
+}
+
+func (s *toneStream) sample(i int) float64 {
+	if i < 0 {
+		return 0
+	}
+
+	t := float64(i) / audioSampleRate
+	envelope := math.Min(1.0, t/0.005) * math.Exp(-t*8)
+
+	v := 0.0
+	for _, f := range s.frequencies {
+		v += math.Sin(2*math.Pi*f*t) + 0.3*math.Sin(4*math.Pi*f*t)
+	}
+	return v / float64(len(s.frequencies)) * envelope * musicAmplitude
+}
+
+func (s *toneStream) Read(buf []byte) (int, error) {
+	end := s.delay + musicNoteLength
+	if s.position >= end {
+		return 0, io.EOF
+	}
+
+	n := 0
+	for ; n+4 <= len(buf) && s.position < end; n += 4 {
+		v := int16(s.sample(s.position-s.delay) * math.MaxInt16)
+		buf[n] = byte(v)
+		buf[n+1] = byte(v >> 8)
+		buf[n+2] = byte(v)
+		buf[n+3] = byte(v >> 8)
+		s.position++
+	}
+	return n, nil
+}
+
+// Play a note which climbs with the progress, and sounds consonant if the area is correct
+// and dissonant if it conflicts with the adjacents
+func (g *Game) playAreaNote(a *Area) {
+	degree := int(g.getProgress() * float64(len(musicScale)*2))
+	root := getScaleNoteFrequency(degree)
+
+	conflicted := false
+	for _, ad := range a.adjacents {
+		if a.color == ad.color {
+			conflicted = true
+			break
+		}
+	}
+
+	var frequencies []float64
+	if conflicted {
+		// Minor second and tritone
+		frequencies = []float64{root, root * math.Pow(2, 1.0/12), root * math.Pow(2, 6.0/12)}
+	} else {
+		// Fifth and octave
+		frequencies = []float64{root, root * 1.5, root * 2}
+	}
+
+	g.sound.PlayStream(newChordStream(frequencies, g.sound.getBeatDelay()))
+}
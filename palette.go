@@ -0,0 +1,165 @@
+package main
+
+import (
+	"image/color"
+
+	"github.com/tsujio/game-util/drawutil"
+)
+
+// Number of colors in every palette
+const paletteSize = 8
+
+type Palette struct {
+	name   string
+	colors [paletteSize][3]float32
+	alpha  float32
+}
+
+func rgb(r, g, b uint8) [3]float32 {
+	return [3]float32{float32(r) / 0xff, float32(g) / 0xff, float32(b) / 0xff}
+}
+
+// Selectable palettes. Color-blind safe ones are based on the Okabe-Ito palette,
+// and the first colors are ordered so that they are distinguishable to each type.
+var palettes = []Palette{
+	{
+		name: "DEFAULT",
+		colors: [paletteSize][3]float32{
+			{1.0, 0.0, 0.0},
+			{0.0, 1.0, 0.0},
+			{0.0, 0.0, 1.0},
+			{1.0, 1.0, 0.0},
+			{0.0, 1.0, 1.0},
+			{1.0, 0.0, 1.0},
+			{1.0, 0.5, 0.0},
+			{1.0, 1.0, 1.0},
+		},
+		alpha: 0.3,
+	},
+	{
+		name: "DEUTAN",
+		colors: [paletteSize][3]float32{
+			rgb(0x00, 0x72, 0xb2),
+			rgb(0xe6, 0x9f, 0x00),
+			rgb(0xf0, 0xe4, 0x42),
+			rgb(0xcc, 0x79, 0xa7),
+			rgb(0x56, 0xb4, 0xe9),
+			rgb(0xd5, 0x5e, 0x00),
+			rgb(0x00, 0x9e, 0x73),
+			rgb(0xff, 0xff, 0xff),
+		},
+		alpha: 0.45,
+	},
+	{
+		name: "PROTAN",
+		colors: [paletteSize][3]float32{
+			rgb(0x00, 0x72, 0xb2),
+			rgb(0xf0, 0xe4, 0x42),
+			rgb(0x56, 0xb4, 0xe9),
+			rgb(0xd5, 0x5e, 0x00),
+			rgb(0xe6, 0x9f, 0x00),
+			rgb(0xcc, 0x79, 0xa7),
+			rgb(0x00, 0x9e, 0x73),
+			rgb(0xff, 0xff, 0xff),
+		},
+		alpha: 0.45,
+	},
+	{
+		name: "TRITAN",
+		colors: [paletteSize][3]float32{
+			rgb(0xd5, 0x5e, 0x00),
+			rgb(0x00, 0x9e, 0x73),
+			rgb(0xcc, 0x79, 0xa7),
+			rgb(0xff, 0xff, 0xff),
+			rgb(0x00, 0x72, 0xb2),
+			rgb(0xe6, 0x9f, 0x00),
+			rgb(0x56, 0xb4, 0xe9),
+			rgb(0xf0, 0xe4, 0x42),
+		},
+		alpha: 0.45,
+	},
+	{
+		name: "HIGH CONTRAST",
+		colors: [paletteSize][3]float32{
+			{1.0, 0.0, 0.0},
+			{0.0, 1.0, 1.0},
+			{1.0, 1.0, 0.0},
+			{1.0, 0.0, 1.0},
+			{0.0, 1.0, 0.0},
+			{0.0, 0.0, 1.0},
+			{1.0, 1.0, 1.0},
+			{1.0, 0.5, 0.0},
+		},
+		alpha: 0.6,
+	},
+}
+
+func getPalette() *Palette {
+	if settings.Palette < 0 || settings.Palette >= len(palettes) {
+		return &palettes[0]
+	}
+	return &palettes[settings.Palette]
+}
+
+// Glyphs drawn on areas for each color index so that colors can be told apart by shape
+var colorPatternImgs = drawutil.CreatePatternImageArray([][][]rune{
+	{
+		[]rune("     "),
+		[]rune(" ### "),
+		[]rune(" ### "),
+		[]rune(" ### "),
+		[]rune("     "),
+	},
+	{
+		[]rune("  #  "),
+		[]rune("  #  "),
+		[]rune("#####"),
+		[]rune("  #  "),
+		[]rune("  #  "),
+	},
+	{
+		[]rune(" ### "),
+		[]rune("#   #"),
+		[]rune("#   #"),
+		[]rune("#   #"),
+		[]rune(" ### "),
+	},
+	{
+		[]rune("#   #"),
+		[]rune(" # # "),
+		[]rune("  #  "),
+		[]rune(" # # "),
+		[]rune("#   #"),
+	},
+	{
+		[]rune("     "),
+		[]rune("#####"),
+		[]rune("     "),
+		[]rune("#####"),
+		[]rune("     "),
+	},
+	{
+		[]rune("  #  "),
+		[]rune(" # # "),
+		[]rune("#   #"),
+		[]rune(" # # "),
+		[]rune("  #  "),
+	},
+	{
+		[]rune("# # #"),
+		[]rune("# # #"),
+		[]rune("# # #"),
+		[]rune("# # #"),
+		[]rune("# # #"),
+	},
+	{
+		[]rune("  #  "),
+		[]rune(" ### "),
+		[]rune("#####"),
+		[]rune("     "),
+		[]rune("#####"),
+	},
+}, &drawutil.CreatePatternImageOption[rune]{
+	Color:   color.White,
+	DotSize: 2,
+})
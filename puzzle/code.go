@@ -0,0 +1,169 @@
+package puzzle
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+)
+
+// Mode is the rule of the puzzle shared by a code
+type Mode int
+
+const (
+	ModeNormal Mode = iota
+	ModeMinimizeColors
+	ModeMarathon
+	ModeZen
+	ModeDuel
+)
+
+// Most colors that a map of any mode can be played with
+const MaxColorNum = 8
+
+// Given is an area colored from the start, which cannot be changed by the player
+type Given struct {
+	Area  int
+	Color int
+}
+
+func (g Given) MarshalJSON() ([]byte, error) {
+	return json.Marshal([2]int{g.Area, g.Color})
+}
+
+func (g *Given) UnmarshalJSON(data []byte) error {
+	var v [2]int
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	g.Area, g.Color = v[0], v[1]
+	return nil
+}
+
+// PuzzleCode identifies a puzzle so that anyone can play the same map from it
+type PuzzleCode struct {
+	GeneratorVersion int
+	Seed             int64
+	Mode             Mode
+	ColorNum         int
+	// Givens of the first map
+	Givens []Given
+}
+
+// Encode the code into a short URL-safe string, which ends with a checksum byte to detect typos
+func (c *PuzzleCode) Encode() string {
+	data := []byte{byte(c.GeneratorVersion)}
+	data = binary.AppendVarint(data, c.Seed)
+	data = append(data, byte(c.Mode), byte(c.ColorNum))
+	data = binary.AppendUvarint(data, uint64(len(c.Givens)))
+	for _, g := range c.Givens {
+		data = binary.AppendUvarint(data, uint64(g.Area))
+		data = append(data, byte(g.Color))
+	}
+	data = append(data, byte(crc32.ChecksumIEEE(data)))
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Decode the code into its data without the checksum, whose first byte is the generator version.
+// Unused bits of the last char must be zero, so that a typo of it is not ignored.
+func decodeCodeData(s string) ([]byte, error) {
+	data, err := base64.RawURLEncoding.Strict().DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid code: %w", err)
+	}
+	if len(data) < 2 || data[len(data)-1] != byte(crc32.ChecksumIEEE(data[:len(data)-1])) {
+		return nil, fmt.Errorf("invalid code: checksum mismatch")
+	}
+	return data[:len(data)-1], nil
+}
+
+// GetCodeGeneratorVersion gets the generator version of the code, which can be read
+// from the codes of other versions as well
+func GetCodeGeneratorVersion(s string) (int, error) {
+	data, err := decodeCodeData(s)
+	if err != nil {
+		return 0, err
+	}
+	return int(data[0]), nil
+}
+
+func DecodePuzzleCode(s string) (*PuzzleCode, error) {
+	data, err := decodeCodeData(s)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &PuzzleCode{GeneratorVersion: int(data[0])}
+	data = data[1:]
+
+	var n int
+	if c.Seed, n = binary.Varint(data); n <= 0 {
+		return nil, fmt.Errorf("invalid code: broken seed")
+	}
+	data = data[n:]
+
+	if len(data) < 2 {
+		return nil, fmt.Errorf("invalid code: too short")
+	}
+	c.Mode, c.ColorNum = Mode(data[0]), int(data[1])
+	data = data[2:]
+
+	givenNum, n := binary.Uvarint(data)
+	if n <= 0 || givenNum > uint64(len(data)) {
+		return nil, fmt.Errorf("invalid code: broken givens")
+	}
+	data = data[n:]
+	for i := uint64(0); i < givenNum; i++ {
+		area, n := binary.Uvarint(data)
+		if n <= 0 || n >= len(data) {
+			return nil, fmt.Errorf("invalid code: broken given %d", i)
+		}
+		c.Givens = append(c.Givens, Given{Area: int(area), Color: int(data[n])})
+		data = data[n+1:]
+	}
+	if len(data) != 0 {
+		return nil, fmt.Errorf("invalid code: trailing data")
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Validate the code can be played by this generator
+func (c *PuzzleCode) Validate() error {
+	if c.GeneratorVersion != GeneratorVersion {
+		return fmt.Errorf("unsupported generator version %d", c.GeneratorVersion)
+	}
+	if c.Mode < ModeNormal || c.Mode > ModeDuel {
+		return fmt.Errorf("invalid mode %d", c.Mode)
+	}
+	if c.ColorNum < 2 || c.ColorNum > MaxColorNum {
+		return fmt.Errorf("invalid color num %d", c.ColorNum)
+	}
+	for _, g := range c.Givens {
+		if g.Color < 0 || g.Color >= c.ColorNum {
+			return fmt.Errorf("invalid color %d of area %d", g.Color, g.Area)
+		}
+	}
+	return nil
+}
+
+// Apply the givens to the colors of the first map, which fails if they are out of the map
+// or conflict with each other
+func ApplyGivens(adjacents [][]int, colors []int, givens []Given) error {
+	for _, g := range givens {
+		if g.Area < 0 || g.Area >= len(colors) {
+			return fmt.Errorf("no area %d", g.Area)
+		}
+		for _, j := range adjacents[g.Area] {
+			if colors[j] == g.Color {
+				return fmt.Errorf("given of area %d conflicts with area %d", g.Area, j)
+			}
+		}
+		colors[g.Area] = g.Color
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package puzzle
+
+import (
+	"testing"
+)
+
+func TestPuzzleCodeRoundTrip(t *testing.T) {
+	codes := []*PuzzleCode{
+		{GeneratorVersion: GeneratorVersion, Seed: 1, Mode: ModeNormal, ColorNum: 4},
+		{GeneratorVersion: GeneratorVersion, Seed: -1 << 62, Mode: ModeDuel, ColorNum: MaxColorNum},
+		{GeneratorVersion: GeneratorVersion, Seed: 12345, Mode: ModeMinimizeColors, ColorNum: 3, Givens: []Given{{Area: 0, Color: 2}, {Area: 300, Color: 0}}},
+	}
+	for _, c := range codes {
+		s := c.Encode()
+		decoded, err := DecodePuzzleCode(s)
+		if err != nil {
+			t.Fatalf("%q: %v", s, err)
+		}
+		if decoded.GeneratorVersion != c.GeneratorVersion || decoded.Seed != c.Seed || decoded.Mode != c.Mode || decoded.ColorNum != c.ColorNum || len(decoded.Givens) != len(c.Givens) {
+			t.Fatalf("%+v decoded into %+v", c, decoded)
+		}
+		for i, g := range c.Givens {
+			if decoded.Givens[i] != g {
+				t.Fatalf("given %d of %+v decoded into %+v", i, c, decoded.Givens[i])
+			}
+		}
+	}
+}
+
+func TestDecodePuzzleCodeRejectsTypos(t *testing.T) {
+	c := &PuzzleCode{GeneratorVersion: GeneratorVersion, Seed: 12345, Mode: ModeNormal, ColorNum: 4, Givens: []Given{{Area: 1, Color: 2}}}
+	s := c.Encode()
+
+	for i := range s {
+		typo := []byte(s)
+		if typo[i] == 'A' {
+			typo[i] = 'B'
+		} else {
+			typo[i] = 'A'
+		}
+		if decoded, err := DecodePuzzleCode(string(typo)); err == nil {
+			t.Fatalf("%q with a typo at %d decoded into %+v", typo, i, decoded)
+		}
+	}
+	if decoded, err := DecodePuzzleCode(s + "!"); err == nil {
+		t.Fatalf("%q with an invalid char decoded into %+v", s+"!", decoded)
+	}
+}
+
+func TestDecodePuzzleCodeRejectsTruncated(t *testing.T) {
+	c := &PuzzleCode{GeneratorVersion: GeneratorVersion, Seed: 12345, Mode: ModeNormal, ColorNum: 4, Givens: []Given{{Area: 1, Color: 2}}}
+	s := c.Encode()
+
+	for i := 0; i < len(s); i++ {
+		if decoded, err := DecodePuzzleCode(s[:i]); err == nil {
+			t.Fatalf("%q truncated to %d decoded into %+v", s, i, decoded)
+		}
+	}
+}
+
+func TestGetCodeGeneratorVersion(t *testing.T) {
+	c := &PuzzleCode{GeneratorVersion: GeneratorVersion - 1, Seed: 1, Mode: ModeNormal, ColorNum: 4}
+	s := c.Encode()
+
+	if _, err := DecodePuzzleCode(s); err == nil {
+		t.Fatal("code of another generator version decoded")
+	}
+	if v, err := GetCodeGeneratorVersion(s); err != nil || v != c.GeneratorVersion {
+		t.Fatalf("generator version %d, %v", v, err)
+	}
+}
@@ -0,0 +1,112 @@
+package puzzle
+
+func GetTriangleAdjacents(triangles []Triangle) [][]int {
+	adjacents := make([][]int, len(triangles))
+	for i := range triangles {
+		for j := range triangles {
+			if i != j && triangles[i].ShareLineWith(&triangles[j]) {
+				adjacents[i] = append(adjacents[i], j)
+			}
+		}
+	}
+	return adjacents
+}
+
+// Find a coloring with colorNum colors by backtracking, or return nil if impossible
+func FindColoring(adjacents [][]int, colorNum int) []int {
+	colors := make([]int, len(adjacents))
+	for i := range colors {
+		colors[i] = -1
+	}
+
+	var solve func(i int) bool
+	solve = func(i int) bool {
+		if i == len(adjacents) {
+			return true
+		}
+		for c := 0; c < colorNum; c++ {
+			ok := true
+			for _, j := range adjacents[i] {
+				if colors[j] == c {
+					ok = false
+					break
+				}
+			}
+			if !ok {
+				continue
+			}
+			colors[i] = c
+			if solve(i + 1) {
+				return true
+			}
+		}
+		colors[i] = -1
+		return false
+	}
+
+	if !solve(0) {
+		return nil
+	}
+	return colors
+}
+
+// Minimum number of colors needed to color the map
+func GetChromaticNumber(adjacents [][]int) int {
+	for colorNum := 1; ; colorNum++ {
+		if FindColoring(adjacents, colorNum) != nil {
+			return colorNum
+		}
+	}
+}
+
+// Drop triangles until the rest can be colored with colorNum colors.
+// Triangles are colored greedily in BFS order from the seed and the ones
+// which cannot be colored are dropped, so the rest stays connected.
+func ReduceTrianglesToColorable(triangles []Triangle, colorNum int) []Triangle {
+	adjacents := GetTriangleAdjacents(triangles)
+	if FindColoring(adjacents, colorNum) != nil {
+		return triangles
+	}
+
+	colors := make([]int, len(triangles))
+	visited := make([]bool, len(triangles))
+	for i := range colors {
+		colors[i] = -1
+	}
+	colors[0] = 0
+	visited[0] = true
+	queue := []int{0}
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		for _, j := range adjacents[i] {
+			if visited[j] {
+				continue
+			}
+			visited[j] = true
+
+			for c := 0; c < colorNum; c++ {
+				used := false
+				for _, k := range adjacents[j] {
+					if colors[k] == c {
+						used = true
+						break
+					}
+				}
+				if !used {
+					colors[j] = c
+					queue = append(queue, j)
+					break
+				}
+			}
+		}
+	}
+
+	var reduced []Triangle
+	for i, t := range triangles {
+		if colors[i] != -1 {
+			reduced = append(reduced, t)
+		}
+	}
+	return reduced
+}
@@ -0,0 +1,133 @@
+package puzzle
+
+import (
+	"math/rand"
+)
+
+// DuelMove colors an uncolored area in the duel
+type DuelMove struct {
+	Area  int
+	Color int
+}
+
+// DuelState is a position of the duel, in which two players alternately color an uncolored
+// area with a color which no adjacent area has, and the player who cannot move loses
+type DuelState struct {
+	Adjacents [][]int
+	Colors    []int
+	ColorNum  int
+}
+
+func NewDuelState(adjacents [][]int, colors []int, colorNum int) *DuelState {
+	return &DuelState{
+		Adjacents: adjacents,
+		Colors:    append([]int{}, colors...),
+		ColorNum:  colorNum,
+	}
+}
+
+func (s *DuelState) IsLegal(m DuelMove) bool {
+	if m.Area < 0 || m.Area >= len(s.Colors) || s.Colors[m.Area] != -1 || m.Color < 0 || m.Color >= s.ColorNum {
+		return false
+	}
+	for _, j := range s.Adjacents[m.Area] {
+		if s.Colors[j] == m.Color {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *DuelState) LegalMoves() []DuelMove {
+	var moves []DuelMove
+	for i, c := range s.Colors {
+		if c != -1 {
+			continue
+		}
+		for color := 0; color < s.ColorNum; color++ {
+			if m := (DuelMove{Area: i, Color: color}); s.IsLegal(m) {
+				moves = append(moves, m)
+			}
+		}
+	}
+	return moves
+}
+
+func (s *DuelState) countLegalMoves() int {
+	n := 0
+	for i, c := range s.Colors {
+		if c != -1 {
+			continue
+		}
+		for color := 0; color < s.ColorNum; color++ {
+			if s.IsLegal(DuelMove{Area: i, Color: color}) {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func (s *DuelState) HasLegalMove() bool {
+	for i, c := range s.Colors {
+		if c != -1 {
+			continue
+		}
+		for color := 0; color < s.ColorNum; color++ {
+			if s.IsLegal(DuelMove{Area: i, Color: color}) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *DuelState) Play(m DuelMove) {
+	s.Colors[m.Area] = m.Color
+}
+
+func (s *DuelState) Undo(m DuelMove) {
+	s.Colors[m.Area] = -1
+}
+
+// Levels of the computer player of the duel
+const (
+	// Plays at random
+	DuelLevelRandom = iota + 1
+	// Plays the move leaving the fewest moves to the opponent
+	DuelLevelGreedy
+	// Searches the move tree with a node budget, which grows with the level above this
+	DuelLevelSearch
+)
+
+// FindDuelMove finds the move of the computer player, which returns false if there is no legal move
+func FindDuelMove(s *DuelState, level int, random *rand.Rand) (DuelMove, bool) {
+	moves := s.LegalMoves()
+	if len(moves) == 0 {
+		return DuelMove{}, false
+	}
+
+	if level <= DuelLevelRandom {
+		return moves[random.Intn(len(moves))], true
+	}
+	if level >= DuelLevelSearch {
+		search := NewDuelSearch(s, level, random)
+		for !search.Step(search.budget) {
+		}
+		return search.Best()
+	}
+
+	var best []DuelMove
+	bestCount := -1
+	for _, m := range moves {
+		s.Play(m)
+		n := s.countLegalMoves()
+		s.Undo(m)
+		if bestCount == -1 || n < bestCount {
+			best, bestCount = []DuelMove{m}, n
+		} else if n == bestCount {
+			best = append(best, m)
+		}
+	}
+	return best[random.Intn(len(best))], true
+}
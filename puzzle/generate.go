@@ -0,0 +1,324 @@
+package puzzle
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// GeneratorVersion must be bumped whenever generated maps change for the same seed
+const GeneratorVersion = 2
+
+// Maps are generated in map units, which are independent of the screen size.
+// The bottom margin is kept free for the surface when fitted to the screen.
+const (
+	MapWidth        = 640
+	MapHeight       = 480
+	MapBottomMargin = 120
+)
+
+const (
+	MaxTriangleNum             = 30
+	MarathonInitialTriangleNum = 10
+	MarathonTriangleNumStep    = 5
+)
+
+var MapCenter = Point{X: MapWidth / 2, Y: MapHeight / 2}
+
+// Number of triangles of a map, which grows for each map in the marathon
+func GetMaxTriangleNum(marathon bool, mapNum int) int {
+	if marathon {
+		return MarathonInitialTriangleNum + mapNum*MarathonTriangleNumStep
+	}
+	return MaxTriangleNum
+}
+
+// Generate a map which can be colored with colorNum colors. Maps with more triangles than
+// MaxTriangleNum are spread over a larger area, since the screen cannot hold them.
+func GenerateMap(random *rand.Rand, colorNum, maxNum int) []Triangle {
+	return GenerateMapWithYield(random, colorNum, maxNum, nil)
+}
+
+// GenerateMapWithYield is GenerateMap calling yield between its steps, with which
+// a generation in the background can let the other goroutines run
+func GenerateMapWithYield(random *rand.Rand, colorNum, maxNum int, yield func()) []Triangle {
+	t0 := Triangle([3]Point{
+		{X: 1 * MapWidth / 2, Y: 2 * MapHeight / 5},
+		{X: 2 * MapWidth / 5, Y: 3 * MapHeight / 5},
+		{X: 3 * MapWidth / 5, Y: 3 * MapHeight / 5},
+	})
+	triangles := GenerateTriangles(random, []Triangle{t0}, &GenerateTrianglesOption{
+		MinNum: 10,
+		MaxNum: maxNum,
+		Center: MapCenter,
+		Scale:  math.Max(math.Sqrt(float64(maxNum)/MaxTriangleNum), 1),
+		Yield:  yield,
+	})
+	return ReduceTrianglesToColorable(triangles, colorNum)
+}
+
+type GenerateTrianglesOption struct {
+	MinNum, MaxNum int
+	Center         Point
+	Unbounded      bool
+	// Scale of the bounds around their center, which are the screen if 0 or 1
+	Scale float64
+	// Called between the steps of the generation if not nil
+	Yield func()
+}
+
+// Grow triangles from the initial ones until there are opt.MaxNum triangles.
+// New triangles are added from the lines closest to opt.Center.
+func GenerateTriangles(random *rand.Rand, initial []Triangle, opt *GenerateTrianglesOption) []Triangle {
+	minBound, maxBound := Point{X: 5, Y: 5}, Point{X: MapWidth - 5, Y: MapHeight - MapBottomMargin}
+	if opt.Scale > 1 {
+		c := minBound.Add(&maxBound).Div(2)
+		minBound = *c.Add(minBound.Sub(c).Mul(opt.Scale))
+		maxBound = *c.Add(maxBound.Sub(c).Mul(opt.Scale))
+	}
+
+	findLinesToExtend := func(triangles []Triangle) (lines []struct {
+		line *Line
+		pair *Triangle
+	}) {
+		for _, t := range triangles {
+			for i := 0; i < 3; i++ {
+				l := Line([2]Point{t[i%3], t[(i+1)%3]})
+
+				// Find pairs (a pair is a triangle that contains the same line)
+				trs := make([]Triangle, 0)
+				for _, tr := range triangles {
+					if tr.Contains(&l) {
+						trs = append(trs, tr)
+					}
+				}
+
+				// A line can be contained by at most two triangles
+				if len(trs) > 1 {
+					continue
+				}
+
+				found := false
+				for _, item := range lines {
+					if item.line.Equals(&l) {
+						found = true
+						break
+					}
+				}
+				if found {
+					continue
+				}
+
+				lines = append(lines, struct {
+					line *Line
+					pair *Triangle
+				}{line: &l, pair: &trs[0]})
+			}
+		}
+
+		sort.Slice(lines, func(i, j int) bool {
+			return lines[i].line.DistanceSq(&opt.Center) < lines[j].line.DistanceSq(&opt.Center)
+		})
+
+		return
+	}
+
+	extendLine := func(triangles []Triangle, line *Line, pair *Triangle) *Triangle {
+		v := line[1].Sub(&line[0])
+
+		// Find the third point of the pair
+		var p Point
+		if (line[0] == pair[0] || line[0] == pair[1]) && (line[1] == pair[0] || line[1] == pair[1]) {
+			p = pair[2]
+		} else if (line[0] == pair[1] || line[0] == pair[2]) && (line[1] == pair[1] || line[1] == pair[2]) {
+			p = pair[0]
+		} else {
+			p = pair[1]
+		}
+
+		// Determine new point at the opposite side of the pair
+		theta := math.Pi/3 + math.Pi/4*random.NormFloat64()
+		if v.OuterProdZ(p.Sub(&line[0])) > 0 {
+			theta *= -1
+		}
+		newPoint := line[0].Add(v.Rotate(theta).Div(v.Norm()).Mul(100.0))
+
+		// Ensure the new point is within the bounds
+		if !opt.Unbounded {
+			newPoint.X = math.Max(newPoint.X, minBound.X)
+			newPoint.X = math.Min(newPoint.X, maxBound.X)
+			newPoint.Y = math.Max(newPoint.Y, minBound.Y)
+			newPoint.Y = math.Min(newPoint.Y, maxBound.Y)
+		}
+
+		triangle := Triangle{
+			line[0],
+			line[1],
+			*newPoint,
+		}
+
+		// Ensure the new triangle does not collide with existing ones
+		collide := false
+		for _, t := range triangles {
+			if t.Equals(&triangle) || t.CollidesWith(&triangle) {
+				collide = true
+				break
+			}
+		}
+		if collide {
+			return nil
+		}
+
+		// Ensure the new triangle has sufficient angles
+		for i := 0; i < 3; i++ {
+			v1 := triangle[(i+1)%3].Sub(&triangle[i%3])
+			v2 := triangle[(i+2)%3].Sub(&triangle[i%3])
+			cos := v1.InnerProd(v2) / v1.Norm() / v2.Norm()
+			if cos > math.Cos(math.Pi/6) {
+				return nil
+			}
+		}
+
+		return &triangle
+	}
+
+	getNewTrianglesFromExistingPoints := func(triangles []Triangle) []Triangle {
+		newTriangles := make([]Triangle, 0)
+		tried := make(map[Triangle]bool)
+		for _, t1 := range triangles {
+			if opt.Yield != nil {
+				opt.Yield()
+			}
+			for i := 0; i < 3; i++ {
+				l1 := Line([2]Point{t1[i%3], t1[(i+1)%3]})
+				for _, t2 := range triangles {
+					for j := 0; j < 3; j++ {
+						l2 := Line([2]Point{t2[j%3], t2[(j+1)%3]})
+
+						if l1.Equals(&l2) {
+							continue
+						}
+
+						// Make triangle from l1 and l2
+						var newTriangle Triangle
+						if l1[0] == l2[0] {
+							v1 := l1[1].Sub(&l1[0])
+							v2 := l2[1].Sub(&l2[0])
+							cos := v1.InnerProd(v2) / v1.Norm() / v2.Norm()
+							if cos < 0 {
+								continue
+							}
+							newTriangle = [3]Point{l1[0], l1[1], l2[1]}
+						} else if l1[0] == l2[1] {
+							v1 := l1[1].Sub(&l1[0])
+							v2 := l2[0].Sub(&l2[1])
+							cos := v1.InnerProd(v2) / v1.Norm() / v2.Norm()
+							if cos < 0 {
+								continue
+							}
+							newTriangle = [3]Point{l1[0], l1[1], l2[0]}
+						} else if l1[1] == l2[0] {
+							v1 := l1[0].Sub(&l1[1])
+							v2 := l2[1].Sub(&l2[0])
+							cos := v1.InnerProd(v2) / v1.Norm() / v2.Norm()
+							if cos < 0 {
+								continue
+							}
+							newTriangle = [3]Point{l1[1], l1[0], l2[1]}
+						} else {
+							continue
+						}
+
+						// The same triangle made from another pair of lines is added or collides
+						// as the first one, so it is not tested again
+						if tried[newTriangle] {
+							continue
+						}
+						tried[newTriangle] = true
+
+						// Ensure the new triangle does not collide with existing ones
+						collide := false
+						var trs []Triangle
+						trs = append(trs, triangles...)
+						trs = append(trs, newTriangles...)
+						for _, t := range trs {
+							if t.Equals(&newTriangle) || t.CollidesWith(&newTriangle) {
+								collide = true
+								break
+							}
+						}
+						if collide {
+							continue
+						}
+
+						// Ensure the new triangle has sufficient angles
+						for k := 0; k < 3; k++ {
+							v1 := newTriangle[(k+1)%3].Sub(&newTriangle[k%3])
+							v2 := newTriangle[(k+2)%3].Sub(&newTriangle[k%3])
+							cos := v1.InnerProd(v2) / v1.Norm() / v2.Norm()
+							if cos > math.Cos(math.Pi/6) {
+								return nil
+							}
+						}
+
+						newTriangles = append(newTriangles, newTriangle)
+					}
+				}
+			}
+		}
+
+		return newTriangles
+	}
+
+	triangles := append([]Triangle{}, initial...)
+	backoff := 0
+	for {
+		if len(triangles) > opt.MaxNum {
+			break
+		}
+
+		lines := findLinesToExtend(triangles)
+		if len(lines) == 0 {
+			break
+		}
+
+		found := false
+		for _, line := range lines {
+			for retry := 0; retry < 3; retry++ {
+				if t := extendLine(triangles, line.line, line.pair); t != nil {
+					found = true
+					triangles = append(triangles, *t)
+					break
+				}
+			}
+			if found {
+				break
+			}
+		}
+
+		if !found {
+			if len(triangles) < opt.MinNum {
+				continue
+			}
+
+			break
+		}
+
+		if newTriangles := getNewTrianglesFromExistingPoints(triangles); newTriangles == nil {
+			// Starting over is cheap for maps within the screen, while larger maps would hardly
+			// be finished, so they back off more triangles for each failure in a row
+			if opt.Scale > 1 {
+				backoff++
+				triangles = triangles[:int(math.Max(float64(len(triangles)-backoff), float64(len(initial))))]
+			} else {
+				triangles = triangles[:len(initial)]
+			}
+			continue
+		} else {
+			backoff = 0
+			triangles = append(triangles, newTriangles...)
+		}
+	}
+
+	return triangles
+}
@@ -0,0 +1,180 @@
+package puzzle
+
+import (
+	"math"
+)
+
+type Point struct {
+	X, Y float64
+}
+
+func (p *Point) Norm() float64 {
+	return math.Sqrt(math.Pow(p.X, 2) + math.Pow(p.Y, 2))
+}
+
+func (p *Point) Add(q *Point) *Point {
+	return &Point{X: p.X + q.X, Y: p.Y + q.Y}
+}
+
+func (p *Point) Sub(q *Point) *Point {
+	return &Point{X: p.X - q.X, Y: p.Y - q.Y}
+}
+
+func (p *Point) Mul(a float64) *Point {
+	return &Point{X: p.X * a, Y: p.Y * a}
+}
+
+func (p *Point) Div(a float64) *Point {
+	return &Point{X: p.X / a, Y: p.Y / a}
+}
+
+func (p *Point) InnerProd(q *Point) float64 {
+	return p.X*q.X + p.Y*q.Y
+}
+
+func (p *Point) OuterProdZ(q *Point) float64 {
+	return p.X*q.Y - p.Y*q.X
+}
+
+func (p *Point) Rotate(theta float64) *Point {
+	return &Point{X: math.Cos(theta)*p.X - math.Sin(theta)*p.Y, Y: math.Sin(theta)*p.X + math.Cos(theta)*p.Y}
+}
+
+type Line [2]Point
+
+// Line with its points in a canonical order, which can be used as a map key
+func (l *Line) Normalized() Line {
+	if l[1].X < l[0].X || l[1].X == l[0].X && l[1].Y < l[0].Y {
+		return Line{l[1], l[0]}
+	}
+	return *l
+}
+
+func (l *Line) Equals(m *Line) bool {
+	return l[0] == m[0] && l[1] == m[1] || l[0] == m[1] && l[1] == m[0]
+}
+
+func (l *Line) Cross(m *Line) bool {
+	z := l[1].Sub(&l[0]).OuterProdZ(m[1].Sub(&m[0]))
+	if math.Abs(z) < 1e-3 {
+		return false
+	}
+
+	v := m[0].Sub(&l[0])
+	z1 := v.OuterProdZ(l[1].Sub(&l[0]))
+	z2 := v.OuterProdZ(m[1].Sub(&m[0]))
+	t1 := z2 / z
+	t2 := z1 / z
+
+	return 0 <= t1 && t1 <= 1 && 0 <= t2 && t2 <= 1
+}
+
+func (l *Line) NormSq() float64 {
+	return math.Pow(l[0].X-l[1].X, 2) + math.Pow(l[0].Y-l[1].Y, 2)
+}
+
+func (l *Line) DistanceSq(p *Point) float64 {
+	return math.Pow((l[1].X-l[0].X)*(l[0].Y-p.Y)-(l[1].Y-l[0].Y)*(l[0].X-p.X), 2) / l.NormSq()
+}
+
+type Triangle [3]Point
+
+func (t *Triangle) Equals(s *Triangle) bool {
+	return t[0] == s[0] && t[1] == s[1] && t[2] == s[2] ||
+		t[0] == s[0] && t[1] == s[2] && t[2] == s[1] ||
+		t[0] == s[1] && t[1] == s[0] && t[2] == s[2] ||
+		t[0] == s[1] && t[1] == s[2] && t[2] == s[0] ||
+		t[0] == s[2] && t[1] == s[1] && t[2] == s[0] ||
+		t[0] == s[2] && t[1] == s[0] && t[2] == s[1]
+}
+
+func (t *Triangle) Center() *Point {
+	return t[0].Add(&t[1]).Add(&t[2]).Div(3)
+}
+
+func (t *Triangle) Covers(p *Point) bool {
+	v0 := t[0].Sub(&t[1])
+	v1 := t[1].Sub(&t[2])
+	v2 := t[2].Sub(&t[0])
+
+	vp0 := p.Sub(&t[0])
+	vp1 := p.Sub(&t[1])
+	vp2 := p.Sub(&t[2])
+
+	z0 := v0.OuterProdZ(vp0)
+	z1 := v1.OuterProdZ(vp1)
+	z2 := v2.OuterProdZ(vp2)
+
+	return z0 > 0 && z1 > 0 && z2 > 0 || z0 < 0 && z1 < 0 && z2 < 0
+}
+
+func (t *Triangle) Contains(l *Line) bool {
+	return (l[0] == t[0] || l[0] == t[1] || l[0] == t[2]) &&
+		(l[1] == t[0] || l[1] == t[1] || l[1] == t[2])
+}
+
+func (t *Triangle) ShareLineWith(s *Triangle) bool {
+	for i := 0; i < 3; i++ {
+		l := Line([2]Point{s[i%3], s[(i+1)%3]})
+		if t.Contains(&l) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Triangle) bounds() (minP, maxP Point) {
+	minP, maxP = t[0], t[0]
+	for _, p := range t[1:] {
+		minP.X, minP.Y = math.Min(minP.X, p.X), math.Min(minP.Y, p.Y)
+		maxP.X, maxP.Y = math.Max(maxP.X, p.X), math.Max(maxP.Y, p.Y)
+	}
+	return
+}
+
+func (t *Triangle) CollidesWith(s *Triangle) bool {
+	// Triangles apart by their bounds are not tested further, which makes map generation fast
+	const margin = 1e-3
+	tMin, tMax := t.bounds()
+	sMin, sMax := s.bounds()
+	if tMax.X+margin < sMin.X || sMax.X+margin < tMin.X || tMax.Y+margin < sMin.Y || sMax.Y+margin < tMin.Y {
+		return false
+	}
+
+	ts := []*Triangle{t, s, t}
+
+	for tsi := 0; tsi < 2; tsi++ {
+		t1 := ts[tsi]
+		t2 := ts[tsi+1]
+
+		for i := 0; i < 3; i++ {
+			v := t1[(i+1)%3].Sub(&t1[i%3])
+			sep := &Point{X: v.Y, Y: -v.X}
+			sep = sep.Div(sep.Norm())
+
+			t1p1 := sep.InnerProd(&t1[i%3])
+			t1p2 := sep.InnerProd(&t1[(i+2)%3])
+			t1pMin := math.Min(t1p1, t1p2)
+			t1pMax := math.Max(t1p1, t1p2)
+
+			t2p1 := sep.InnerProd(&t2[0])
+			t2p2 := sep.InnerProd(&t2[1])
+			t2p3 := sep.InnerProd(&t2[2])
+			t2pMin := math.Min(t2p1, t2p2)
+			t2pMin = math.Min(t2pMin, t2p3)
+			t2pMax := math.Max(t2p1, t2p2)
+			t2pMax = math.Max(t2pMax, t2p3)
+
+			if t2pMin <= t1pMin && t1pMin < t2pMax ||
+				t2pMin < t1pMax && t1pMax <= t2pMax ||
+				t1pMin <= t2pMin && t2pMin < t1pMax ||
+				t1pMin < t2pMax && t2pMax <= t1pMax {
+				continue
+			}
+
+			return false
+		}
+	}
+
+	return true
+}
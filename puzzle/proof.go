@@ -0,0 +1,237 @@
+package puzzle
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+)
+
+// Ticks between the color events of a map at least, which are made by taps of the player.
+// It is about the fastest a player can tap, so that forged proofs cannot color maps at once.
+const MinColorEventInterval = 4
+
+// Proof is a compact record of a game sent along with the score,
+// from which the score can be verified by regenerating the maps.
+type Proof struct {
+	GeneratorVersion int          `json:"v"`
+	Seed             int64        `json:"s"`
+	ColorNum         int          `json:"c"`
+	MinimizeColors   bool         `json:"m,omitempty"`
+	Marathon         bool         `json:"r,omitempty"`
+	Givens           []Given      `json:"g,omitempty"`
+	Events           []ColorEvent `json:"e"`
+}
+
+// ColorEvent is a color change of an area. Ticks are counted from the start of playing,
+// and in the marathon they are the ticks elapsed on the shared clock.
+type ColorEvent struct {
+	Ticks int
+	Map   int
+	Area  int
+	Color int
+}
+
+func (e ColorEvent) MarshalJSON() ([]byte, error) {
+	return json.Marshal([4]int{e.Ticks, e.Map, e.Area, e.Color})
+}
+
+func (e *ColorEvent) UnmarshalJSON(data []byte) error {
+	var v [4]int
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	e.Ticks, e.Map, e.Area, e.Color = v[0], v[1], v[2], v[3]
+	return nil
+}
+
+func NewProof(seed int64, colorNum int, minimizeColors, marathon bool) *Proof {
+	return &Proof{
+		GeneratorVersion: GeneratorVersion,
+		Seed:             seed,
+		ColorNum:         colorNum,
+		MinimizeColors:   minimizeColors,
+		Marathon:         marathon,
+	}
+}
+
+func (p *Proof) AddEvent(ticks, mapNum, area, color int) {
+	p.Events = append(p.Events, ColorEvent{Ticks: ticks, Map: mapNum, Area: area, Color: color})
+}
+
+// Encode the proof into a URL-safe string
+func (p *Proof) Encode() (string, error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func DecodeProof(s string) (*Proof, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var p Proof
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+type VerifyResult struct {
+	Score int
+	// Ticks when the last map was completed
+	Ticks           int
+	CompletedMapNum int
+	UsedColorNum    int
+	OptimumColorNum int
+}
+
+// Verify regenerates the maps, re-applies the events and returns the score they achieve.
+// The marathon scores the number of maps completed in time, and the others score the ticks to complete.
+// Proofs of rankings have no givens, since games of puzzle codes are not ranked.
+func Verify(p *Proof) (*VerifyResult, error) {
+	if len(p.Givens) > 0 {
+		return nil, fmt.Errorf("givens are not allowed in ranked games")
+	}
+	return verify(p)
+}
+
+// VerifyCode verifies the proof of a game of a puzzle code, whose givens are colored before the events.
+// Its score must never be ranked, since the givens may color all areas but one.
+func VerifyCode(p *Proof) (*VerifyResult, error) {
+	return verify(p)
+}
+
+func verify(p *Proof) (*VerifyResult, error) {
+	if p.GeneratorVersion != GeneratorVersion {
+		return nil, fmt.Errorf("unsupported generator version %d", p.GeneratorVersion)
+	}
+	if p.ColorNum < 2 {
+		return nil, fmt.Errorf("invalid color num %d", p.ColorNum)
+	}
+
+	random := rand.New(rand.NewSource(p.Seed))
+	result := &VerifyResult{}
+
+	var adjacents [][]int
+	var colors []int
+	newMap := func() {
+		triangles := GenerateMap(random, p.ColorNum, GetMaxTriangleNum(p.Marathon, result.CompletedMapNum))
+		adjacents = GetTriangleAdjacents(triangles)
+		colors = make([]int, len(triangles))
+		for i := range colors {
+			colors[i] = -1
+		}
+	}
+	newMap()
+	if err := ApplyGivens(adjacents, colors, p.Givens); err != nil {
+		return nil, err
+	}
+	given := make(map[int]bool)
+	for _, g := range p.Givens {
+		given[g.Area] = true
+	}
+
+	lastTicks, lastMap := 0, -1
+	for i, e := range p.Events {
+		// Taps are made on the release of touches started while playing, which is never at tick 0
+		if e.Ticks < 1 {
+			return nil, fmt.Errorf("event %d: before playing", i)
+		}
+		if e.Ticks <= lastTicks {
+			return nil, fmt.Errorf("event %d: ticks do not increase", i)
+		}
+		if e.Map == lastMap && e.Ticks-lastTicks < MinColorEventInterval {
+			return nil, fmt.Errorf("event %d: faster than taps", i)
+		}
+		lastTicks, lastMap = e.Ticks, e.Map
+		if p.Marathon && e.Ticks > MarathonTimeLimitTicks {
+			return nil, fmt.Errorf("event %d: after the time limit", i)
+		}
+		if e.Map != result.CompletedMapNum {
+			return nil, fmt.Errorf("event %d: map %d is not being played", i, e.Map)
+		}
+		if e.Area < 0 || e.Area >= len(colors) {
+			return nil, fmt.Errorf("event %d: no area %d", i, e.Area)
+		}
+		if e.Map == 0 && given[e.Area] {
+			return nil, fmt.Errorf("event %d: area %d is given", i, e.Area)
+		}
+		if e.Color < -1 || e.Color >= p.ColorNum {
+			return nil, fmt.Errorf("event %d: invalid color %d", i, e.Color)
+		}
+
+		colors[e.Area] = e.Color
+
+		if !IsCompleted(adjacents, colors) {
+			continue
+		}
+
+		result.CompletedMapNum++
+		result.Ticks = e.Ticks
+
+		if p.Marathon {
+			newMap()
+			continue
+		}
+
+		if i != len(p.Events)-1 {
+			return nil, fmt.Errorf("event %d: events after completion", i)
+		}
+
+		used := make(map[int]bool)
+		for _, c := range colors {
+			used[c] = true
+		}
+		result.UsedColorNum = len(used)
+		result.OptimumColorNum = GetChromaticNumber(adjacents)
+
+		result.Score = e.Ticks
+		if p.MinimizeColors {
+			result.Score = GetMinimizeColorsScore(e.Ticks, result.UsedColorNum, result.OptimumColorNum)
+		}
+		return result, nil
+	}
+
+	if p.Marathon {
+		result.Score = result.CompletedMapNum
+		return result, nil
+	}
+
+	return nil, fmt.Errorf("not completed")
+}
+
+// Regenerate the last map played in the proof, and get it with the colors after the events
+func (p *Proof) GetLastMap() ([]Triangle, []int) {
+	mapNum := 0
+	for _, e := range p.Events {
+		if e.Map > mapNum {
+			mapNum = e.Map
+		}
+	}
+
+	random := rand.New(rand.NewSource(p.Seed))
+	var triangles []Triangle
+	for i := 0; i <= mapNum; i++ {
+		triangles = GenerateMap(random, p.ColorNum, GetMaxTriangleNum(p.Marathon, i))
+	}
+
+	colors := make([]int, len(triangles))
+	for i := range colors {
+		colors[i] = -1
+	}
+	if mapNum == 0 {
+		// Givens which cannot be applied are left uncolored since such proofs are never verified
+		ApplyGivens(GetTriangleAdjacents(triangles), colors, p.Givens)
+	}
+	for _, e := range p.Events {
+		if e.Map == mapNum && e.Area >= 0 && e.Area < len(colors) {
+			colors[e.Area] = e.Color
+		}
+	}
+
+	return triangles, colors
+}
@@ -0,0 +1,101 @@
+package puzzle
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// Make the proof of a game completed by coloring the map of the seed with the interval
+func newSolvedProof(t *testing.T, seed int64, colorNum, interval int) *Proof {
+	t.Helper()
+	triangles := GenerateMap(rand.New(rand.NewSource(seed)), colorNum, GetMaxTriangleNum(false, 0))
+	colors := FindColoring(GetTriangleAdjacents(triangles), colorNum)
+	if colors == nil {
+		t.Fatalf("map of seed %d cannot be colored with %d colors", seed, colorNum)
+	}
+
+	p := NewProof(seed, colorNum, false, false)
+	for i, c := range colors {
+		p.AddEvent(2+i*interval, 0, i, c)
+	}
+	return p
+}
+
+func TestVerify(t *testing.T) {
+	p := newSolvedProof(t, 1, 4, MinColorEventInterval)
+	s, err := p.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeProof(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Verify(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := p.Events[len(p.Events)-1].Ticks
+	if result.Score != last || result.Ticks != last || result.CompletedMapNum != 1 {
+		t.Fatalf("unexpected result %+v, last tick %d", result, last)
+	}
+}
+
+func TestVerifyRejectsForgedTicks(t *testing.T) {
+	tests := []struct {
+		name  string
+		forge func(p *Proof)
+	}{
+		{
+			name: "all at tick 1",
+			forge: func(p *Proof) {
+				for i := range p.Events {
+					p.Events[i].Ticks = 1
+				}
+			},
+		},
+		{
+			name:  "tick 0",
+			forge: func(p *Proof) { p.Events[0].Ticks = 0 },
+		},
+		{
+			name:  "same tick",
+			forge: func(p *Proof) { p.Events[1].Ticks = p.Events[0].Ticks },
+		},
+		{
+			name:  "backward",
+			forge: func(p *Proof) { p.Events[1].Ticks = p.Events[0].Ticks - 1 },
+		},
+		{
+			name:  "faster than taps",
+			forge: func(p *Proof) { p.Events[1].Ticks = p.Events[0].Ticks + MinColorEventInterval - 1 },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newSolvedProof(t, 1, 4, MinColorEventInterval)
+			tt.forge(p)
+			if result, err := Verify(p); err == nil {
+				t.Fatalf("forged proof verified with score %d", result.Score)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsGivens(t *testing.T) {
+	p := newSolvedProof(t, 1, 4, MinColorEventInterval)
+
+	// Givens of all areas but the last one leave a single event
+	for _, e := range p.Events[:len(p.Events)-1] {
+		p.Givens = append(p.Givens, Given{Area: e.Area, Color: e.Color})
+	}
+	p.Events = p.Events[len(p.Events)-1:]
+
+	if result, err := Verify(p); err == nil {
+		t.Fatalf("proof with givens verified with score %d", result.Score)
+	}
+	if _, err := VerifyCode(p); err != nil {
+		t.Fatalf("proof of a code not verified: %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package puzzle
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+)
+
+// Name of the game, which prefixes the names of its rankings
+const GameName = "four-color-theorem"
+
+const (
+	MarathonTimeLimitTicks = 3 * 60 * 60
+	// Penalty added to the score for each color used beyond the optimum
+	ExtraColorPenaltyTicks = 30 * 60
+)
+
+// GetRankingName gets the name of the ranking of the rule, in which daily is the date
+// of the daily challenge or empty if the game is not
+func GetRankingName(colorNum int, minimizeColors, marathon bool, daily string) string {
+	if marathon {
+		return GameName + "-marathon"
+	}
+	if daily != "" {
+		return GameName + "-daily-" + strings.ReplaceAll(daily, "-", "")
+	}
+	if minimizeColors {
+		return GameName + "-min-colors"
+	}
+	if colorNum == 4 {
+		return GameName
+	}
+	return fmt.Sprintf("%s-%dcolors", GameName, colorNum)
+}
+
+// Seed of the daily challenge, which is shared by all players on the same UTC date
+func GetDailySeed(date string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(date))
+	return int64(h.Sum64() & math.MaxInt64)
+}
+
+// Whether all areas are colored and no adjacent areas have the same color
+func IsCompleted(adjacents [][]int, colors []int) bool {
+	for i, c := range colors {
+		if c == -1 {
+			return false
+		}
+		for _, j := range adjacents[i] {
+			if colors[j] == c {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Score of the minimum colors mode, which adds a penalty for each extra color
+func GetMinimizeColorsScore(ticks int, usedColorNum, optimumColorNum int) int {
+	if usedColorNum > optimumColorNum {
+		ticks += (usedColorNum - optimumColorNum) * ExtraColorPenaltyTicks
+	}
+	return ticks
+}
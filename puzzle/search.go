@@ -0,0 +1,302 @@
+package puzzle
+
+import (
+	"math/rand"
+)
+
+const (
+	// Value of the position for the player to move who has won, whose negation is lost
+	duelWinValue = 1000
+	// Positions kept in the transposition table, which is cleared when full
+	duelTableSize = 1 << 18
+)
+
+// Node budgets of the search levels, from DuelLevelSearch
+var duelSearchBudgets = []int{1000, 10000, 100000}
+
+type duelBound int8
+
+const (
+	duelBoundExact duelBound = iota
+	duelBoundLower
+	duelBoundUpper
+)
+
+type duelTableEntry struct {
+	depth int
+	value int
+	bound duelBound
+	best  DuelMove
+}
+
+// DuelSearch searches the move tree of the duel by alpha-beta pruning with iterative deepening.
+// It runs a limited number of nodes per step so that it can be spread over frames, and its result
+// depends only on the budget, not on the time taken.
+type DuelSearch struct {
+	adjacents [][]int
+	colors    []int
+	colorNum  int
+	// Number of adjacent areas of each color, by area and color
+	blocked [][]int
+	// Zobrist keys by area and color, whose xor of the colored areas is the key of the table
+	keys      [][]uint64
+	hash      uint64
+	table     map[uint64]duelTableEntry
+	rootMoves []DuelMove
+	// Buffers of the moves by the remaining depth, which is unique to each ply in a search
+	buffers [][]DuelMove
+	budget  int
+	nodes   int
+	// Node count at which the current step stops
+	limit int
+	depth int
+	// Depth at which the game surely ends, which is the number of the playable areas
+	maxDepth int
+	best     DuelMove
+	done     bool
+}
+
+// NewDuelSearch prepares the search of the move of the computer player of the level,
+// which must be DuelLevelSearch or higher
+func NewDuelSearch(s *DuelState, level int, random *rand.Rand) *DuelSearch {
+	i := level - DuelLevelSearch
+	if i < 0 {
+		i = 0
+	} else if i >= len(duelSearchBudgets) {
+		i = len(duelSearchBudgets) - 1
+	}
+
+	// Keys must be the same in every search so that they are fixed
+	keyRandom := rand.New(rand.NewSource(1))
+
+	search := &DuelSearch{
+		adjacents: s.Adjacents,
+		colors:    make([]int, len(s.Colors)),
+		colorNum:  s.ColorNum,
+		blocked:   make([][]int, len(s.Colors)),
+		keys:      make([][]uint64, len(s.Colors)),
+		table:     make(map[uint64]duelTableEntry),
+		budget:    duelSearchBudgets[i],
+		depth:     1,
+	}
+	for a := range s.Colors {
+		search.colors[a] = -1
+		search.blocked[a] = make([]int, s.ColorNum)
+		search.keys[a] = make([]uint64, s.ColorNum)
+		for c := range search.keys[a] {
+			search.keys[a][c] = keyRandom.Uint64()
+		}
+	}
+	for a, c := range s.Colors {
+		if c >= 0 && c < s.ColorNum {
+			search.play(DuelMove{Area: a, Color: c})
+		}
+	}
+
+	search.rootMoves = search.legalMoves(nil)
+	search.maxDepth = search.countPlayableAreas()
+	search.buffers = make([][]DuelMove, search.maxDepth+1)
+	random.Shuffle(len(search.rootMoves), func(i, j int) {
+		search.rootMoves[i], search.rootMoves[j] = search.rootMoves[j], search.rootMoves[i]
+	})
+	if len(search.rootMoves) > 0 {
+		search.best = search.rootMoves[0]
+	} else {
+		search.done = true
+	}
+	return search
+}
+
+func (s *DuelSearch) play(m DuelMove) {
+	s.colors[m.Area] = m.Color
+	for _, j := range s.adjacents[m.Area] {
+		s.blocked[j][m.Color]++
+	}
+	s.hash ^= s.keys[m.Area][m.Color]
+}
+
+func (s *DuelSearch) undo(m DuelMove) {
+	s.colors[m.Area] = -1
+	for _, j := range s.adjacents[m.Area] {
+		s.blocked[j][m.Color]--
+	}
+	s.hash ^= s.keys[m.Area][m.Color]
+}
+
+func (s *DuelSearch) legalMoves(moves []DuelMove) []DuelMove {
+	for a, c := range s.colors {
+		if c != -1 {
+			continue
+		}
+		for color, n := range s.blocked[a] {
+			if n == 0 {
+				moves = append(moves, DuelMove{Area: a, Color: color})
+			}
+		}
+	}
+	return moves
+}
+
+// Count the uncolored areas which have a legal color, which cannot increase as the game goes
+func (s *DuelSearch) countPlayableAreas() int {
+	playable := 0
+	for a, c := range s.colors {
+		if c != -1 {
+			continue
+		}
+		for _, n := range s.blocked[a] {
+			if n == 0 {
+				playable++
+				break
+			}
+		}
+	}
+	return playable
+}
+
+// Evaluate the position for the player to move, who would win if every playable area
+// took one move to the end, so that the parity of them decides
+func (s *DuelSearch) evaluate() int {
+	if s.countPlayableAreas()%2 == 1 {
+		return 1
+	}
+	return -1
+}
+
+// Move the best move of the table to the front, which makes the pruning work best
+func orderDuelMoves(moves []DuelMove, first DuelMove) {
+	for i, m := range moves {
+		if m == first {
+			copy(moves[1:i+1], moves[:i])
+			moves[0] = m
+			return
+		}
+	}
+}
+
+func (s *DuelSearch) store(depth, value int, bound duelBound, best DuelMove) {
+	if len(s.table) >= duelTableSize {
+		s.table = make(map[uint64]duelTableEntry)
+	}
+	s.table[s.hash] = duelTableEntry{depth: depth, value: value, bound: bound, best: best}
+}
+
+// Search the position to the depth, which returns false when the step has run out of nodes
+func (s *DuelSearch) negamax(depth, alpha, beta int) (int, bool) {
+	if s.nodes >= s.limit {
+		return 0, false
+	}
+	s.nodes++
+
+	e, found := s.table[s.hash]
+	if found && e.depth >= depth {
+		switch {
+		case e.bound == duelBoundExact:
+			return e.value, true
+		case e.bound == duelBoundLower && e.value >= beta:
+			return e.value, true
+		case e.bound == duelBoundUpper && e.value <= alpha:
+			return e.value, true
+		}
+	}
+
+	moves := s.legalMoves(s.buffers[depth][:0])
+	s.buffers[depth] = moves
+	if len(moves) == 0 {
+		return -duelWinValue, true
+	}
+	if depth == 0 {
+		return s.evaluate(), true
+	}
+	if found {
+		orderDuelMoves(moves, e.best)
+	}
+
+	alpha0 := alpha
+	best, bestMove := -duelWinValue-1, moves[0]
+	for _, m := range moves {
+		s.play(m)
+		v, ok := s.negamax(depth-1, -beta, -alpha)
+		s.undo(m)
+		if !ok {
+			return 0, false
+		}
+		if v = -v; v > best {
+			best, bestMove = v, m
+		}
+		if best > alpha {
+			alpha = best
+		}
+		if alpha >= beta {
+			break
+		}
+	}
+
+	bound := duelBoundExact
+	if best <= alpha0 {
+		bound = duelBoundUpper
+	} else if best >= beta {
+		bound = duelBoundLower
+	}
+	s.store(depth, best, bound, bestMove)
+	return best, true
+}
+
+func (s *DuelSearch) searchRoot(depth int) (int, DuelMove, bool) {
+	orderDuelMoves(s.rootMoves, s.best)
+
+	alpha, beta := -duelWinValue-1, duelWinValue+1
+	best, bestMove := -duelWinValue-1, s.rootMoves[0]
+	for _, m := range s.rootMoves {
+		s.play(m)
+		v, ok := s.negamax(depth-1, -beta, -alpha)
+		s.undo(m)
+		if !ok {
+			return 0, DuelMove{}, false
+		}
+		if v = -v; v > best {
+			best, bestMove = v, m
+		}
+		if best > alpha {
+			alpha = best
+		}
+	}
+	return best, bestMove, true
+}
+
+// Step runs the search up to the nodes, which returns true when it has finished.
+// A depth interrupted by the end of a step is searched again in the next step, which goes
+// further than before since the subtrees finished are in the table.
+func (s *DuelSearch) Step(nodes int) bool {
+	if s.done {
+		return true
+	}
+
+	s.limit = s.nodes + nodes
+	if s.limit > s.budget {
+		s.limit = s.budget
+	}
+
+	for {
+		value, best, ok := s.searchRoot(s.depth)
+		if !ok {
+			if s.nodes >= s.budget {
+				s.done = true
+			}
+			return s.done
+		}
+		s.best = best
+
+		// Deeper search cannot change a decided game, nor go beyond the end of the game
+		if value >= duelWinValue || value <= -duelWinValue || s.depth >= s.maxDepth {
+			s.done = true
+			return true
+		}
+		s.depth++
+	}
+}
+
+// Best returns the best move found so far, which returns false if there is no legal move
+func (s *DuelSearch) Best() (DuelMove, bool) {
+	return s.best, len(s.rootMoves) > 0
+}
@@ -0,0 +1,43 @@
+package puzzle
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestDuelSearchFindsForcedWin(t *testing.T) {
+	// The center of the star wins, leaving a move to each of the leaves, while a leaf
+	// loses to the other leaf of the other color, which leaves no move to the center
+	adjacents := [][]int{{1, 2}, {0}, {0}}
+	s := NewDuelState(adjacents, []int{-1, -1, -1}, 2)
+
+	for seed := int64(0); seed < 10; seed++ {
+		m, ok := FindDuelMove(s, DuelLevelSearch, rand.New(rand.NewSource(seed)))
+		if !ok || m.Area != 0 {
+			t.Fatalf("seed %d: move %+v, %v", seed, m, ok)
+		}
+	}
+}
+
+func TestDuelSearchRespectsNodeBudget(t *testing.T) {
+	triangles := GenerateMap(rand.New(rand.NewSource(1)), 4, GetMaxTriangleNum(false, 0))
+	colors := make([]int, len(triangles))
+	for i := range colors {
+		colors[i] = -1
+	}
+	s := NewDuelState(GetTriangleAdjacents(triangles), colors, 4)
+
+	search := NewDuelSearch(s, DuelLevelSearch, rand.New(rand.NewSource(1)))
+	const stepNodes = 100
+	for steps := 1; !search.Step(stepNodes); steps++ {
+		if search.nodes > steps*stepNodes {
+			t.Fatalf("%d nodes searched in %d steps", search.nodes, steps)
+		}
+	}
+	if search.nodes > search.budget {
+		t.Fatalf("%d nodes searched over the budget %d", search.nodes, search.budget)
+	}
+	if m, ok := search.Best(); !ok || !s.IsLegal(m) {
+		t.Fatalf("best move %+v, %v", m, ok)
+	}
+}
@@ -0,0 +1,284 @@
+package relay
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	reconnectMinBackoff = 1 * time.Second
+	reconnectMaxBackoff = 30 * time.Second
+	maxOutboxSize       = 1000
+)
+
+// MessageConn is a connection to the server, which is a Conn or a WebSocket of the browser
+type MessageConn interface {
+	ReadMessage() ([]byte, error)
+	WriteMessage(data []byte) error
+	Close() error
+}
+
+type DialFunc func(url string) (MessageConn, error)
+
+// DialConn dials with Conn, for platforms with sockets
+func DialConn(url string) (MessageConn, error) {
+	c, err := Dial(url)
+	if err != nil {
+		return nil, err
+	}
+	c.SetReadTimeout(readTimeout)
+	return c, nil
+}
+
+// Client stays in a room of the server, reconnecting with backoff when disconnected.
+// It never blocks the caller, so that it can be used in the game loop: messages are
+// sent in the background and received ones are polled.
+type Client struct {
+	url    string
+	room   string
+	player Player
+	// Secret to which the server binds the player ID
+	token string
+	dial  DialFunc
+
+	mu        sync.Mutex
+	conn      MessageConn
+	connected bool
+	closed    bool
+	inbox     []Message
+	outbox    []Message
+	// Latest messages sent with each key, which are sent again on reconnection
+	// since the server may have lost them
+	sent      map[string]Message
+	sentOrder []string
+	lastError error
+	wake      chan struct{}
+}
+
+func NewClient(url, room string, player Player, dial DialFunc) *Client {
+	c := &Client{
+		url:    url,
+		room:   room,
+		player: player,
+		token:  newToken(),
+		dial:   dial,
+		sent:   make(map[string]Message),
+		wake:   make(chan struct{}, 1),
+	}
+	go c.run()
+	return c
+}
+
+func newToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		log.Println(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func (c *Client) run() {
+	backoff := reconnectMinBackoff
+	for {
+		c.mu.Lock()
+		closed := c.closed
+		c.mu.Unlock()
+		if closed {
+			return
+		}
+
+		conn, err := c.dial(c.url)
+		if err == nil {
+			start := time.Now()
+			err = c.session(conn)
+			// Sessions which lasted for a while were not refused, so retry soon
+			if time.Since(start) > reconnectMaxBackoff {
+				backoff = reconnectMinBackoff
+			}
+		}
+
+		c.mu.Lock()
+		c.connected = false
+		c.conn = nil
+		c.lastError = err
+		closed = c.closed
+		c.mu.Unlock()
+		if closed {
+			return
+		}
+
+		log.Printf("relay: %v, reconnecting in %v", err, backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > reconnectMaxBackoff {
+			backoff = reconnectMaxBackoff
+		}
+	}
+}
+
+func (c *Client) session(conn MessageConn) error {
+	defer conn.Close()
+
+	join, err := json.Marshal(Message{Type: TypeJoin, Room: c.room, From: c.player.ID, Name: c.player.Name, Token: c.token})
+	if err != nil {
+		return err
+	}
+	if err := conn.WriteMessage(join); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.conn = conn
+	c.connected = true
+	c.lastError = nil
+	var outbox []Message
+	for _, key := range c.sentOrder {
+		outbox = append(outbox, c.sent[key])
+	}
+	for _, m := range c.outbox {
+		if m.Key == "" {
+			outbox = append(outbox, m)
+		}
+	}
+	c.outbox = outbox
+	c.mu.Unlock()
+
+	done := make(chan struct{})
+	defer close(done)
+	writeErr := make(chan error, 1)
+	go func() {
+		writeErr <- c.writeLoop(conn, done)
+	}()
+
+	for {
+		data, err := conn.ReadMessage()
+		if err != nil {
+			select {
+			case werr := <-writeErr:
+				if werr != nil {
+					return werr
+				}
+			default:
+			}
+			return err
+		}
+		var m Message
+		if err := json.Unmarshal(data, &m); err != nil {
+			log.Println(err)
+			continue
+		}
+		c.mu.Lock()
+		c.inbox = append(c.inbox, m)
+		c.mu.Unlock()
+	}
+}
+
+// Send the queued messages, which are kept for the next connection on failure
+func (c *Client) writeLoop(conn MessageConn, done <-chan struct{}) error {
+	for {
+		c.mu.Lock()
+		pending := c.outbox
+		c.outbox = nil
+		c.mu.Unlock()
+
+		for i, m := range pending {
+			data, err := json.Marshal(m)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			if err := conn.WriteMessage(data); err != nil {
+				c.mu.Lock()
+				c.outbox = append(pending[i:], c.outbox...)
+				c.mu.Unlock()
+				conn.Close()
+				return err
+			}
+		}
+
+		select {
+		case <-c.wake:
+		case <-done:
+			return nil
+		}
+	}
+}
+
+// Send the message to the other players in the room. The latest message of each key
+// is sent again on every reconnection so that the room catches up.
+func (c *Client) Send(m Message) {
+	c.mu.Lock()
+	if m.Key != "" {
+		if _, ok := c.sent[m.Key]; ok {
+			for i, key := range c.sentOrder {
+				if key == m.Key {
+					c.sentOrder = append(c.sentOrder[:i], c.sentOrder[i+1:]...)
+					break
+				}
+			}
+		}
+		c.sent[m.Key] = m
+		c.sentOrder = append(c.sentOrder, m.Key)
+
+		for i := range c.outbox {
+			if c.outbox[i].Key == m.Key {
+				c.outbox = append(c.outbox[:i], c.outbox[i+1:]...)
+				break
+			}
+		}
+	}
+	if len(c.outbox) >= maxOutboxSize {
+		c.outbox = c.outbox[1:]
+	}
+	c.outbox = append(c.outbox, m)
+	c.mu.Unlock()
+
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Poll gets the messages received since the last poll
+func (c *Client) Poll() []Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	messages := c.inbox
+	c.inbox = nil
+	return messages
+}
+
+func (c *Client) Connected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connected
+}
+
+// Get the error of the last connection, which is nil while connected
+func (c *Client) LastError() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastError
+}
+
+func (c *Client) Player() Player {
+	return c.player
+}
+
+func (c *Client) Close() {
+	c.mu.Lock()
+	c.closed = true
+	conn := c.conn
+	c.mu.Unlock()
+	if conn != nil {
+		conn.Close()
+	}
+}
@@ -0,0 +1,108 @@
+// Package relay is a lightweight WebSocket relay with which players in the same room
+// exchange messages, and its reference server and client.
+//
+// A client joins a room by sending a join message with its player ID as From and a secret
+// token, both of which are kept across reconnections. The server binds the ID to the token
+// until the room is dropped, so that no one else can join as the player or send messages
+// retained as theirs. The server answers with a welcome listing the players in
+// the room, followed by the retained messages. Other messages are relayed to the other
+// players in the room, stamped with the sender and a sequence number of the room.
+// A message with a key is retained as the latest one of the sender with the key, even
+// after the sender leaves, so that late joiners and reconnecting players catch up.
+// A message with echo is sent back to the sender too, which learns its sequence number.
+// Rooms are dropped when all players leave.
+package relay
+
+import (
+	"encoding/json"
+)
+
+// Message types handled by the server
+const (
+	// Sent by a client to join a room, and relayed to the others when it joins
+	TypeJoin = "join"
+	// Sent to a client which has joined, whose data is Welcome
+	TypeWelcome = "welcome"
+	// Relayed when a player disconnects
+	TypeLeave = "leave"
+)
+
+type Message struct {
+	Type string          `json:"type"`
+	Room string          `json:"room,omitempty"`
+	From string          `json:"from,omitempty"`
+	Name string          `json:"name,omitempty"`
+	Key  string          `json:"key,omitempty"`
+	Seq  int64           `json:"seq,omitempty"`
+	Echo bool            `json:"echo,omitempty"`
+	Data json.RawMessage `json:"data,omitempty"`
+	// Secret of the player sent only in the join, which is never relayed
+	Token string `json:"token,omitempty"`
+}
+
+// NewMessage creates a message with the data encoded into JSON
+func NewMessage(messageType, key string, data interface{}) (Message, error) {
+	m := Message{Type: messageType, Key: key}
+	if data != nil {
+		b, err := json.Marshal(data)
+		if err != nil {
+			return m, err
+		}
+		m.Data = b
+	}
+	return m, nil
+}
+
+type Player struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type Welcome struct {
+	// Players connected to the room, including the one which has joined
+	Players []Player `json:"players"`
+}
+
+// Messages of the versus race, in which the players race on the same puzzle
+const (
+	// Puzzle of the race, which is the one with the smallest sequence number in the room,
+	// so that it is sent with echo
+	TypeRace = "race"
+	// Progress of a player, which is retained by the key of the type
+	TypeProgress = "progress"
+)
+
+type RaceData struct {
+	Code string `json:"code"`
+}
+
+type ProgressData struct {
+	// Ratio of the areas colored without conflicts
+	Progress float64 `json:"progress"`
+	Ticks    int     `json:"ticks"`
+	Finished bool    `json:"finished,omitempty"`
+}
+
+// Messages of the co-op game, in which the players color the same board of the race message
+const (
+	// Coloring of an area, which is retained by the key of the area so that late joiners get the board
+	TypeOp = "op"
+	// Position of the cursor of a player, which is retained by the key of the type
+	TypeCursor = "cursor"
+)
+
+// OpData colors an area, and of the operations on an area the one with the largest tick wins,
+// or the one of the largest player ID on a tie
+type OpData struct {
+	// Stable ID of the area in the map
+	Area  int `json:"area"`
+	Color int `json:"color"`
+	// Logical clock, which is larger than that of any operation seen by the sender
+	Tick int64 `json:"tick"`
+}
+
+type CursorData struct {
+	// Position in the map coordinates, which are the same for all players
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
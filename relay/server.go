@@ -0,0 +1,264 @@
+package relay
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	pingInterval    = 20 * time.Second
+	readTimeout     = 3 * pingInterval
+	maxRoomRetained = 4096
+	// Retained messages are queued at once on joining
+	sendQueueSize    = 256 + maxRoomRetained
+	joinTimeout      = 10 * time.Second
+	maxRoomNameBytes = 64
+	maxTokenBytes    = 64
+)
+
+type serverClient struct {
+	player Player
+	conn   *Conn
+	send   chan []byte
+	done   chan struct{}
+	once   sync.Once
+}
+
+// Stop the client without blocking, since it is called with the lock of the server held.
+// The connection is closed by writeLoop, which may be in the middle of a write to a slow peer.
+func (c *serverClient) close() {
+	c.once.Do(func() {
+		close(c.done)
+	})
+}
+
+// Drop the client which cannot keep up, whose connection is closed at once without
+// a close frame, since writing it would wait for the peer which does not read
+func (c *serverClient) drop() {
+	c.close()
+	c.conn.conn.Close()
+}
+
+// Queue the message without blocking, which drops the client that cannot keep up
+func (c *serverClient) enqueue(data []byte) {
+	select {
+	case c.send <- data:
+	default:
+		c.drop()
+	}
+}
+
+func (c *serverClient) writeLoop() {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	defer c.conn.Close()
+	for {
+		select {
+		case data := <-c.send:
+			if err := c.conn.WriteMessage(data); err != nil {
+				c.close()
+				return
+			}
+		case <-ticker.C:
+			if err := c.conn.Ping(); err != nil {
+				c.close()
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+type retainKey struct {
+	from, key string
+}
+
+type room struct {
+	clients  map[string]*serverClient
+	seq      int64
+	retained map[retainKey]*Message
+	// Tokens to which the player IDs are bound, which are kept after the players leave
+	// as long as their retained messages
+	tokens map[string]string
+}
+
+// Server is the reference relay server, which is an http.Handler accepting WebSocket connections
+type Server struct {
+	mu    sync.Mutex
+	rooms map[string]*room
+}
+
+func NewServer() *Server {
+	return &Server{rooms: make(map[string]*room)}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := Accept(w, r)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	conn.SetReadTimeout(joinTimeout)
+
+	data, err := conn.ReadMessage()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	var join Message
+	if err := json.Unmarshal(data, &join); err != nil || join.Type != TypeJoin || join.Room == "" || join.From == "" || len(join.Room) > maxRoomNameBytes || join.Token == "" || len(join.Token) > maxTokenBytes {
+		log.Printf("invalid join from %s", r.RemoteAddr)
+		conn.Close()
+		return
+	}
+	conn.SetReadTimeout(readTimeout)
+
+	c := &serverClient{
+		player: Player{ID: join.From, Name: join.Name},
+		conn:   conn,
+		send:   make(chan []byte, sendQueueSize),
+		done:   make(chan struct{}),
+	}
+	go c.writeLoop()
+
+	if !s.join(join.Room, c, join.Token) {
+		log.Printf("%s from %s refused with another token", join.From, r.RemoteAddr)
+		c.close()
+		return
+	}
+	defer s.leave(join.Room, c)
+
+	for {
+		data, err := conn.ReadMessage()
+		if err != nil {
+			c.close()
+			return
+		}
+		var m Message
+		if err := json.Unmarshal(data, &m); err != nil || m.Type == TypeJoin || m.Type == TypeWelcome || m.Type == TypeLeave {
+			continue
+		}
+		s.relay(join.Room, c, &m)
+	}
+}
+
+// Join the client to the room, which fails if its ID is bound to another token
+func (s *Server) join(name string, c *serverClient, token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.rooms[name]
+	if !ok {
+		r = &room{
+			clients:  make(map[string]*serverClient),
+			retained: make(map[retainKey]*Message),
+			tokens:   make(map[string]string),
+		}
+		s.rooms[name] = r
+	}
+
+	if bound, ok := r.tokens[c.player.ID]; ok && subtle.ConstantTimeCompare([]byte(bound), []byte(token)) != 1 {
+		return false
+	}
+	r.tokens[c.player.ID] = token
+
+	// The player reconnects, so the old connection is replaced
+	if old, ok := r.clients[c.player.ID]; ok {
+		old.close()
+	}
+	r.clients[c.player.ID] = c
+
+	welcome := Welcome{}
+	for _, other := range r.clients {
+		welcome.Players = append(welcome.Players, other.player)
+	}
+	m, _ := NewMessage(TypeWelcome, "", welcome)
+	s.send(c, &m)
+
+	retained := make([]*Message, 0, len(r.retained))
+	for _, m := range r.retained {
+		retained = append(retained, m)
+	}
+	sort.Slice(retained, func(i, j int) bool {
+		return retained[i].Seq < retained[j].Seq
+	})
+	for _, m := range retained {
+		s.send(c, m)
+	}
+
+	r.seq++
+	s.broadcast(r, c, &Message{Type: TypeJoin, From: c.player.ID, Name: c.player.Name, Seq: r.seq})
+
+	log.Printf("%s joined %s (%d players)", c.player.ID, name, len(r.clients))
+	return true
+}
+
+func (s *Server) leave(name string, c *serverClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.rooms[name]
+	if !ok || r.clients[c.player.ID] != c {
+		return
+	}
+	delete(r.clients, c.player.ID)
+
+	if len(r.clients) == 0 {
+		delete(s.rooms, name)
+		log.Printf("%s left %s, which is closed", c.player.ID, name)
+		return
+	}
+
+	r.seq++
+	s.broadcast(r, c, &Message{Type: TypeLeave, From: c.player.ID, Name: c.player.Name, Seq: r.seq})
+
+	log.Printf("%s left %s (%d players)", c.player.ID, name, len(r.clients))
+}
+
+func (s *Server) relay(name string, c *serverClient, m *Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.rooms[name]
+	if !ok || r.clients[c.player.ID] != c {
+		return
+	}
+
+	r.seq++
+	m.Room, m.From, m.Name, m.Seq, m.Token = "", c.player.ID, c.player.Name, r.seq, ""
+
+	if m.Key != "" {
+		k := retainKey{from: m.From, key: m.Key}
+		if _, ok := r.retained[k]; ok || len(r.retained) < maxRoomRetained {
+			r.retained[k] = m
+		}
+	}
+
+	s.broadcast(r, c, m)
+	if m.Echo {
+		s.send(c, m)
+	}
+}
+
+func (s *Server) broadcast(r *room, sender *serverClient, m *Message) {
+	for _, c := range r.clients {
+		if c != sender {
+			s.send(c, m)
+		}
+	}
+}
+
+func (s *Server) send(c *serverClient, m *Message) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	c.enqueue(data)
+}
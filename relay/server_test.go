@@ -0,0 +1,334 @@
+package relay
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func startServer(t *testing.T) string {
+	s := httptest.NewServer(NewServer())
+	t.Cleanup(s.Close)
+	return "ws" + strings.TrimPrefix(s.URL, "http")
+}
+
+// testClient keeps the polled messages which have not been received by the test yet
+type testClient struct {
+	*Client
+	pending []Message
+}
+
+func startClient(t *testing.T, url, room, id string, dial DialFunc) *testClient {
+	c := NewClient(url, room, Player{ID: id, Name: strings.ToUpper(id)}, dial)
+	t.Cleanup(c.Close)
+	return &testClient{Client: c}
+}
+
+// Receive the messages of the client until one matches, which are all returned
+func receiveUntil(t *testing.T, c *testClient, match func(m *Message) bool) []Message {
+	t.Helper()
+	var received []Message
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		c.pending = append(c.pending, c.Poll()...)
+		for i, m := range c.pending {
+			if match(&m) {
+				received = append(received, c.pending[:i+1]...)
+				c.pending = c.pending[i+1:]
+				return received
+			}
+		}
+		received = append(received, c.pending...)
+		c.pending = nil
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("message not received by %s, got %v", c.Player().ID, received)
+	return nil
+}
+
+func isMessage(messageType, from string) func(m *Message) bool {
+	return func(m *Message) bool {
+		return m.Type == messageType && m.From == from
+	}
+}
+
+func isProgress(from string, ticks int) func(m *Message) bool {
+	return func(m *Message) bool {
+		var p ProgressData
+		return m.Type == TypeProgress && m.From == from && json.Unmarshal(m.Data, &p) == nil && p.Ticks == ticks
+	}
+}
+
+func sendProgress(t *testing.T, c *testClient, ticks int) {
+	m, err := NewMessage(TypeProgress, TypeProgress, ProgressData{Ticks: ticks})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Send(m)
+}
+
+func TestServerJoin(t *testing.T) {
+	url := startServer(t)
+
+	a := startClient(t, url, "room", "a", DialConn)
+	received := receiveUntil(t, a, isMessage(TypeWelcome, ""))
+	var w Welcome
+	if err := json.Unmarshal(received[len(received)-1].Data, &w); err != nil || len(w.Players) != 1 || w.Players[0].ID != "a" {
+		t.Fatalf("unexpected welcome: %v, %v", w, err)
+	}
+
+	b := startClient(t, url, "room", "b", DialConn)
+	received = receiveUntil(t, b, isMessage(TypeWelcome, ""))
+	if err := json.Unmarshal(received[len(received)-1].Data, &w); err != nil || len(w.Players) != 2 {
+		t.Fatalf("unexpected welcome: %v, %v", w, err)
+	}
+	received = receiveUntil(t, a, isMessage(TypeJoin, "b"))
+	if m := received[len(received)-1]; m.Name != "B" || m.Seq == 0 {
+		t.Fatalf("unexpected join: %v", m)
+	}
+
+	// Messages are relayed to the others, and echoed to the sender only with echo
+	m, _ := NewMessage(TypeRace, TypeRace, RaceData{Code: "code"})
+	m.Echo = true
+	a.Send(m)
+	relayed := receiveUntil(t, b, isMessage(TypeRace, "a"))
+	echoed := receiveUntil(t, a, isMessage(TypeRace, "a"))
+	if r, e := relayed[len(relayed)-1], echoed[len(echoed)-1]; r.Seq == 0 || r.Seq != e.Seq {
+		t.Fatalf("unexpected sequence numbers: relayed %d, echoed %d", r.Seq, e.Seq)
+	}
+	sendProgress(t, b, 1)
+	receiveUntil(t, a, isProgress("b", 1))
+	for _, m := range append(b.pending, b.Poll()...) {
+		if m.Type == TypeProgress {
+			t.Fatalf("message without echo sent back: %v", m)
+		}
+	}
+
+	// Rooms of other names are apart
+	c := startClient(t, url, "other", "c", DialConn)
+	received = receiveUntil(t, c, isMessage(TypeWelcome, ""))
+	if err := json.Unmarshal(received[len(received)-1].Data, &w); err != nil || len(w.Players) != 1 {
+		t.Fatalf("unexpected welcome: %v, %v", w, err)
+	}
+}
+
+func TestServerLateJoin(t *testing.T) {
+	url := startServer(t)
+
+	a := startClient(t, url, "room", "a", DialConn)
+	receiveUntil(t, a, isMessage(TypeWelcome, ""))
+	b := startClient(t, url, "room", "b", DialConn)
+	receiveUntil(t, b, isMessage(TypeWelcome, ""))
+
+	note, _ := NewMessage("note", "", nil)
+	a.Send(note)
+	sendProgress(t, a, 1)
+	sendProgress(t, a, 2)
+	receiveUntil(t, b, isProgress("a", 2))
+
+	// Only the latest message of each key is retained, even after the sender leaves
+	a.Close()
+	receiveUntil(t, b, isMessage(TypeLeave, "a"))
+
+	c := startClient(t, url, "room", "c", DialConn)
+	received := receiveUntil(t, c, isProgress("a", 2))
+	if received[0].Type != TypeWelcome {
+		t.Fatalf("welcome not received first: %v", received)
+	}
+	for _, m := range received[1 : len(received)-1] {
+		if m.Type == "note" || m.Type == TypeProgress {
+			t.Fatalf("message not retained received: %v", m)
+		}
+	}
+}
+
+func TestServerReconnect(t *testing.T) {
+	url := startServer(t)
+
+	var mu sync.Mutex
+	var conns []MessageConn
+	dial := func(url string) (MessageConn, error) {
+		c, err := DialConn(url)
+		if err == nil {
+			mu.Lock()
+			conns = append(conns, c)
+			mu.Unlock()
+		}
+		return c, err
+	}
+
+	a := startClient(t, url, "room", "a", dial)
+	receiveUntil(t, a, isMessage(TypeWelcome, ""))
+	b := startClient(t, url, "room", "b", DialConn)
+	receiveUntil(t, b, isMessage(TypeWelcome, ""))
+	sendProgress(t, a, 1)
+	receiveUntil(t, b, isProgress("a", 1))
+
+	mu.Lock()
+	conns[0].Close()
+	mu.Unlock()
+
+	// The client joins again, sending the latest message of each key again
+	receiveUntil(t, a, isMessage(TypeWelcome, ""))
+	receiveUntil(t, b, isMessage(TypeJoin, "a"))
+	receiveUntil(t, b, isProgress("a", 1))
+	if !a.Connected() {
+		t.Fatal("client not connected after reconnection")
+	}
+
+	sendProgress(t, a, 2)
+	receiveUntil(t, b, isProgress("a", 2))
+}
+
+// Dial the server and send the join to the room
+func dialJoin(t *testing.T, url, room, id, token string) *Conn {
+	t.Helper()
+	c, err := Dial(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	join, _ := json.Marshal(Message{Type: TypeJoin, Room: room, From: id, Token: token})
+	if err := c.WriteMessage(join); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// Join the room, reading the welcome
+func joinRaw(t *testing.T, url, room, id string) *Conn {
+	t.Helper()
+	c := dialJoin(t, url, room, id, id+"-token")
+	if _, err := c.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestServerBindsIDsToTokens(t *testing.T) {
+	url := startServer(t)
+
+	a := startClient(t, url, "room", "a", DialConn)
+	receiveUntil(t, a, isMessage(TypeWelcome, ""))
+	b := joinRaw(t, url, "room", "b")
+
+	// Tokens are not relayed
+	m, _ := NewMessage(TypeProgress, TypeProgress, ProgressData{Ticks: 1})
+	m.Token = "b-token"
+	data, _ := json.Marshal(m)
+	if err := b.WriteMessage(data); err != nil {
+		t.Fatal(err)
+	}
+	received := receiveUntil(t, a, isProgress("b", 1))
+	if token := received[len(received)-1].Token; token != "" {
+		t.Fatalf("token %q relayed", token)
+	}
+
+	// Others cannot join as a player, even after the player leaves while the room remains
+	a.Close()
+	for _, token := range []string{"", "other"} {
+		c := dialJoin(t, url, "room", "a", token)
+		c.SetReadTimeout(5 * time.Second)
+		if data, err := c.ReadMessage(); err == nil {
+			t.Fatalf("join with token %q answered: %s", token, data)
+		}
+	}
+
+	// The ID is free again once the room is dropped
+	b.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		c := dialJoin(t, url, "room", "a", "other")
+		c.SetReadTimeout(5 * time.Second)
+		if _, err := c.ReadMessage(); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("ID not freed after the room is dropped")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestServerDropsSlowConsumer(t *testing.T) {
+	url := startServer(t)
+
+	// The slow player never reads after the welcome
+	joinRaw(t, url, "room", "slow")
+	flood := joinRaw(t, url, "room", "flood")
+
+	left := make(chan struct{})
+	go func() {
+		for {
+			data, err := flood.ReadMessage()
+			if err != nil {
+				return
+			}
+			var m Message
+			if json.Unmarshal(data, &m) == nil && m.Type == TypeLeave && m.From == "slow" {
+				close(left)
+				return
+			}
+		}
+	}()
+
+	m, _ := NewMessage("flood", "", strings.Repeat("x", 1024))
+	data, _ := json.Marshal(m)
+	timeout := time.After(30 * time.Second)
+	for {
+		select {
+		case <-left:
+			return
+		case <-timeout:
+			t.Fatal("slow player not dropped")
+		default:
+		}
+		if err := flood.WriteMessage(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestAcceptRejectsOtherVersions(t *testing.T) {
+	url := startServer(t)
+
+	req, _ := http.NewRequest(http.MethodGet, "http"+strings.TrimPrefix(url, "ws"), nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	req.Header.Set("Sec-WebSocket-Version", "8")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUpgradeRequired || resp.Header.Get("Sec-WebSocket-Version") != "13" {
+		t.Fatalf("unexpected response: %s", resp.Status)
+	}
+}
+
+func TestServerRejectsUnmaskedFrames(t *testing.T) {
+	url := startServer(t)
+
+	c, err := Dial(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// Frames are sent as if from a server
+	c.client = false
+	join, _ := json.Marshal(Message{Type: TypeJoin, Room: "room", From: "a", Token: "a-token"})
+	if err := c.WriteMessage(join); err != nil {
+		t.Fatal(err)
+	}
+	c.client = true
+	c.SetReadTimeout(5 * time.Second)
+	if data, err := c.ReadMessage(); err == nil {
+		t.Fatalf("unmasked join answered: %s", data)
+	}
+}
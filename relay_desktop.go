@@ -0,0 +1,17 @@
+//go:build !js
+
+package main
+
+import (
+	"github.com/tsujio/game-four-color-theorem/relay"
+)
+
+const defaultRelayURL = "ws://localhost:8081/relay"
+
+func getDefaultRelayURL() string {
+	return defaultRelayURL
+}
+
+func dialRelay(url string) (relay.MessageConn, error) {
+	return relay.DialConn(url)
+}
@@ -0,0 +1,110 @@
+//go:build js
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"syscall/js"
+
+	"github.com/tsujio/game-four-color-theorem/relay"
+)
+
+// The relay is served by the host of the page
+func getDefaultRelayURL() string {
+	location := js.Global().Get("location")
+	scheme := "ws"
+	if location.Get("protocol").String() == "https:" {
+		scheme = "wss"
+	}
+	return scheme + "://" + location.Get("host").String() + "/relay"
+}
+
+// wsConn is a WebSocket of the browser, whose events are turned into blocking reads
+type wsConn struct {
+	ws       js.Value
+	messages chan []byte
+	closed   chan struct{}
+	once     sync.Once
+	funcs    []js.Func
+}
+
+func dialRelay(url string) (relay.MessageConn, error) {
+	c := &wsConn{
+		ws:       js.Global().Get("WebSocket").New(url),
+		messages: make(chan []byte, 4096),
+		closed:   make(chan struct{}),
+	}
+
+	opened := make(chan struct{}, 1)
+	c.on("open", func(event js.Value) {
+		opened <- struct{}{}
+	})
+	c.on("message", func(event js.Value) {
+		// Messages which overflow the buffer are dropped rather than blocking the browser
+		select {
+		case c.messages <- []byte(event.Get("data").String()):
+		default:
+		}
+	})
+	// No events follow the close, which is fired also when failing to connect or closed by Close,
+	// so the callbacks are released there
+	c.on("close", func(event js.Value) {
+		c.once.Do(func() {
+			close(c.closed)
+			c.release()
+		})
+	})
+
+	select {
+	case <-opened:
+		return c, nil
+	case <-c.closed:
+		return nil, fmt.Errorf("failed to connect to %s", url)
+	}
+}
+
+func (c *wsConn) on(event string, handler func(event js.Value)) {
+	f := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		handler(args[0])
+		return nil
+	})
+	c.funcs = append(c.funcs, f)
+	c.ws.Call("addEventListener", event, f)
+}
+
+func (c *wsConn) release() {
+	for _, f := range c.funcs {
+		f.Release()
+	}
+	c.funcs = nil
+}
+
+func (c *wsConn) ReadMessage() ([]byte, error) {
+	select {
+	case m := <-c.messages:
+		return m, nil
+	case <-c.closed:
+		select {
+		case m := <-c.messages:
+			return m, nil
+		default:
+		}
+		return nil, io.EOF
+	}
+}
+
+func (c *wsConn) WriteMessage(data []byte) error {
+	// Sending before opening or after closing throws
+	if c.ws.Get("readyState").Int() != 1 {
+		return fmt.Errorf("WebSocket is not open")
+	}
+	c.ws.Call("send", string(data))
+	return nil
+}
+
+func (c *wsConn) Close() error {
+	c.ws.Call("close")
+	return nil
+}
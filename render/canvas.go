@@ -0,0 +1,160 @@
+// Package render rasterizes maps offscreen without a GPU, for tools and exports.
+package render
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+
+	"github.com/tsujio/game-four-color-theorem/puzzle"
+	"golang.org/x/image/vector"
+)
+
+// transform converts the world into pixels of an image of the size, which shows
+// the world rectangle from min to max at its center keeping the aspect ratio
+type transform struct {
+	scale  float64
+	origin puzzle.Point
+}
+
+func newTransform(width, height int, min, max *puzzle.Point) transform {
+	scale := math.Min(float64(width)/(max.X-min.X), float64(height)/(max.Y-min.Y))
+	center := min.Add(max).Div(2)
+	return transform{
+		scale: scale,
+		origin: puzzle.Point{
+			X: center.X - float64(width)/2/scale,
+			Y: center.Y - float64(height)/2/scale,
+		},
+	}
+}
+
+// Scale from the world to pixels
+func (t *transform) Scale() float64 {
+	return t.scale
+}
+
+// Convert the point in the world into pixels
+func (t *transform) ToPixel(p *puzzle.Point) *puzzle.Point {
+	return p.Sub(&t.origin).Mul(t.scale)
+}
+
+// Convert the point in pixels into the world
+func (t *transform) ToWorld(p *puzzle.Point) *puzzle.Point {
+	return p.Div(t.scale).Add(&t.origin)
+}
+
+// Canvas is an image showing a rectangle of the world
+type Canvas struct {
+	transform
+	img *image.RGBA
+}
+
+// NewCanvas creates a canvas of the size which shows the world rectangle
+// from min to max at its center, keeping the aspect ratio
+func NewCanvas(width, height int, min, max *puzzle.Point) *Canvas {
+	return &Canvas{
+		transform: newTransform(width, height, min, max),
+		img:       image.NewRGBA(image.Rect(0, 0, width, height)),
+	}
+}
+
+// Get the bounding rectangle of the triangles with the margin
+func GetBounds(triangles []puzzle.Triangle, margin float64) (min, max *puzzle.Point) {
+	min = &puzzle.Point{X: math.Inf(1), Y: math.Inf(1)}
+	max = &puzzle.Point{X: math.Inf(-1), Y: math.Inf(-1)}
+	for _, t := range triangles {
+		for _, p := range t {
+			min.X, min.Y = math.Min(min.X, p.X), math.Min(min.Y, p.Y)
+			max.X, max.Y = math.Max(max.X, p.X), math.Max(max.Y, p.Y)
+		}
+	}
+	if len(triangles) == 0 {
+		min, max = &puzzle.Point{}, &puzzle.Point{X: puzzle.MapWidth, Y: puzzle.MapHeight}
+	}
+	return &puzzle.Point{X: min.X - margin, Y: min.Y - margin}, &puzzle.Point{X: max.X + margin, Y: max.Y + margin}
+}
+
+func (c *Canvas) Image() *image.RGBA {
+	return c.img
+}
+
+func (c *Canvas) EncodePNG(w io.Writer) error {
+	return png.Encode(w, c.img)
+}
+
+func (c *Canvas) Fill(clr color.Color) {
+	draw.Draw(c.img, c.img.Bounds(), image.NewUniform(clr), image.Point{}, draw.Src)
+}
+
+// Fill the polygon given in pixels
+func (c *Canvas) fillPixelPolygon(points []puzzle.Point, clr color.Color) {
+	if len(points) < 3 {
+		return
+	}
+	b := c.img.Bounds()
+	r := vector.NewRasterizer(b.Dx(), b.Dy())
+	r.MoveTo(float32(points[0].X), float32(points[0].Y))
+	for _, p := range points[1:] {
+		r.LineTo(float32(p.X), float32(p.Y))
+	}
+	r.ClosePath()
+	r.Draw(c.img, b, image.NewUniform(clr), image.Point{})
+}
+
+// Fill the polygon given in the world
+func (c *Canvas) FillPolygon(points []puzzle.Point, clr color.Color) {
+	var pixels []puzzle.Point
+	for i := range points {
+		pixels = append(pixels, *c.ToPixel(&points[i]))
+	}
+	c.fillPixelPolygon(pixels, clr)
+}
+
+func (c *Canvas) FillTriangle(t *puzzle.Triangle, clr color.Color) {
+	c.FillPolygon(t[:], clr)
+}
+
+// Draw the line of the width in pixels
+func (c *Canvas) DrawLine(from, to *puzzle.Point, width float64, clr color.Color) {
+	p, q := c.ToPixel(from), c.ToPixel(to)
+	d := q.Sub(p)
+	if d.Norm() == 0 {
+		return
+	}
+	n := (&puzzle.Point{X: -d.Y, Y: d.X}).Div(d.Norm()).Mul(width / 2)
+	c.fillPixelPolygon([]puzzle.Point{*p.Add(n), *q.Add(n), *q.Sub(n), *p.Sub(n)}, clr)
+}
+
+// Fill the circle of the radius in pixels
+func (c *Canvas) FillCircle(center *puzzle.Point, r float64, clr color.Color) {
+	p := c.ToPixel(center)
+	n := 8 + int(r)
+	var points []puzzle.Point
+	for i := 0; i < n; i++ {
+		theta := 2 * math.Pi * float64(i) / float64(n)
+		points = append(points, puzzle.Point{X: p.X + r*math.Cos(theta), Y: p.Y + r*math.Sin(theta)})
+	}
+	c.fillPixelPolygon(points, clr)
+}
+
+// Draw the map with the fill color of each area, and its edges and vertices
+func (c *Canvas) DrawMap(triangles []puzzle.Triangle, fill func(i int) color.Color, edge color.Color) {
+	for i := range triangles {
+		c.FillTriangle(&triangles[i], fill(i))
+	}
+	for i := range triangles {
+		t := &triangles[i]
+		for j := range t {
+			c.DrawLine(&t[j], &t[(j+1)%3], 1.5, edge)
+		}
+	}
+	for i := range triangles {
+		for j := range triangles[i] {
+			c.FillCircle(&triangles[i][j], 2.5, edge)
+		}
+	}
+}
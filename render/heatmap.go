@@ -0,0 +1,71 @@
+package render
+
+import (
+	"image/color"
+	"math"
+
+	"github.com/tsujio/game-four-color-theorem/puzzle"
+)
+
+// Draw the density of the points in the world, blurred by the radius in pixels
+func (c *Canvas) DrawHeatmap(points []puzzle.Point, radius float64) {
+	b := c.img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	density := make([]float64, w*h)
+
+	reach := int(math.Ceil(radius * 3))
+	for i := range points {
+		p := c.ToPixel(&points[i])
+		px, py := int(p.X), int(p.Y)
+		for y := py - reach; y <= py+reach; y++ {
+			if y < 0 || y >= h {
+				continue
+			}
+			for x := px - reach; x <= px+reach; x++ {
+				if x < 0 || x >= w {
+					continue
+				}
+				d2 := math.Pow(float64(x)-p.X, 2) + math.Pow(float64(y)-p.Y, 2)
+				density[y*w+x] += math.Exp(-d2 / (2 * radius * radius))
+			}
+		}
+	}
+
+	max := 0.0
+	for _, v := range density {
+		max = math.Max(max, v)
+	}
+	if max == 0 {
+		return
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := density[y*w+x] / max
+			if v < 0.01 {
+				continue
+			}
+			clr := HeatColor(v)
+			clr.A = uint8(0xc0 * math.Min(1, v*2))
+			c.img.SetRGBA(b.Min.X+x, b.Min.Y+y, blend(c.img.RGBAAt(b.Min.X+x, b.Min.Y+y), clr))
+		}
+	}
+}
+
+// Get the color of the value in [0, 1] from blue through green and yellow to red
+func HeatColor(v float64) color.RGBA {
+	v = math.Max(0, math.Min(1, v))
+	r := math.Min(1, math.Max(0, 2*v-0.5)*1.5)
+	g := math.Min(1, 2*v) - math.Max(0, 4*v-3)
+	bl := math.Max(0, 1-2*v)
+	return color.RGBA{uint8(r * 0xff), uint8(g * 0xff), uint8(bl * 0xff), 0xff}
+}
+
+// Blend the non-premultiplied color over the destination
+func blend(dst, src color.RGBA) color.RGBA {
+	a := float64(src.A) / 0xff
+	mix := func(d, s uint8) uint8 {
+		return uint8(float64(d)*(1-a) + float64(s)*a)
+	}
+	return color.RGBA{mix(dst.R, src.R), mix(dst.G, src.G), mix(dst.B, src.B), dst.A + uint8(float64(0xff-dst.A)*a)}
+}
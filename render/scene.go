@@ -0,0 +1,227 @@
+package render
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"math/rand"
+
+	"github.com/tsujio/game-four-color-theorem/puzzle"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// Colors of the game
+var (
+	SkyTopColor    = color.NRGBA{0x33, 0x33, 0x77, 0xff}
+	SkyBottomColor = color.NRGBA{0x77, 0x70, 0xbb, 0xff}
+	EdgeColor      = color.NRGBA{0xff, 0xff, 0xff, 0xff}
+	VertexColor    = color.NRGBA{0xf5, 0xdb, 0x49, 0xff}
+	CaptionColor   = color.NRGBA{0xff, 0xff, 0xff, 0xff}
+)
+
+// Colors of the default palette of the game, for tools without the settings
+var DefaultPalette = []color.NRGBA{
+	{0xff, 0x00, 0x00, 0x4c},
+	{0x00, 0xff, 0x00, 0x4c},
+	{0x00, 0x00, 0xff, 0x4c},
+	{0xff, 0xff, 0x00, 0x4c},
+	{0x00, 0xff, 0xff, 0x4c},
+	{0xff, 0x00, 0xff, 0x4c},
+	{0xff, 0x7f, 0x00, 0x4c},
+	{0xff, 0xff, 0xff, 0x4c},
+}
+
+// Star is a star of the sky, whose position is relative to the image size
+type Star struct {
+	X, Y float64
+	R    float64
+}
+
+// Generate stars scattered randomly like the sky of the game
+func GenerateStars(random *rand.Rand) []Star {
+	var stars []Star
+	for i := 0; i < 500; i++ {
+		stars = append(stars, Star{
+			X: random.Float64(),
+			Y: random.Float64(),
+			R: math.Max(1.0+0.5*random.NormFloat64(), 0.5),
+		})
+	}
+	return stars
+}
+
+// Scene is a map to be exported as an image
+type Scene struct {
+	Width, Height int
+	Triangles     []puzzle.Triangle
+	// Fill color of each area, which is transparent if not colored
+	Colors   []color.NRGBA
+	Stars    []Star
+	Captions []string
+}
+
+const (
+	sceneMargin       = 20
+	captionLineHeight = 16
+)
+
+func (s *Scene) getTransform() transform {
+	min, max := GetBounds(s.Triangles, sceneMargin)
+	// Leave space for the captions at the bottom
+	height := s.Height - len(s.Captions)*captionLineHeight
+	return newTransform(s.Width, height, min, max)
+}
+
+func (s *Scene) getEdges() []puzzle.Line {
+	var edges []puzzle.Line
+	seen := make(map[puzzle.Line]bool)
+	for _, t := range s.Triangles {
+		for i := range t {
+			l := (&puzzle.Line{t[i], t[(i+1)%3]}).Normalized()
+			if !seen[l] {
+				seen[l] = true
+				edges = append(edges, l)
+			}
+		}
+	}
+	return edges
+}
+
+func (s *Scene) getVertices() []puzzle.Point {
+	var vertices []puzzle.Point
+	seen := make(map[puzzle.Point]bool)
+	for _, t := range s.Triangles {
+		for _, p := range t {
+			if !seen[p] {
+				seen[p] = true
+				vertices = append(vertices, p)
+			}
+		}
+	}
+	return vertices
+}
+
+// Get the baseline of the i-th caption from the top
+func (s *Scene) getCaptionY(i int) int {
+	return s.Height - (len(s.Captions)-i)*captionLineHeight + captionLineHeight/2
+}
+
+// Render the scene into an image
+func (s *Scene) Render() *image.RGBA {
+	t := s.getTransform()
+	c := &Canvas{
+		transform: t,
+		img:       image.NewRGBA(image.Rect(0, 0, s.Width, s.Height)),
+	}
+
+	for y := 0; y < s.Height; y++ {
+		clr := mixColor(SkyTopColor, SkyBottomColor, float64(y)/float64(s.Height))
+		for x := 0; x < s.Width; x++ {
+			c.img.Set(x, y, clr)
+		}
+	}
+
+	for _, star := range s.Stars {
+		p := c.ToWorld(&puzzle.Point{X: star.X * float64(s.Width), Y: star.Y * float64(s.Height)})
+		c.FillCircle(p, star.R, color.NRGBA{0xff, 0xff, 0xff, 0xc0})
+	}
+
+	for i := range s.Triangles {
+		if i < len(s.Colors) {
+			c.FillTriangle(&s.Triangles[i], s.Colors[i])
+		}
+	}
+	for _, l := range s.getEdges() {
+		c.DrawLine(&l[0], &l[1], 1.5, EdgeColor)
+	}
+	for _, p := range s.getVertices() {
+		c.FillCircle(&p, 3, VertexColor)
+	}
+
+	d := &font.Drawer{
+		Dst:  c.img,
+		Src:  image.NewUniform(CaptionColor),
+		Face: basicfont.Face7x13,
+	}
+	for i, caption := range s.Captions {
+		d.Dot = fixed.P(sceneMargin, s.getCaptionY(i))
+		d.DrawString(caption)
+	}
+
+	return c.img
+}
+
+func (s *Scene) WritePNG(w io.Writer) error {
+	return png.Encode(w, s.Render())
+}
+
+// Write the scene as SVG, whose shapes are the same as the rendered image
+func (s *Scene) WriteSVG(w io.Writer) error {
+	t := s.getTransform()
+	b := bufio.NewWriter(w)
+
+	fmt.Fprintf(b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n", s.Width, s.Height, s.Width, s.Height)
+	fmt.Fprintf(b, `<defs><linearGradient id="sky" x1="0" y1="0" x2="0" y2="1"><stop offset="0" stop-color="%s"/><stop offset="1" stop-color="%s"/></linearGradient></defs>`+"\n", svgColor(SkyTopColor), svgColor(SkyBottomColor))
+	fmt.Fprintf(b, `<rect width="%d" height="%d" fill="url(#sky)"/>`+"\n", s.Width, s.Height)
+
+	fmt.Fprintln(b, `<g fill="#ffffff" fill-opacity="0.75">`)
+	for _, star := range s.Stars {
+		fmt.Fprintf(b, `<circle cx="%.1f" cy="%.1f" r="%.1f"/>`+"\n", star.X*float64(s.Width), star.Y*float64(s.Height), star.R)
+	}
+	fmt.Fprintln(b, `</g>`)
+
+	fmt.Fprintln(b, `<g>`)
+	for i := range s.Triangles {
+		if i >= len(s.Colors) || s.Colors[i].A == 0 {
+			continue
+		}
+		tr := &s.Triangles[i]
+		p0, p1, p2 := t.ToPixel(&tr[0]), t.ToPixel(&tr[1]), t.ToPixel(&tr[2])
+		fmt.Fprintf(b, `<polygon points="%.1f,%.1f %.1f,%.1f %.1f,%.1f" fill="%s" fill-opacity="%.2f"/>`+"\n",
+			p0.X, p0.Y, p1.X, p1.Y, p2.X, p2.Y, svgColor(s.Colors[i]), float64(s.Colors[i].A)/0xff)
+	}
+	fmt.Fprintln(b, `</g>`)
+
+	fmt.Fprintf(b, `<g stroke="%s" stroke-width="1.5" stroke-linecap="round">`+"\n", svgColor(EdgeColor))
+	for _, l := range s.getEdges() {
+		p, q := t.ToPixel(&l[0]), t.ToPixel(&l[1])
+		fmt.Fprintf(b, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f"/>`+"\n", p.X, p.Y, q.X, q.Y)
+	}
+	fmt.Fprintln(b, `</g>`)
+
+	fmt.Fprintf(b, `<g fill="%s">`+"\n", svgColor(VertexColor))
+	for _, v := range s.getVertices() {
+		p := t.ToPixel(&v)
+		fmt.Fprintf(b, `<circle cx="%.1f" cy="%.1f" r="3"/>`+"\n", p.X, p.Y)
+	}
+	fmt.Fprintln(b, `</g>`)
+
+	if len(s.Captions) > 0 {
+		fmt.Fprintf(b, `<g fill="%s" font-family="monospace" font-size="13">`+"\n", svgColor(CaptionColor))
+		for i, caption := range s.Captions {
+			fmt.Fprintf(b, `<text x="%d" y="%d">%s</text>`+"\n", sceneMargin, s.getCaptionY(i), html.EscapeString(caption))
+		}
+		fmt.Fprintln(b, `</g>`)
+	}
+
+	fmt.Fprintln(b, `</svg>`)
+	return b.Flush()
+}
+
+func mixColor(a, b color.NRGBA, t float64) color.NRGBA {
+	mix := func(x, y uint8) uint8 {
+		return uint8(float64(x)*(1-t) + float64(y)*t)
+	}
+	return color.NRGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), mix(a.A, b.A)}
+}
+
+func svgColor(c color.NRGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"log"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/tsujio/game-four-color-theorem/puzzle"
+	"github.com/tsujio/game-util/touchutil"
+)
+
+const (
+	replayVersion    = 2
+	replayStorageKey = "replay"
+	// Ticks to keep showing the game over screen after the end of a replay
+	replayTailTicks = 120
+	replaySkipTicks = 10 * 60
+)
+
+var replaySpeeds = []int{1, 2, 4, 8}
+
+// Replay is the input log of a game from the rule selection. Since the game logic is deterministic
+// per tick, the game is reproduced by feeding the events to Update from the same seed and screen size.
+type Replay struct {
+	Version   int   `json:"version"`
+	Seed      int64 `json:"seed"`
+	StartTime int64 `json:"start_time"`
+	Rule      int   `json:"rule"`
+	// Puzzle code of the game, with which the rule is -1
+	Code string `json:"code,omitempty"`
+	// Opponent of the duel in the settings, on which the moves of the computer depend
+	DuelOpponent int           `json:"duel_opponent,omitempty"`
+	InputStyle   InputStyle    `json:"input_style"`
+	Width        float64       `json:"width"`
+	Height       float64       `json:"height"`
+	EndTicks     uint64        `json:"end_ticks"`
+	Events       []ReplayEvent `json:"events"`
+}
+
+type ReplayEvent struct {
+	Ticks uint64                   `json:"t"`
+	Touch *touchutil.TouchPosition `json:"touch,omitempty"`
+	// Tap on the map, which is made on the release of a touch
+	Tap    *touchutil.TouchPosition `json:"tap,omitempty"`
+	Camera *ReplayCamera            `json:"camera,omitempty"`
+	Size   *ReplaySize              `json:"size,omitempty"`
+	Op     *ReplayOp                `json:"op,omitempty"`
+}
+
+type ReplayCamera struct {
+	X     float64 `json:"x"`
+	Y     float64 `json:"y"`
+	Scale float64 `json:"scale"`
+}
+
+// ReplayOp is a coloring by another player of the co-op game
+type ReplayOp struct {
+	Area  int `json:"area"`
+	Color int `json:"color"`
+}
+
+type ReplaySize struct {
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+func (g *Game) loadReplay() (*Replay, bool) {
+	data, ok := g.storage.Load(replayStorageKey)
+	if !ok {
+		return nil, false
+	}
+
+	var r Replay
+	if err := json.Unmarshal([]byte(data), &r); err != nil {
+		log.Println(err)
+		return nil, false
+	}
+	if r.Version != replayVersion || r.Code == "" && (r.Rule < 0 || r.Rule >= len(gameRules)) {
+		return nil, false
+	}
+	if r.Code != "" {
+		if _, err := puzzle.DecodePuzzleCode(r.Code); err != nil {
+			log.Println(err)
+			return nil, false
+		}
+	}
+	return &r, true
+}
+
+func (g *Game) saveReplay(r *Replay) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if err := g.storage.Save(replayStorageKey, string(data)); err != nil {
+		log.Println(err)
+	}
+}
+
+func (g *Game) recordEvent(e ReplayEvent) {
+	if g.recording == nil {
+		return
+	}
+	e.Ticks = g.ticks
+	g.recording.Events = append(g.recording.Events, e)
+}
+
+// replayInput replays recorded taps as if they were touched
+type replayInput struct {
+	justTouched bool
+	position    touchutil.TouchPosition
+}
+
+func (i *replayInput) Update() {}
+
+func (i *replayInput) IsJustTouched() bool {
+	return i.justTouched
+}
+
+func (i *replayInput) IsJustReleased() bool {
+	return false
+}
+
+func (i *replayInput) IsBeingTouched() bool {
+	return i.justTouched
+}
+
+func (i *replayInput) GetTouchPosition() touchutil.TouchPosition {
+	return i.position
+}
+
+// Replays record the results of the keyboard and the mouse, such as camera moves, instead of them
+
+func (i *replayInput) AppendTouchPositions(positions []touchutil.TouchPosition) []touchutil.TouchPosition {
+	return positions
+}
+
+func (i *replayInput) GetCursorPosition() touchutil.TouchPosition {
+	return i.position
+}
+
+func (i *replayInput) IsMouseButtonPressed(button ebiten.MouseButton) bool {
+	return false
+}
+
+func (i *replayInput) GetWheel() float64 {
+	return 0
+}
+
+func (i *replayInput) AppendInputChars(runes []rune) []rune {
+	return runes
+}
+
+func (i *replayInput) IsKeyJustPressed(key ebiten.Key) bool {
+	return false
+}
+
+type ReplayPlayer struct {
+	replay       *Replay
+	eventIndex   int
+	input        *replayInput
+	touchContext TouchInput
+	speedIndex   int
+	paused       bool
+}
+
+// Get the current time as it was while recording
+func (p *ReplayPlayer) now(ticks uint64) time.Time {
+	return time.UnixMilli(p.replay.StartTime).Add(time.Duration(ticks) * time.Second / 60)
+}
+
+// Apply the events of the current tick in place of the real input
+func (p *ReplayPlayer) applyEvents(g *Game) {
+	p.input.justTouched = false
+	g.tap = nil
+	for ; p.eventIndex < len(p.replay.Events); p.eventIndex++ {
+		e := &p.replay.Events[p.eventIndex]
+		if e.Ticks > g.ticks {
+			break
+		}
+
+		if e.Size != nil {
+			g.resize(e.Size.Width, e.Size.Height)
+		}
+		if e.Camera != nil {
+			g.camera.center = Point{X: e.Camera.X, Y: e.Camera.Y}
+			g.camera.scale = e.Camera.Scale
+			g.cameraTarget = g.camera.center
+		}
+		if e.Op != nil {
+			g.applyCoopOp(e.Op.Area, e.Op.Color)
+		}
+		if e.Tap != nil {
+			g.tap = e.Tap
+		}
+		if e.Touch != nil {
+			p.input.justTouched = true
+			p.input.position = *e.Touch
+		}
+	}
+}
+
+func (g *Game) startReplay(r *Replay, touchContext TouchInput) {
+	g.replayPlayer = &ReplayPlayer{
+		replay:       r,
+		input:        &replayInput{},
+		touchContext: touchContext,
+	}
+	g.touchContext = g.replayPlayer.input
+	g.recording = nil
+	g.resize(r.Width, r.Height)
+	g.initialize()
+	if code, err := puzzle.DecodePuzzleCode(r.Code); r.Code != "" && err == nil {
+		g.startCode(code, r.InputStyle)
+	} else {
+		g.startGame(r.Rule, r.InputStyle)
+	}
+}
+
+func (g *Game) stopReplay() {
+	g.touchContext = g.replayPlayer.touchContext
+	g.replayPlayer = nil
+	g.initialize()
+	g.sound.PauseBGM()
+}
+
+// Move to the tick by simulating the game silently, from the start if it is in the past
+func (g *Game) seekReplay(ticks uint64) {
+	p := g.replayPlayer
+
+	sound := g.sound
+	g.sound = silentSound{}
+
+	if ticks < g.ticks {
+		speedIndex, paused := p.speedIndex, p.paused
+		g.startReplay(p.replay, p.touchContext)
+		g.replayPlayer.speedIndex, g.replayPlayer.paused = speedIndex, paused
+	}
+	for g.ticks < ticks {
+		g.step()
+	}
+
+	g.sound = sound
+	if g.mode == GameModePlaying || g.mode == GameModeNextMap || g.mode == GameModeGameOver {
+		g.sound.PlayBGM()
+	} else {
+		g.sound.PauseBGM()
+	}
+}
+
+func (g *Game) getReplayEndTicks() uint64 {
+	return g.replayPlayer.replay.EndTicks + replayTailTicks
+}
+
+func (g *Game) updateReplay() {
+	p := g.replayPlayer
+	p.touchContext.Update()
+
+	if p.touchContext.IsJustTouched() {
+		pos := p.touchContext.GetTouchPosition()
+		x, y := float64(pos.X), float64(pos.Y)
+
+		for i := 0; i < 4; i++ {
+			bx, by, bw, bh := g.getReplayButtonRect(i)
+			if x < bx || bx+bw < x || y < by || by+bh < y {
+				continue
+			}
+			switch i {
+			case 0:
+				g.stopReplay()
+				return
+			case 1:
+				if g.ticks > replaySkipTicks {
+					g.seekReplay(g.ticks - replaySkipTicks)
+				} else {
+					g.seekReplay(0)
+				}
+			case 2:
+				p.paused = !p.paused
+			case 3:
+				p.speedIndex = (p.speedIndex + 1) % len(replaySpeeds)
+			}
+		}
+
+		// Scrub by tapping the seek bar
+		bx, by, bw, bh := g.getReplaySeekBarRect()
+		if bx <= x && x <= bx+bw && by-bh <= y && y <= by+2*bh {
+			g.seekReplay(uint64((x - bx) / bw * float64(g.getReplayEndTicks())))
+		}
+	}
+
+	if p.paused {
+		return
+	}
+	for i := 0; i < replaySpeeds[p.speedIndex] && g.ticks < g.getReplayEndTicks(); i++ {
+		g.step()
+	}
+}
+
+func (g *Game) getReplayButtonRect(index int) (x, y, w, h float64) {
+	w, h = 100*g.uiScale, 24*g.uiScale
+	x = g.width/2 + (float64(index)-1.5)*(w+10*g.uiScale) - w/2
+	y = g.height - 70*g.uiScale
+	return
+}
+
+func (g *Game) getReplaySeekBarRect() (x, y, w, h float64) {
+	return 20 * g.uiScale, g.height - 30*g.uiScale, g.width - 40*g.uiScale, 6 * g.uiScale
+}
+
+func (g *Game) drawReplayControls(screen *ebiten.Image) {
+	p := g.replayPlayer
+
+	pauseLabel := msg("pause")
+	if p.paused {
+		pauseLabel = msg("play")
+	}
+	labels := []string{msg("back"), "<<", pauseLabel, fmt.Sprintf("x%d", replaySpeeds[p.speedIndex])}
+	for i, s := range labels {
+		x, y, w, h := g.getReplayButtonRect(i)
+		ebitenutil.DrawRect(screen, x, y, w, h, color.RGBA{0xff, 0xff, 0xff, 0x30})
+		g.drawText(screen, s, fontS, x+w/2, y+h/2+fontS.FaceOptions.Size*g.uiScale/2, TextAlignCenter, color.White)
+	}
+
+	x, y, w, h := g.getReplaySeekBarRect()
+	ebitenutil.DrawRect(screen, x, y, w, h, color.RGBA{0xff, 0xff, 0xff, 0x30})
+	ratio := float64(g.ticks) / float64(g.getReplayEndTicks())
+	ebitenutil.DrawRect(screen, x, y, w*ratio, h, color.White)
+
+	g.drawText(screen, msg("replay"), fontS, 10*g.uiScale, g.height-80*g.uiScale, TextAlignLeft, color.White)
+}
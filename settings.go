@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"log"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+)
+
+const settingsStorageKey = "settings"
+
+type InputStyle int
+
+const (
+	InputStyleCycle InputStyle = iota
+	InputStylePalette
+)
+
+const maxVolume = 10
+
+// Settings are chosen by the player and persisted in the storage of each platform
+type Settings struct {
+	MasterVolume       int        `json:"master_volume"`
+	Mute               bool       `json:"mute"`
+	BGMVolume          int        `json:"bgm_volume"`
+	SFXVolume          int        `json:"sfx_volume"`
+	Palette            int        `json:"palette"`
+	Patterns           bool       `json:"patterns"`
+	InputStyle         InputStyle `json:"input_style"`
+	HighlightConflicts bool       `json:"highlight_conflicts"`
+	Language           string     `json:"language"`
+	ExportCaptions     bool       `json:"export_captions"`
+	DebugOverlay       bool       `json:"debug_overlay"`
+	DuelOpponent       int        `json:"duel_opponent"`
+}
+
+var defaultSettings = Settings{
+	MasterVolume: maxVolume,
+	BGMVolume:    maxVolume,
+	SFXVolume:    maxVolume,
+	Language:     "EN",
+}
+
+// Settings of the process, which are loaded from the storage of the game
+var settings = defaultSettings
+
+func (g *Game) loadSettings() {
+	settings = defaultSettings
+	if data, ok := g.storage.Load(settingsStorageKey); ok {
+		if err := json.Unmarshal([]byte(data), &settings); err != nil {
+			log.Println(err)
+			settings = defaultSettings
+		}
+	}
+}
+
+func (g *Game) saveSettings() {
+	data, err := json.Marshal(&settings)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if err := g.storage.Save(settingsStorageKey, string(data)); err != nil {
+		log.Println(err)
+	}
+}
+
+// Apply settings which need to be pushed to others
+func (g *Game) applySettings() {
+	g.sound.SetVolumes(
+		float64(settings.MasterVolume)/maxVolume,
+		float64(settings.BGMVolume)/maxVolume,
+		float64(settings.SFXVolume)/maxVolume,
+	)
+	g.sound.SetMuted(settings.Mute)
+}
+
+type settingsItem struct {
+	label  string
+	value  func() string
+	change func(g *Game, delta int)
+}
+
+func cycle(v, delta, n int) int {
+	return ((v+delta)%n + n) % n
+}
+
+func onOff(b bool) string {
+	if b {
+		return msg("on")
+	}
+	return msg("off")
+}
+
+var settingsItems = []settingsItem{
+	{
+		label: "master_volume",
+		value: func() string { return fmt.Sprintf("- %2d +", settings.MasterVolume) },
+		change: func(g *Game, delta int) {
+			settings.MasterVolume = clampInt(settings.MasterVolume+delta, 0, maxVolume)
+		},
+	},
+	{
+		label: "mute",
+		value: func() string { return onOff(settings.Mute) },
+		change: func(g *Game, delta int) {
+			settings.Mute = !settings.Mute
+		},
+	},
+	{
+		label: "bgm_volume",
+		value: func() string { return fmt.Sprintf("- %2d +", settings.BGMVolume) },
+		change: func(g *Game, delta int) {
+			settings.BGMVolume = clampInt(settings.BGMVolume+delta, 0, maxVolume)
+		},
+	},
+	{
+		label: "sfx_volume",
+		value: func() string { return fmt.Sprintf("- %2d +", settings.SFXVolume) },
+		change: func(g *Game, delta int) {
+			settings.SFXVolume = clampInt(settings.SFXVolume+delta, 0, maxVolume)
+			g.applySettings()
+			g.sound.PlayStream(newToneStream(getScaleNoteFrequency(0), 0))
+		},
+	},
+	{
+		label: "palette",
+		value: func() string { return getPalette().name },
+		change: func(g *Game, delta int) {
+			settings.Palette = cycle(settings.Palette, delta, len(palettes))
+		},
+	},
+	{
+		label: "patterns",
+		value: func() string { return onOff(settings.Patterns) },
+		change: func(g *Game, delta int) {
+			settings.Patterns = !settings.Patterns
+		},
+	},
+	{
+		label: "input",
+		value: func() string {
+			if settings.InputStyle == InputStylePalette {
+				return msg("input_palette")
+			}
+			return msg("input_cycle")
+		},
+		change: func(g *Game, delta int) {
+			settings.InputStyle = InputStyle(cycle(int(settings.InputStyle), delta, 2))
+		},
+	},
+	{
+		label: "conflicts",
+		value: func() string { return onOff(settings.HighlightConflicts) },
+		change: func(g *Game, delta int) {
+			settings.HighlightConflicts = !settings.HighlightConflicts
+		},
+	},
+	{
+		label: "language",
+		value: func() string { return settings.Language },
+		change: func(g *Game, delta int) {
+			i := 0
+			for j, l := range languages {
+				if l == settings.Language {
+					i = j
+				}
+			}
+			settings.Language = languages[cycle(i, delta, len(languages))]
+		},
+	},
+	{
+		label: "opponent",
+		value: func() string {
+			if settings.DuelOpponent == 0 {
+				return msg("human")
+			}
+			return fmt.Sprintf("CPU %d", settings.DuelOpponent)
+		},
+		change: func(g *Game, delta int) {
+			settings.DuelOpponent = cycle(settings.DuelOpponent, delta, len(duelOpponentLevels))
+		},
+	},
+	{
+		label: "captions",
+		value: func() string { return onOff(settings.ExportCaptions) },
+		change: func(g *Game, delta int) {
+			settings.ExportCaptions = !settings.ExportCaptions
+		},
+	},
+	{
+		label: "debug",
+		value: func() string { return onOff(settings.DebugOverlay) },
+		change: func(g *Game, delta int) {
+			settings.DebugOverlay = !settings.DebugOverlay
+		},
+	},
+}
+
+func clampInt(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+func (g *Game) getSettingsItemRect(index int) (x, y, w, h float64) {
+	return 360, 70 + float64(index)*26, 240, 22
+}
+
+func (g *Game) getSettingsButtonRect() (x, y, w, h float64) {
+	return screenWidth - 10 - 140, 6, 140, 22
+}
+
+func (g *Game) getSettingsBackButtonRect() (x, y, w, h float64) {
+	return screenWidth/2 - 80, 400, 160, 28
+}
+
+func (g *Game) updateSettings() {
+	if !g.touchContext.IsJustTouched() {
+		return
+	}
+
+	pos := g.touchContext.GetTouchPosition()
+	p := g.getUICamera().toWorld(&Point{X: float64(pos.X), Y: float64(pos.Y)})
+
+	for i, item := range settingsItems {
+		x, y, w, h := g.getSettingsItemRect(i)
+		if p.X < x || x+w < p.X || p.Y < y || y+h < p.Y {
+			continue
+		}
+
+		// Left side of the value decreases and right side increases it
+		delta := 1
+		if p.X < x+w/3 {
+			delta = -1
+		}
+		item.change(g, delta)
+
+		g.applySettings()
+		g.saveSettings()
+	}
+
+	if x, y, w, h := g.getSettingsBackButtonRect(); x <= p.X && p.X <= x+w && y <= p.Y && p.Y <= y+h {
+		g.setNextMode(GameModeTitle)
+	}
+}
+
+func (g *Game) drawSettings(screen *ebiten.Image) {
+	ebitenutil.DrawRect(screen, 0, 0, g.width, g.height, color.RGBA{0, 0, 0, 0x80})
+
+	g.drawUIText(screen, msg("settings"), fontM, screenWidth/2, 60, TextAlignCenter, color.White)
+
+	uiCamera := g.getUICamera()
+	for i, item := range settingsItems {
+		x, y, w, h := g.getSettingsItemRect(i)
+		g.drawUIText(screen, msg(item.label), fontS, 40, y+h/2+fontS.FaceOptions.Size/2, TextAlignLeft, color.White)
+
+		p := uiCamera.toScreen(&Point{X: x, Y: y})
+		ebitenutil.DrawRect(screen, p.X, p.Y, w*uiCamera.scale, h*uiCamera.scale, color.RGBA{0xff, 0xff, 0xff, 0x30})
+		g.drawUIText(screen, item.value(), fontS, x+w/2, y+h/2+fontS.FaceOptions.Size/2, TextAlignCenter, color.White)
+	}
+
+	x, y, w, h := g.getSettingsBackButtonRect()
+	p := uiCamera.toScreen(&Point{X: x, Y: y})
+	ebitenutil.DrawRect(screen, p.X, p.Y, w*uiCamera.scale, h*uiCamera.scale, color.RGBA{0xff, 0xff, 0xff, 0x30})
+	g.drawUIText(screen, msg("back"), fontS, x+w/2, y+h/2+fontS.FaceOptions.Size/2, TextAlignCenter, color.White)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"math"
+	"time"
+
+	"github.com/tsujio/game-four-color-theorem/puzzle"
+)
+
+// Simulator runs the game headlessly with scripted taps, a manual clock and
+// in-memory telemetry and storage, so that tests can step it tick by tick:
+//
+//	s := newSimulator(1)
+//	s.tapRule(0)
+//	s.stepUntil(GameModePlaying, 20*60)
+//	s.solve()
+//	s.stepUntil(GameModeGameOver, 60)
+type Simulator struct {
+	game      *Game
+	input     *ScriptedInput
+	clock     *ManualClock
+	telemetry *memorySink
+	storage   memoryStorage
+}
+
+func newSimulator(seed int64) *Simulator {
+	s := &Simulator{
+		input:     &ScriptedInput{},
+		clock:     &ManualClock{now: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)},
+		telemetry: &memorySink{},
+		storage:   memoryStorage{},
+	}
+	s.game = &Game{
+		playerID:        "simulator",
+		fixedRandomSeed: seed,
+		touchContext:    s.input,
+		sound:           silentSound{},
+		clock:           s.clock,
+		telemetry:       s.telemetry,
+		storage:         s.storage,
+		width:           screenWidth,
+		height:          screenHeight,
+		uiScale:         1.0,
+	}
+	// Settings are shared by the process, which start from the defaults of the empty storage
+	s.game.loadSettings()
+	s.game.initialize()
+	return s
+}
+
+func (s *Simulator) step(n int) {
+	for i := 0; i < n; i++ {
+		s.game.Update()
+		s.clock.Advance(time.Second / 60)
+	}
+}
+
+// Step until the game enters the mode, or return false if it does not within maxTicks
+func (s *Simulator) stepUntil(mode GameMode, maxTicks int) bool {
+	for i := 0; i < maxTicks; i++ {
+		if s.game.mode == mode {
+			return true
+		}
+		s.step(1)
+	}
+	return s.game.mode == mode
+}
+
+// Tap the point on the screen and step the ticks of the touch and the release,
+// and the ticks until the next tap as fast as proofs allow
+func (s *Simulator) tap(p *Point) {
+	s.input.tap(int(math.Round(p.X)), int(math.Round(p.Y)))
+	s.step(puzzle.MinColorEventInterval)
+}
+
+// Tap the center of the rect in the design coordinates of the UI
+func (s *Simulator) tapUI(x, y, w, h float64) {
+	s.tap(s.game.getUICamera().toScreen(&Point{X: x + w/2, Y: y + h/2}))
+}
+
+func (s *Simulator) tapRule(index int) {
+	s.tapUI(s.game.getRuleButtonRect(index))
+}
+
+func (s *Simulator) tapArea(index int) {
+	a := &s.game.areas[index]
+	s.tap(s.game.camera.toScreen(a.Triangle.Center()))
+}
+
+// Tap until the area has the color in either input style
+func (s *Simulator) colorArea(index, color int) {
+	g := s.game
+	if g.inputStyle == InputStylePalette {
+		if g.selectedColor != color {
+			x, y, w, h := g.getColorSwatchRect(color)
+			s.tap(&Point{X: x + w/2, Y: y + h/2})
+		}
+		if g.areas[index].color != color {
+			s.tapArea(index)
+		}
+		return
+	}
+
+	for i := 0; i < g.rule.colorNum && g.areas[index].color != color; i++ {
+		s.tapArea(index)
+	}
+}
+
+// Color all areas with a valid coloring, which completes the map
+func (s *Simulator) solve() {
+	var triangles []Triangle
+	for _, a := range s.game.areas {
+		triangles = append(triangles, a.Triangle)
+	}
+	colors := puzzle.FindColoring(puzzle.GetTriangleAdjacents(triangles), s.game.rule.colorNum)
+	for i, c := range colors {
+		if s.game.mode != GameModePlaying {
+			break
+		}
+		s.colorArea(i, c)
+	}
+}
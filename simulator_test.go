@@ -0,0 +1,218 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/tsujio/game-four-color-theorem/puzzle"
+	"github.com/tsujio/game-util/touchutil"
+)
+
+// Get the events of the type sent to the sink
+func getEvents[T TelemetryEvent](s *memorySink) []T {
+	var events []T
+	for _, e := range s.events {
+		if e, ok := e.(T); ok {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+func TestSimulatorPlaysGame(t *testing.T) {
+	s := newSimulator(1)
+	if s.game.mode != GameModeTitle {
+		t.Fatalf("game started in mode %d", s.game.mode)
+	}
+
+	s.tapRule(0)
+	if s.game.mode != GameModeOpening {
+		t.Fatalf("rule tapped in mode %d", s.game.mode)
+	}
+	if !s.stepUntil(GameModePlaying, 20*60) {
+		t.Fatal("opening not finished")
+	}
+
+	s.solve()
+	if !s.stepUntil(GameModeGameOver, 60) {
+		t.Fatalf("game not over after solving, in mode %d", s.game.mode)
+	}
+
+	for i, a := range s.game.areas {
+		if a.color < 0 || a.color >= s.game.rule.colorNum || a.status != AreaStatusOK {
+			t.Fatalf("area %d has color %d and status %d", i, a.color, a.status)
+		}
+		for _, b := range a.adjacents {
+			if b.color == a.color {
+				t.Fatalf("areas %d and %d have the same color", a.id, b.id)
+			}
+		}
+	}
+	if s.game.score <= 0 {
+		t.Fatalf("score %d", s.game.score)
+	}
+
+	starts := getEvents[StartGameEvent](s.telemetry)
+	if len(starts) != 1 || starts[0].Colors != 4 || starts[0].Seed != s.game.seed {
+		t.Fatalf("start events %v", starts)
+	}
+	if changes := getEvents[ColorChangeEvent](s.telemetry); len(changes) < len(s.game.areas) {
+		t.Fatalf("%d color changes for %d areas", len(changes), len(s.game.areas))
+	}
+	overs := getEvents[GameOverEvent](s.telemetry)
+	if len(overs) != 1 || overs[0].Score != s.game.score || overs[0].UsedColor > 4 {
+		t.Fatalf("game over events %v, score %d", overs, s.game.score)
+	}
+	if s.telemetry.scores[s.game.getRankingName()] != s.game.score {
+		t.Fatalf("registered scores %v, score %d", s.telemetry.scores, s.game.score)
+	}
+
+	// The proof sent with the score achieves it
+	proof, err := puzzle.DecodeProof(overs[0].Proof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := puzzle.Verify(proof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Score != s.game.score {
+		t.Fatalf("proof scores %d, score %d", result.Score, s.game.score)
+	}
+}
+
+func TestSimulatorPlaysMarathon(t *testing.T) {
+	s := newSimulator(5)
+	for i, r := range gameRules {
+		if r.marathon {
+			s.tapRule(i)
+		}
+	}
+	if !s.stepUntil(GameModePlaying, 20*60) {
+		t.Fatal("opening not finished")
+	}
+
+	// The next map is the one regenerated from the seed, though generated in the background
+	for n := 1; n <= 2; n++ {
+		s.solve()
+		if !s.stepUntil(GameModeNextMap, 60) || !s.stepUntil(GameModePlaying, 10*60) || s.game.marathonMapNum != n {
+			t.Fatalf("map %d not started, in mode %d", n, s.game.mode)
+		}
+	}
+	if completes := getEvents[MarathonMapCompleteEvent](s.telemetry); len(completes) != 2 || completes[1].Score != 2 {
+		t.Fatalf("map complete events %v", completes)
+	}
+
+	random := rand.New(rand.NewSource(s.game.seed))
+	var expected []puzzle.Triangle
+	for n := 0; n <= 2; n++ {
+		expected = puzzle.GenerateMap(random, 4, puzzle.GetMaxTriangleNum(true, n))
+	}
+	if len(expected) != len(s.game.areas) {
+		t.Fatalf("map has %d areas, expected %d", len(s.game.areas), len(expected))
+	}
+	for i, a := range s.game.areas {
+		if a.Triangle != expected[i] {
+			t.Fatalf("area %d is %v, expected %v", i, a.Triangle, expected[i])
+		}
+	}
+}
+
+func TestSimulatorExtendsZenMap(t *testing.T) {
+	s := newSimulator(1)
+	for i, r := range gameRules {
+		if r.zen {
+			s.tapRule(i)
+		}
+	}
+	if !s.stepUntil(GameModePlaying, 20*60) {
+		t.Fatal("opening not finished")
+	}
+
+	for n := 1; n <= 2; n++ {
+		areaNum := len(s.game.areas)
+		s.solve()
+		s.step(1)
+		if s.game.mode != GameModePlaying || len(s.game.areas) <= areaNum {
+			t.Fatalf("map of %d areas not extended, in mode %d", areaNum, s.game.mode)
+		}
+		if extends := getEvents[ZenExtendEvent](s.telemetry); len(extends) != n || extends[n-1].Areas != len(s.game.areas) {
+			t.Fatalf("extend events %v with %d areas", extends, len(s.game.areas))
+		}
+	}
+}
+
+func TestSimulatorMovesCameraByMouseAndPinch(t *testing.T) {
+	s := newSimulator(1)
+	s.tapRule(0)
+	if !s.stepUntil(GameModePlaying, 20*60) {
+		t.Fatal("opening not finished")
+	}
+	camera := s.game.camera
+	c := camera.viewCenter
+	x, y := int(c.X), int(c.Y)
+
+	scale := camera.scale
+	s.input.moveCursor(x, y)
+	s.input.scroll(1)
+	s.step(1)
+	if math.Abs(camera.scale-scale*1.1) > 1e-9 {
+		t.Fatalf("scale %f after scrolling from %f", camera.scale, scale)
+	}
+
+	center := camera.center
+	s.input.setMouseButtons(ebiten.MouseButtonRight)
+	s.step(1)
+	s.input.moveCursor(x+100, y)
+	s.step(1)
+	s.input.setMouseButtons()
+	s.step(1)
+	if math.Abs(center.X-camera.center.X-100/camera.scale) > 1e-9 || camera.center.Y != center.Y {
+		t.Fatalf("center %v after dragging from %v", camera.center, center)
+	}
+
+	scale = camera.scale
+	s.input.setTouches(touchutil.TouchPosition{X: x - 50, Y: y}, touchutil.TouchPosition{X: x + 50, Y: y})
+	s.step(1)
+	s.input.setTouches(touchutil.TouchPosition{X: x - 100, Y: y}, touchutil.TouchPosition{X: x + 100, Y: y})
+	s.step(1)
+	s.input.setTouches()
+	s.step(1)
+	if math.Abs(camera.scale-math.Min(scale*2, cameraMaxScale)) > 1e-9 {
+		t.Fatalf("scale %f after pinching from %f", camera.scale, scale)
+	}
+}
+
+func TestSimulatorEntersCode(t *testing.T) {
+	s := newSimulator(1)
+	s.tapUI(s.game.getCodeButtonRect())
+	if s.game.mode != GameModeCode {
+		t.Fatalf("code button tapped in mode %d", s.game.mode)
+	}
+
+	code := &puzzle.PuzzleCode{GeneratorVersion: puzzle.GeneratorVersion, Seed: 12345, Mode: puzzle.ModeNormal, ColorNum: 4}
+	s.input.typeText(code.Encode() + "x")
+	s.step(1)
+	s.input.pressKey(ebiten.KeyBackspace)
+	s.input.pressKey(ebiten.KeyEnter)
+	s.step(1)
+	if s.game.mode != GameModeOpening || s.game.seed != code.Seed {
+		t.Fatalf("code %q entered in mode %d with seed %d", s.game.codeInput, s.game.mode, s.game.seed)
+	}
+}
+
+func TestSimulatorLeavesVersusLobbyByEscape(t *testing.T) {
+	s := newSimulator(1)
+	s.tapUI(s.game.getVersusRoomButtonRect())
+	if s.game.mode != GameModeVersus {
+		t.Fatalf("versus button tapped in mode %d", s.game.mode)
+	}
+
+	s.input.pressKey(ebiten.KeyEscape)
+	s.step(1)
+	if s.game.mode != GameModeTitle {
+		t.Fatalf("escape pressed in mode %d", s.game.mode)
+	}
+}
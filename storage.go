@@ -0,0 +1,31 @@
+package main
+
+// Storage keeps small data of the player, which is implemented by
+// platformStorage and by memoryStorage for headless runs
+type Storage interface {
+	Load(key string) (string, bool)
+	Save(key, value string) error
+}
+
+// platformStorage uses the storage of each platform
+type platformStorage struct{}
+
+func (platformStorage) Load(key string) (string, bool) {
+	return loadStorageItem(key)
+}
+
+func (platformStorage) Save(key, value string) error {
+	return saveStorageItem(key, value)
+}
+
+type memoryStorage map[string]string
+
+func (s memoryStorage) Load(key string) (string, bool) {
+	v, ok := s[key]
+	return v, ok
+}
+
+func (s memoryStorage) Save(key, value string) error {
+	s[key] = value
+	return nil
+}
@@ -0,0 +1,39 @@
+//go:build !js
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+func getStorageDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "tsujio-game-"+gameName), nil
+}
+
+func loadStorageItem(key string) (string, bool) {
+	dir, err := getStorageDir()
+	if err != nil {
+		return "", false
+	}
+	data, err := os.ReadFile(filepath.Join(dir, key))
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+func saveStorageItem(key, value string) error {
+	dir, err := getStorageDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, key), []byte(value), 0644)
+}
@@ -0,0 +1,33 @@
+//go:build js
+
+package main
+
+import (
+	"fmt"
+	"syscall/js"
+)
+
+func storageKey(key string) string {
+	return gameName + "." + key
+}
+
+func loadStorageItem(key string) (string, bool) {
+	storage := js.Global().Get("localStorage")
+	if storage.IsUndefined() || storage.IsNull() {
+		return "", false
+	}
+	v := storage.Call("getItem", storageKey(key))
+	if v.IsNull() {
+		return "", false
+	}
+	return v.String(), true
+}
+
+func saveStorageItem(key, value string) error {
+	storage := js.Global().Get("localStorage")
+	if storage.IsUndefined() || storage.IsNull() {
+		return fmt.Errorf("localStorage is not available")
+	}
+	storage.Call("setItem", storageKey(key), value)
+	return nil
+}
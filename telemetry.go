@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tsujio/game-four-color-theorem/loggingserver"
+	logging "github.com/tsujio/game-logging-server/client"
+)
+
+// TelemetryEvent is an event of the play, which is sent with its action name
+type TelemetryEvent interface {
+	action() string
+}
+
+type InitializeEvent struct {
+	Seed int64 `json:"seed"`
+}
+
+type StartGameEvent struct {
+	Colors         int    `json:"colors"`
+	MinimizeColors bool   `json:"minimize_colors"`
+	Daily          string `json:"daily"`
+	Marathon       bool   `json:"marathon"`
+	Zen            bool   `json:"zen"`
+	Duel           bool   `json:"duel"`
+	Seed           int64  `json:"seed"`
+	Code           string `json:"code"`
+}
+
+type PlayingEvent struct {
+	Ticks uint64 `json:"ticks"`
+	Score int    `json:"score"`
+}
+
+type ColorChangeEvent struct {
+	Ticks uint64 `json:"ticks"`
+	Map   int    `json:"map"`
+	Area  int    `json:"area"`
+	Color int    `json:"color"`
+}
+
+type MarathonMapCompleteEvent struct {
+	Ticks uint64 `json:"ticks"`
+	Score int    `json:"score"`
+}
+
+type ZenExtendEvent struct {
+	Areas int `json:"areas"`
+}
+
+type GameOverEvent struct {
+	Score     int    `json:"score"`
+	UsedColor int    `json:"used_color"`
+	Proof     string `json:"proof,omitempty"`
+}
+
+// TouchEvent is a tick while being touched, which is sent by sinks without their own touch logs
+type TouchEvent struct {
+	Ticks        uint64       `json:"ticks"`
+	JustTouched  bool         `json:"just_touched"`
+	JustReleased bool         `json:"just_released"`
+	X            int          `json:"x"`
+	Y            int          `json:"y"`
+	Camera       *TouchCamera `json:"camera,omitempty"`
+}
+
+// TouchCamera is the camera while touching, with which the screen positions
+// of touches are converted into the world
+type TouchCamera struct {
+	X     float64 `json:"x"`
+	Y     float64 `json:"y"`
+	Scale float64 `json:"scale"`
+	ViewX float64 `json:"view_x"`
+	ViewY float64 `json:"view_y"`
+}
+
+func newTouchCamera(c *Camera) *TouchCamera {
+	return &TouchCamera{
+		X:     c.center.X,
+		Y:     c.center.Y,
+		Scale: c.scale,
+		ViewX: c.viewCenter.X,
+		ViewY: c.viewCenter.Y,
+	}
+}
+
+func (InitializeEvent) action() string          { return "initialize" }
+func (StartGameEvent) action() string           { return "start_game" }
+func (PlayingEvent) action() string             { return "playing" }
+func (ColorChangeEvent) action() string         { return "color_change" }
+func (MarathonMapCompleteEvent) action() string { return "marathon_map_complete" }
+func (ZenExtendEvent) action() string           { return "zen_extend" }
+func (GameOverEvent) action() string            { return "game_over" }
+func (TouchEvent) action() string               { return "touch" }
+
+// TelemetryRecord is an event with its sender, which is written as a JSON line
+// by writerSink and sent in batches by TelemetryQueue
+type TelemetryRecord struct {
+	Time     int64           `json:"time"`
+	PlayerID string          `json:"player_id"`
+	PlayID   string          `json:"play_id"`
+	Action   string          `json:"action"`
+	Event    json.RawMessage `json:"event"`
+}
+
+func newTelemetryRecord(playerID, playID string, e TelemetryEvent) (*TelemetryRecord, error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	return &TelemetryRecord{
+		Time:     time.Now().UnixMilli(),
+		PlayerID: playerID,
+		PlayID:   playID,
+		Action:   e.action(),
+		Event:    data,
+	}, nil
+}
+
+// TelemetrySink receives telemetry events and scores
+type TelemetrySink interface {
+	Send(playerID, playID string, e TelemetryEvent)
+	SendTouches(playerID, playID string, ticks uint64, input TouchInput, camera *Camera)
+	// Send the pending events now, such as at the game over
+	Flush()
+	RegisterScore(rankingName, playerID, playID string, score int) <-chan []logging.GameScore
+}
+
+// Create the sink from the configuration, which is one of
+// "server", "server:<url>", "stdout", "file:<path>" or "none".
+// The server sink queues events in the storage while offline, and
+// sends them to the url instead of the production server if given,
+// such as the local stand-in of cmd/logging-server.
+func newTelemetrySink(config string, storage Storage) TelemetrySink {
+	logging.Disable()
+
+	switch {
+	case config == "server" || strings.HasPrefix(config, "server:"):
+		if u := strings.TrimPrefix(config, "server:"); u != config {
+			serverURL, err := url.Parse(u)
+			if err != nil || serverURL.Host == "" {
+				log.Printf("invalid logging server url %q", u)
+				return nopSink{}
+			}
+			loggingserver.Redirect(serverURL)
+		}
+
+		secret, err := resources.ReadFile("resources/secret")
+		if err != nil {
+			log.Println(err)
+			return nopSink{}
+		}
+		logging.Enable(string(secret))
+		return newTelemetryQueue(sendTelemetryBatchToServer, storage)
+	case config == "stdout":
+		return &writerSink{w: os.Stdout}
+	case strings.HasPrefix(config, "file:"):
+		f, err := os.OpenFile(strings.TrimPrefix(config, "file:"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			log.Println(err)
+			return nopSink{}
+		}
+		return &writerSink{w: f}
+	default:
+		return nopSink{}
+	}
+}
+
+// writerSink writes events as JSON lines, for files and stdout
+type writerSink struct {
+	w  io.Writer
+	mu sync.Mutex
+}
+
+func (s *writerSink) write(playerID, playID string, e TelemetryEvent) {
+	record, err := newTelemetryRecord(playerID, playID, e)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.w.Write(append(data, '\n')); err != nil {
+		log.Println(err)
+	}
+}
+
+func (s *writerSink) Send(playerID, playID string, e TelemetryEvent) {
+	s.write(playerID, playID, e)
+}
+
+func (s *writerSink) SendTouches(playerID, playID string, ticks uint64, input TouchInput, camera *Camera) {
+	if input.IsBeingTouched() || input.IsJustReleased() {
+		pos := input.GetTouchPosition()
+		s.write(playerID, playID, TouchEvent{
+			Ticks:        ticks,
+			JustTouched:  input.IsJustTouched(),
+			JustReleased: input.IsJustReleased(),
+			X:            pos.X,
+			Y:            pos.Y,
+			Camera:       newTouchCamera(camera),
+		})
+	}
+}
+
+func (s *writerSink) Flush() {}
+
+func (s *writerSink) RegisterScore(rankingName, playerID, playID string, score int) <-chan []logging.GameScore {
+	return closedRankingChannel()
+}
+
+type nopSink struct{}
+
+func (nopSink) Send(playerID, playID string, e TelemetryEvent)                                      {}
+func (nopSink) SendTouches(playerID, playID string, ticks uint64, input TouchInput, camera *Camera) {}
+func (nopSink) Flush()                                                                              {}
+func (nopSink) RegisterScore(rankingName, playerID, playID string, score int) <-chan []logging.GameScore {
+	return closedRankingChannel()
+}
+
+// memorySink keeps events in memory for headless runs
+type memorySink struct {
+	events []TelemetryEvent
+	scores map[string]int
+}
+
+func (s *memorySink) Send(playerID, playID string, e TelemetryEvent) {
+	s.events = append(s.events, e)
+}
+
+func (s *memorySink) SendTouches(playerID, playID string, ticks uint64, input TouchInput, camera *Camera) {
+}
+
+func (s *memorySink) Flush() {}
+
+func (s *memorySink) RegisterScore(rankingName, playerID, playID string, score int) <-chan []logging.GameScore {
+	if s.scores == nil {
+		s.scores = make(map[string]int)
+	}
+	s.scores[rankingName] = score
+	return closedRankingChannel()
+}
+
+// Ranking channel of sinks without rankings
+func closedRankingChannel() <-chan []logging.GameScore {
+	ch := make(chan []logging.GameScore)
+	close(ch)
+	return ch
+}
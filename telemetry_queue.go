@@ -0,0 +1,329 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	logging "github.com/tsujio/game-logging-server/client"
+	"github.com/tsujio/game-util/loggingutil"
+)
+
+const (
+	telemetryQueueStorageKey = "telemetry_queue"
+	telemetryQueueMaxSize    = 1000
+	telemetryBatchMaxSize    = 50
+	telemetryFlushInterval   = 10 * time.Second
+	telemetryMinBackoff      = 2 * time.Second
+	telemetryMaxBackoff      = 5 * time.Minute
+	touchStreamMaxSize       = 300
+)
+
+// Touch states in TouchStreamEvent
+const (
+	touchStateReleased = iota
+	touchStateTouched
+	touchStateMoved
+)
+
+// TouchStreamEvent is a compressed stream of touches. Only the ticks where the touch changes
+// are recorded, each as [ticks, x, y, state] relative to the previous one, or to ticks and (0, 0)
+// for the first. Cameras are recorded with the indexes of the deltas from which they are used.
+type TouchStreamEvent struct {
+	Ticks   uint64              `json:"ticks"`
+	Deltas  [][4]int            `json:"deltas"`
+	Cameras []TouchStreamCamera `json:"cameras"`
+}
+
+type TouchStreamCamera struct {
+	Index int `json:"index"`
+	TouchCamera
+}
+
+func (TouchStreamEvent) action() string { return "touches" }
+
+// TelemetryBatch is the records sent in a request
+type TelemetryBatch struct {
+	Records []TelemetryRecord `json:"records"`
+}
+
+func sendTelemetryBatchToServer(b *TelemetryBatch) error {
+	return logging.Log(gameName, b)
+}
+
+// TelemetryStats is the health of the queue shown in the debug overlay
+type TelemetryStats struct {
+	Queued      int
+	Dropped     int
+	SentBatches int
+	Failures    int
+	Backoff     time.Duration
+	LastError   string
+}
+
+// TelemetryQueue keeps events in a bounded queue, optionally persisted in the storage,
+// and sends them in batches from a background goroutine, retrying with backoff on failures
+type TelemetryQueue struct {
+	send    func(*TelemetryBatch) error
+	storage Storage
+	flushCh chan struct{}
+
+	mu      sync.Mutex
+	records []TelemetryRecord
+	// Sequence numbers of the records to find sent ones after some are dropped
+	seqs    []uint64
+	nextSeq uint64
+	dirty   bool
+	stats   TelemetryStats
+
+	// Touch stream being built
+	touchPlayerID string
+	touchPlayID   string
+	touchStream   *TouchStreamEvent
+	lastX, lastY  int
+	lastCamera    TouchCamera
+	lastTicks     uint64
+	touching      bool
+}
+
+// Create the queue and start sending. The storage can be nil not to persist the queue.
+func newTelemetryQueue(send func(*TelemetryBatch) error, storage Storage) *TelemetryQueue {
+	q := &TelemetryQueue{
+		send:    send,
+		storage: storage,
+		flushCh: make(chan struct{}, 1),
+	}
+	q.load()
+	go q.run()
+	return q
+}
+
+func (q *TelemetryQueue) load() {
+	if q.storage == nil {
+		return
+	}
+	data, ok := q.storage.Load(telemetryQueueStorageKey)
+	if !ok {
+		return
+	}
+	var records []TelemetryRecord
+	if err := json.Unmarshal([]byte(data), &records); err != nil {
+		log.Println(err)
+		return
+	}
+	for _, r := range records {
+		q.push(r)
+	}
+}
+
+func (q *TelemetryQueue) save() {
+	q.mu.Lock()
+	if q.storage == nil || !q.dirty {
+		q.mu.Unlock()
+		return
+	}
+	data, err := json.Marshal(q.records)
+	q.dirty = false
+	q.mu.Unlock()
+
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if err := q.storage.Save(telemetryQueueStorageKey, string(data)); err != nil {
+		log.Println(err)
+	}
+}
+
+// Push the record dropping the oldest one if full, which must be called with the lock
+func (q *TelemetryQueue) push(r TelemetryRecord) {
+	if len(q.records) >= telemetryQueueMaxSize {
+		q.records, q.seqs = q.records[1:], q.seqs[1:]
+		q.stats.Dropped++
+	}
+	q.records = append(q.records, r)
+	q.seqs = append(q.seqs, q.nextSeq)
+	q.nextSeq++
+	q.dirty = true
+}
+
+func (q *TelemetryQueue) pushEvent(playerID, playID string, e TelemetryEvent) {
+	r, err := newTelemetryRecord(playerID, playID, e)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	q.push(*r)
+}
+
+func (q *TelemetryQueue) Send(playerID, playID string, e TelemetryEvent) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// Keep the order of touches and the event
+	q.endTouchStream()
+	q.pushEvent(playerID, playID, e)
+}
+
+func (q *TelemetryQueue) SendTouches(playerID, playID string, ticks uint64, input TouchInput, camera *Camera) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if playerID != q.touchPlayerID || playID != q.touchPlayID || ticks < q.lastTicks {
+		q.endTouchStream()
+		q.touchPlayerID, q.touchPlayID = playerID, playID
+		q.touching = false
+	}
+
+	var state int
+	switch {
+	case input.IsJustTouched():
+		state = touchStateTouched
+	case input.IsJustReleased():
+		state = touchStateReleased
+	case input.IsBeingTouched():
+		state = touchStateMoved
+	default:
+		return
+	}
+	if state == touchStateReleased && !q.touching {
+		return
+	}
+
+	pos := input.GetTouchPosition()
+	if state == touchStateMoved && q.touching && pos.X == q.lastX && pos.Y == q.lastY {
+		return
+	}
+
+	if q.touchStream == nil {
+		q.touchStream = &TouchStreamEvent{Ticks: ticks}
+		q.lastX, q.lastY = 0, 0
+		q.lastTicks = ticks
+	}
+	q.touchStream.Deltas = append(q.touchStream.Deltas, [4]int{
+		int(ticks - q.lastTicks),
+		pos.X - q.lastX,
+		pos.Y - q.lastY,
+		state,
+	})
+	q.lastX, q.lastY = pos.X, pos.Y
+
+	if c := newTouchCamera(camera); len(q.touchStream.Cameras) == 0 || *c != q.lastCamera {
+		q.touchStream.Cameras = append(q.touchStream.Cameras, TouchStreamCamera{
+			Index:       len(q.touchStream.Deltas) - 1,
+			TouchCamera: *c,
+		})
+		q.lastCamera = *c
+	}
+	q.lastTicks = ticks
+	q.touching = state != touchStateReleased
+
+	if len(q.touchStream.Deltas) >= touchStreamMaxSize {
+		q.endTouchStream()
+	}
+}
+
+// Push the touch stream being built, which must be called with the lock
+func (q *TelemetryQueue) endTouchStream() {
+	if q.touchStream == nil {
+		return
+	}
+	q.pushEvent(q.touchPlayerID, q.touchPlayID, q.touchStream)
+	q.touchStream = nil
+}
+
+func (q *TelemetryQueue) Flush() {
+	select {
+	case q.flushCh <- struct{}{}:
+	default:
+	}
+}
+
+func (q *TelemetryQueue) RegisterScore(rankingName, playerID, playID string, score int) <-chan []logging.GameScore {
+	return loggingutil.RegisterScoreToRankingAsync(rankingName, playerID, playID, score)
+}
+
+func (q *TelemetryQueue) Stats() TelemetryStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	stats := q.stats
+	stats.Queued = len(q.records)
+	return stats
+}
+
+func (q *TelemetryQueue) run() {
+	wait := telemetryFlushInterval
+	for {
+		flushed := false
+		select {
+		case <-q.flushCh:
+			flushed = true
+		case <-time.After(wait):
+		}
+
+		err := q.sendAll(flushed)
+
+		q.mu.Lock()
+		if err != nil {
+			q.stats.Failures++
+			q.stats.LastError = err.Error()
+			q.stats.Backoff = nextTelemetryBackoff(q.stats.Backoff)
+			wait = q.stats.Backoff
+		} else {
+			q.stats.Backoff = 0
+			wait = telemetryFlushInterval
+		}
+		q.mu.Unlock()
+
+		q.save()
+	}
+}
+
+// Get the backoff after another failure, which doubles from the minimum up to the maximum
+func nextTelemetryBackoff(backoff time.Duration) time.Duration {
+	if backoff == 0 {
+		return telemetryMinBackoff
+	}
+	backoff *= 2
+	if backoff > telemetryMaxBackoff {
+		backoff = telemetryMaxBackoff
+	}
+	return backoff
+}
+
+// Send the queued records in batches until empty or a failure.
+// Touches are sent when the stream ends unless flushed.
+func (q *TelemetryQueue) sendAll(flushed bool) error {
+	for {
+		q.mu.Lock()
+		if flushed {
+			q.endTouchStream()
+		}
+		n := len(q.records)
+		if n == 0 {
+			q.mu.Unlock()
+			return nil
+		}
+		if n > telemetryBatchMaxSize {
+			n = telemetryBatchMaxSize
+		}
+		batch := &TelemetryBatch{Records: append([]TelemetryRecord(nil), q.records[:n]...)}
+		lastSeq := q.seqs[n-1]
+		q.mu.Unlock()
+
+		if err := q.send(batch); err != nil {
+			return err
+		}
+
+		q.mu.Lock()
+		// Records may have been dropped while sending
+		for len(q.seqs) > 0 && q.seqs[0] <= lastSeq {
+			q.records, q.seqs = q.records[1:], q.seqs[1:]
+		}
+		q.stats.SentBatches++
+		q.dirty = true
+		q.mu.Unlock()
+	}
+}
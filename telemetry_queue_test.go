@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/tsujio/game-four-color-theorem/analytics"
+	"github.com/tsujio/game-util/touchutil"
+)
+
+func TestTelemetryQueueSendsInBatches(t *testing.T) {
+	var batches []*TelemetryBatch
+	var sendErr error
+	q := &TelemetryQueue{send: func(b *TelemetryBatch) error {
+		if sendErr != nil {
+			return sendErr
+		}
+		batches = append(batches, b)
+		return nil
+	}}
+	n := 2*telemetryBatchMaxSize + 1
+	for i := 0; i < n; i++ {
+		q.pushEvent("player", "play", PlayingEvent{Ticks: uint64(i)})
+	}
+
+	// Records are kept while offline
+	sendErr = errors.New("offline")
+	if err := q.sendAll(false); err != sendErr || len(q.records) != n {
+		t.Fatalf("%d records kept after %v", len(q.records), err)
+	}
+
+	sendErr = nil
+	if err := q.sendAll(false); err != nil {
+		t.Fatal(err)
+	}
+	if len(q.records) != 0 || q.stats.SentBatches != 3 {
+		t.Fatalf("%d records left after %d batches", len(q.records), q.stats.SentBatches)
+	}
+	var ticks uint64
+	for i, b := range batches {
+		if len(b.Records) > telemetryBatchMaxSize {
+			t.Fatalf("batch %d has %d records", i, len(b.Records))
+		}
+		for _, r := range b.Records {
+			var e PlayingEvent
+			if err := json.Unmarshal(r.Event, &e); err != nil || e.Ticks != ticks {
+				t.Fatalf("record %s sent for ticks %d", r.Event, ticks)
+			}
+			ticks++
+		}
+	}
+	if ticks != uint64(n) {
+		t.Fatalf("%d records sent, %d pushed", ticks, n)
+	}
+}
+
+// touchState is the input in a touch state of the stream, or not touched with -1
+type touchState struct {
+	ScriptedInput
+	state int
+	x, y  int
+}
+
+func (i *touchState) IsJustTouched() bool  { return i.state == touchStateTouched }
+func (i *touchState) IsJustReleased() bool { return i.state == touchStateReleased }
+func (i *touchState) IsBeingTouched() bool {
+	return i.state == touchStateTouched || i.state == touchStateMoved
+}
+func (i *touchState) GetTouchPosition() touchutil.TouchPosition {
+	return touchutil.TouchPosition{X: i.x, Y: i.y}
+}
+
+func TestTelemetryQueueTouchStreamRoundTrip(t *testing.T) {
+	q := &TelemetryQueue{}
+	q.Send("player", "play", StartGameEvent{Colors: 4, Seed: 1})
+
+	camera := &Camera{center: Point{X: 1, Y: 2}, scale: 1, viewCenter: Point{X: 320, Y: 240}}
+	moved := &Camera{center: Point{X: 3, Y: 4}, scale: 2, viewCenter: Point{X: 320, Y: 240}}
+	inputs := []struct {
+		ticks  uint64
+		input  touchState
+		camera *Camera
+	}{
+		{10, touchState{state: touchStateTouched, x: 5, y: 5}, camera},
+		// Touches staying still are skipped
+		{11, touchState{state: touchStateMoved, x: 5, y: 5}, camera},
+		{12, touchState{state: touchStateMoved, x: 8, y: 2}, camera},
+		{13, touchState{state: -1}, camera},
+		{15, touchState{state: touchStateReleased, x: 8, y: 2}, moved},
+		{20, touchState{state: touchStateTouched, x: 100, y: 50}, moved},
+		{21, touchState{state: touchStateReleased, x: 100, y: 50}, moved},
+	}
+	for _, in := range inputs {
+		q.SendTouches("player", "play", in.ticks, &in.input, in.camera)
+	}
+	q.Send("player", "play", GameOverEvent{Score: 1})
+
+	data, err := json.Marshal(q.records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []analytics.Record
+	if err := json.Unmarshal(data, &records); err != nil {
+		t.Fatal(err)
+	}
+	plays, err := analytics.GroupPlays(records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plays) != 1 {
+		t.Fatalf("%d plays", len(plays))
+	}
+
+	expected := []struct {
+		ticks             uint64
+		touched, released bool
+		x, y              int
+		camera            *Camera
+	}{
+		{10, true, false, 5, 5, camera},
+		{12, false, false, 8, 2, camera},
+		{15, false, true, 8, 2, moved},
+		{20, true, false, 100, 50, moved},
+		{21, false, true, 100, 50, moved},
+	}
+	touches := plays[0].Touches
+	if len(touches) != len(expected) {
+		t.Fatalf("%d touches decoded, expected %d", len(touches), len(expected))
+	}
+	for i, e := range expected {
+		touch := touches[i]
+		c := newTouchCamera(e.camera)
+		if touch.Ticks != e.ticks || touch.JustTouched != e.touched || touch.JustReleased != e.released || touch.X != e.x || touch.Y != e.y ||
+			touch.Camera == nil || *touch.Camera != analytics.TouchCamera(*c) {
+			t.Fatalf("touch %d decoded into %+v, expected %+v", i, touch, e)
+		}
+	}
+}
+
+func TestNextTelemetryBackoff(t *testing.T) {
+	backoff := nextTelemetryBackoff(0)
+	if backoff != telemetryMinBackoff {
+		t.Fatalf("first backoff %v", backoff)
+	}
+	for i := 0; i < 100; i++ {
+		next := nextTelemetryBackoff(backoff)
+		if next > telemetryMaxBackoff || next < backoff {
+			t.Fatalf("backoff %v after %v", next, backoff)
+		}
+		backoff = next
+	}
+	if backoff != telemetryMaxBackoff {
+		t.Fatalf("backoff %v not clamped to %v", backoff, telemetryMaxBackoff)
+	}
+}
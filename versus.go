@@ -0,0 +1,402 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"log"
+	"math"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/tsujio/game-four-color-theorem/puzzle"
+	"github.com/tsujio/game-four-color-theorem/relay"
+)
+
+const (
+	// Ticks between progress updates sent to the others
+	versusProgressInterval = 30
+	versusRoomLength       = 6
+	versusNameLength       = 4
+	versusColorNum         = 4
+)
+
+type VersusOpponent struct {
+	name     string
+	progress relay.ProgressData
+	online   bool
+	// Cursor on the map in the co-op game, which is nil until it is sent
+	cursor *Point
+}
+
+// Versus is the game with the players in a room of the relay, from the lobby to the game over.
+// All players play the puzzle of the first race message, each with their own clock, racing
+// on their own boards or coloring the same board together in the co-op game.
+type Versus struct {
+	client    *relay.Client
+	room      string
+	coop      bool
+	joined    bool
+	race      *puzzle.PuzzleCode
+	raceSeq   int64
+	opponents map[string]*VersusOpponent
+	// Opponents in the order of joining, for stable drawing
+	order    []string
+	lastSent *relay.ProgressData
+	// Latest writes of the co-op board by area ID, and the logical clock of them
+	writes     map[int]coopWrite
+	clock      int64
+	lastCursor *relay.CursorData
+}
+
+func getVersusName(playerID string) string {
+	name := strings.ToUpper(strings.ReplaceAll(playerID, "-", ""))
+	if len(name) > versusNameLength {
+		name = name[:versusNameLength]
+	}
+	return name
+}
+
+// Generate a room name which is easy to tell a friend
+func (g *Game) generateRoomName() string {
+	const chars = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	var b strings.Builder
+	for i := 0; i < versusRoomLength; i++ {
+		b.WriteByte(chars[g.random.Intn(len(chars))])
+	}
+	return b.String()
+}
+
+func (g *Game) joinVersus(room string, coop bool) {
+	url := getLaunchParam("relay")
+	if url == "" {
+		url = getDefaultRelayURL()
+	}
+	// Co-op rooms are apart from the race rooms of the same name
+	relayRoom := room
+	if coop {
+		relayRoom = "coop:" + room
+	}
+	player := relay.Player{ID: g.playerID, Name: getVersusName(g.playerID)}
+	g.versus = &Versus{
+		client:    relay.NewClient(url, relayRoom, player, dialRelay),
+		room:      room,
+		coop:      coop,
+		opponents: make(map[string]*VersusOpponent),
+		writes:    make(map[int]coopWrite),
+	}
+}
+
+func (g *Game) leaveVersus() {
+	if g.versus == nil {
+		return
+	}
+	g.versus.client.Close()
+	g.versus = nil
+}
+
+func (v *Versus) getOpponent(id, name string) *VersusOpponent {
+	o, ok := v.opponents[id]
+	if !ok {
+		o = &VersusOpponent{}
+		v.opponents[id] = o
+		v.order = append(v.order, id)
+	}
+	if name != "" {
+		o.name = name
+	}
+	return o
+}
+
+func (v *Versus) send(messageType, key string, data interface{}) {
+	m, err := relay.NewMessage(messageType, key, data)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	v.client.Send(m)
+}
+
+// Host a race since nobody in the room has started one
+func (g *Game) hostVersusRace() {
+	v := g.versus
+	v.race = &puzzle.PuzzleCode{
+		GeneratorVersion: puzzle.GeneratorVersion,
+		Seed:             g.clock.Now().Unix(),
+		Mode:             puzzle.ModeNormal,
+		ColorNum:         versusColorNum,
+	}
+	// The sequence number is unknown until the server echoes the race
+	v.raceSeq = 0
+	m, err := relay.NewMessage(relay.TypeRace, relay.TypeRace, relay.RaceData{Code: v.race.Encode()})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	m.Echo = true
+	v.client.Send(m)
+}
+
+func (g *Game) handleVersusMessage(m *relay.Message) {
+	v := g.versus
+	self := v.client.Player().ID
+
+	switch m.Type {
+	case relay.TypeWelcome:
+		var w relay.Welcome
+		if err := json.Unmarshal(m.Data, &w); err != nil {
+			log.Println(err)
+			return
+		}
+		for _, o := range v.opponents {
+			o.online = false
+		}
+		for _, p := range w.Players {
+			if p.ID != self {
+				v.getOpponent(p.ID, p.Name).online = true
+			}
+		}
+		// Rooms are dropped when empty, so the first player hosts the race
+		if len(w.Players) == 1 && v.race == nil {
+			g.hostVersusRace()
+		}
+		v.joined = true
+	case relay.TypeJoin:
+		v.getOpponent(m.From, m.Name).online = true
+	case relay.TypeLeave:
+		v.getOpponent(m.From, m.Name).online = false
+	case relay.TypeRace:
+		var r relay.RaceData
+		if err := json.Unmarshal(m.Data, &r); err != nil {
+			log.Println(err)
+			return
+		}
+		if m.From == self {
+			// The echo of the own race, which has been replaced if the code differs
+			if v.race != nil && v.raceSeq == 0 && r.Code == v.race.Encode() {
+				v.raceSeq = m.Seq
+			}
+			return
+		}
+		code, err := puzzle.DecodePuzzleCode(r.Code)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		// The race started first wins, which is not changed once playing. The own race
+		// waiting for its echo was started later, since messages arrive in the order of the room.
+		earlier := v.raceSeq == 0 || m.Seq < v.raceSeq
+		if v.race == nil || (earlier && g.mode == GameModeVersus) {
+			v.race, v.raceSeq = code, m.Seq
+		}
+	case relay.TypeProgress:
+		if m.From == self {
+			return
+		}
+		var p relay.ProgressData
+		if err := json.Unmarshal(m.Data, &p); err != nil {
+			log.Println(err)
+			return
+		}
+		o := v.getOpponent(m.From, m.Name)
+		o.progress = p
+	case relay.TypeOp:
+		var o relay.OpData
+		if err := json.Unmarshal(m.Data, &o); err != nil {
+			log.Println(err)
+			return
+		}
+		g.handleCoopOp(m.From, &o)
+	case relay.TypeCursor:
+		if m.From == self {
+			return
+		}
+		var c relay.CursorData
+		if err := json.Unmarshal(m.Data, &c); err != nil {
+			log.Println(err)
+			return
+		}
+		v.getOpponent(m.From, m.Name).cursor = &Point{X: c.X, Y: c.Y}
+	}
+}
+
+func (g *Game) sendVersusProgress(finished bool) {
+	v := g.versus
+	p := relay.ProgressData{
+		Progress: g.getProgress(),
+		Ticks:    g.score,
+		Finished: finished,
+	}
+	// Ticks advance every time, so only the progress is compared
+	if v.lastSent != nil && v.lastSent.Progress == p.Progress && !finished {
+		return
+	}
+	v.lastSent = &p
+	v.send(relay.TypeProgress, relay.TypeProgress, p)
+}
+
+// Exchange the messages of the race, which does not change the game so that replays are not affected
+func (g *Game) updateVersus() {
+	if g.versus == nil {
+		return
+	}
+
+	for _, m := range g.versus.client.Poll() {
+		g.handleVersusMessage(&m)
+	}
+
+	if g.mode == GameModePlaying && g.ticksFromModeStart%versusProgressInterval == 0 {
+		g.sendVersusProgress(false)
+	}
+	if g.mode == GameModePlaying && g.versus.coop {
+		g.updateCoopCursor()
+	}
+}
+
+func (g *Game) startVersusRace() {
+	v := g.versus
+	if v.race == nil {
+		return
+	}
+	v.lastSent = nil
+	g.startCode(v.race, settings.InputStyle)
+	if v.coop {
+		g.applyCoopWrites()
+	}
+	g.sendVersusProgress(false)
+}
+
+func (g *Game) getVersusRoomButtonRect() (x, y, w, h float64) {
+	return 330, 6, 140, 22
+}
+
+func (g *Game) updateVersusLobby() {
+	v := g.versus
+
+	if v == nil && updateTextInput(g.touchContext, &g.roomInput) && g.roomInput != "" {
+		g.joinVersus(g.roomInput, g.roomCoop)
+		return
+	}
+	if v != nil && v.race != nil && g.touchContext.IsKeyJustPressed(ebiten.KeyEnter) {
+		g.startVersusRace()
+		return
+	}
+	if g.touchContext.IsKeyJustPressed(ebiten.KeyEscape) {
+		g.leaveVersus()
+		g.setNextMode(GameModeTitle)
+		return
+	}
+
+	if !g.touchContext.IsJustTouched() {
+		return
+	}
+
+	pos := g.touchContext.GetTouchPosition()
+	p := g.getUICamera().toWorld(&Point{X: float64(pos.X), Y: float64(pos.Y)})
+
+	if v == nil && g.isTextFieldTouched(p, msg("room"), &g.roomInput) {
+		return
+	}
+	if x, y, w, h := g.getVersusModeButtonRect(); v == nil && x <= p.X && p.X <= x+w && y <= p.Y && p.Y <= y+h {
+		g.roomCoop = !g.roomCoop
+		return
+	}
+	if x, y, w, h := g.getCodePlayButtonRect(); x <= p.X && p.X <= x+w && y <= p.Y && p.Y <= y+h {
+		if v == nil && g.roomInput != "" {
+			g.joinVersus(g.roomInput, g.roomCoop)
+		} else if v != nil {
+			g.startVersusRace()
+		}
+		return
+	}
+	if x, y, w, h := g.getSettingsBackButtonRect(); x <= p.X && p.X <= x+w && y <= p.Y && p.Y <= y+h {
+		g.leaveVersus()
+		g.setNextMode(GameModeTitle)
+	}
+}
+
+func (v *Versus) getStatus() string {
+	switch {
+	case !v.client.Connected() || !v.joined:
+		return msg("connecting")
+	case v.race == nil:
+		return msg("waiting")
+	default:
+		return fmt.Sprintf("%s %s %s", getVersusModeName(v.coop), msg("room"), v.room)
+	}
+}
+
+func getVersusModeName(coop bool) string {
+	if coop {
+		return msg("coop")
+	}
+	return msg("race")
+}
+
+func (g *Game) getVersusModeButtonRect() (x, y, w, h float64) {
+	return screenWidth/2 - 80, 228, 160, 22
+}
+
+func (o *VersusOpponent) getLabel() string {
+	if o.progress.Finished {
+		secs := o.progress.Ticks / 60
+		return fmt.Sprintf("%s %d:%02d", o.name, secs/60, secs%60)
+	}
+	return fmt.Sprintf("%s %d%%", o.name, int(math.Floor(o.progress.Progress*100)))
+}
+
+func (o *VersusOpponent) getColor() color.Color {
+	if o.online {
+		return color.White
+	}
+	return color.RGBA{0x80, 0x80, 0x80, 0xff}
+}
+
+func (g *Game) drawVersusLobby(screen *ebiten.Image) {
+	v := g.versus
+
+	ebitenutil.DrawRect(screen, 0, 0, g.width, g.height, color.RGBA{0, 0, 0, 0x80})
+
+	g.drawUIText(screen, msg("versus"), fontM, screenWidth/2, 60, TextAlignCenter, color.White)
+	g.drawUIText(screen, msg("room_usage"), fontS, screenWidth/2, 140, TextAlignCenter, color.White)
+
+	if v == nil {
+		g.drawTextField(screen, g.roomInput, true)
+
+		x, y, w, h := g.getVersusModeButtonRect()
+		g.drawUIButton(screen, getVersusModeName(g.roomCoop), x, y, w, h)
+
+		x, y, w, h = g.getCodePlayButtonRect()
+		g.drawUIButton(screen, msg("join"), x, y, w, h)
+	} else {
+		g.drawTextField(screen, v.room, false)
+
+		_, fy, _, fh := g.getCodeFieldRect()
+		g.drawUIText(screen, v.getStatus(), fontS, screenWidth/2, fy+fh+30, TextAlignCenter, color.White)
+
+		if v.race != nil {
+			x, y, w, h := g.getCodePlayButtonRect()
+			g.drawUIButton(screen, msg("start"), x, y, w, h)
+		}
+
+		for i, id := range v.order {
+			o := v.opponents[id]
+			g.drawUIText(screen, o.getLabel(), fontS, screenWidth/2, 340+float64(i)*18, TextAlignCenter, o.getColor())
+		}
+	}
+
+	x, y, w, h := g.getSettingsBackButtonRect()
+	g.drawUIButton(screen, msg("back"), x, y, w, h)
+}
+
+// Draw the progress of the opponents under the progress of the player
+func (g *Game) drawVersusProgress(screen *ebiten.Image) {
+	if g.versus == nil {
+		return
+	}
+	for i, id := range g.versus.order {
+		o := g.versus.opponents[id]
+		g.drawText(screen, o.getLabel(), fontS, g.width-10*g.uiScale, (40+float64(i)*16)*g.uiScale, TextAlignRight, o.getColor())
+	}
+}